@@ -0,0 +1,90 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+)
+
+// KeyChecker defines the CheckKey method which provides API key checking.
+type KeyChecker interface {
+	// CheckKey returns true if and only if the API key is valid.
+	CheckKey(key string) bool
+}
+
+// HashKey returns the hex-encoded SHA-256 digest of the API key, as used by HashedKeys.
+func HashKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// HashedKeys creates a KeyChecker which accepts API keys whose digest (see HashKey) is
+// in hashes, so that the keys themselves need not be stored.
+func HashedKeys(hashes ...string) KeyChecker {
+	m := make(map[string]bool, len(hashes))
+	for _, h := range hashes {
+		m[h] = true
+	}
+	return hashedKeys{
+		m: m,
+	}
+}
+
+// Keys creates a KeyChecker which accepts the given API keys.  Only the digests of the
+// keys are retained.
+func Keys(keys ...string) KeyChecker {
+	hashes := make([]string, len(keys))
+	for i, k := range keys {
+		hashes[i] = HashKey(k)
+	}
+	return HashedKeys(hashes...)
+}
+
+type hashedKeys struct {
+	m map[string]bool
+}
+
+// CheckKey implements KeyChecker.
+func (k hashedKeys) CheckKey(key string) bool {
+	return key != "" && k.m[HashKey(key)]
+}
+
+type apiKeyHandler struct {
+	http.Handler
+	kc            KeyChecker
+	header, param string
+}
+
+// NewAPIKeyHandler returns an http.Handler which reads an API key from the request
+// header (e.g. "X-API-Key") or, if not present there, from the URL query parameter param,
+// and passes requests to the given http.Handler when the KeyChecker accepts the key
+// (responds with http.StatusUnauthorized otherwise).  Either header or param may be empty
+// to disable that source of keys.
+func NewAPIKeyHandler(kc KeyChecker, header, param string, h http.Handler) http.Handler {
+	return &apiKeyHandler{
+		Handler: h,
+		kc:      kc,
+		header:  header,
+		param:   param,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *apiKeyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var key string
+	if h.header != "" {
+		key = r.Header.Get(h.header)
+	}
+	if key == "" && h.param != "" {
+		key = r.URL.Query().Get(h.param)
+	}
+	if !h.kc.CheckKey(key) {
+		unauthorized(w, r, "")
+		return
+	}
+	h.Handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,72 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// TokenChecker defines the CheckToken method which provides bearer token validation.
+type TokenChecker interface {
+	// CheckToken validates the token, returning its claims or an error if the token
+	// is not valid.
+	CheckToken(token string) (Claims, error)
+}
+
+type claimsKey struct{}
+
+// ClaimsFromContext returns the Claims stored in ctx by a bearer handler, if any.
+func ClaimsFromContext(ctx context.Context) (Claims, bool) {
+	c, ok := ctx.Value(claimsKey{}).(Claims)
+	return c, ok
+}
+
+// bearerToken returns the token from the Authorization header of r, or the empty
+// string if there is no bearer token.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(auth[len(prefix):])
+}
+
+// NewBearerHandler returns an http.Handler which validates bearer tokens from the
+// Authorization header using the TokenChecker and passes requests to the given
+// http.Handler when the token is valid (responds with http.StatusUnauthorized otherwise).
+// The token claims are added to the request context, see ClaimsFromContext.
+func NewBearerHandler(tc TokenChecker, h http.Handler) http.Handler {
+	return NewMultiHandler(h, BearerScheme(tc))
+}
+
+// RequireScope returns middleware which passes requests only if the token claims in
+// the request context (see ClaimsFromContext) grant all of the scopes (see
+// Claims.Scopes), so must be used behind a bearer handler.  Requests without claims
+// receive http.StatusUnauthorized, and those lacking a scope receive
+// http.StatusForbidden with an insufficient_scope challenge (RFC 6750 section 3.1).
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	challenge := `Bearer error="insufficient_scope", scope=` + quote(strings.Join(scopes, " "))
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFromContext(r.Context())
+			if !ok {
+				unauthorized(w, r, "Bearer")
+				return
+			}
+			granted := claims.Scopes()
+			for _, s := range scopes {
+				if !containsString(granted, s) {
+					w.Header().Add("WWW-Authenticate", challenge)
+					writeError(w, r, http.StatusForbidden)
+					return
+				}
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
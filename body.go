@@ -0,0 +1,121 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// maxReplayBody is the largest request body which Client buffers in memory so that a
+// challenged request can be retried.
+const maxReplayBody = 1 << 20
+
+// ErrBodyNotReplayable is returned by Signers which hash the request body (HMACSigner,
+// HawkSigner, SigV4Signer and MessageSignatureSigner covering content-digest) when the
+// body is larger than 10MB and cannot be read again (see ReplayableBody).
+var ErrBodyNotReplayable = errors.New("httpauth: request body is too large to buffer for signing")
+
+// BufferBody reads the body of r into memory and replaces it, setting GetBody (and
+// ContentLength) so that the body can be sent again, e.g. when a request is retried
+// after an authentication challenge, or redirected with http.StatusTemporaryRedirect.
+// Requests with no body, or which already have GetBody (as set by http.NewRequest for
+// in-memory bodies), are unchanged.
+func BufferBody(r *http.Request) error {
+	_, err := bufferBody(r, -1)
+	return err
+}
+
+// bufferBody is like BufferBody, but reads at most max bytes if max is not negative.
+// If the body is longer then it is restored without GetBody and bufferBody returns
+// false.
+func bufferBody(r *http.Request, max int64) (bool, error) {
+	if r.Body == nil || r.Body == http.NoBody || r.GetBody != nil {
+		return true, nil
+	}
+	var src io.Reader = r.Body
+	if max >= 0 {
+		src = io.LimitReader(r.Body, max+1)
+	}
+	b, err := ioutil.ReadAll(src)
+	if err != nil {
+		r.Body.Close()
+		return false, err
+	}
+	if max >= 0 && int64(len(b)) > max {
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(b), r.Body), r.Body}
+		return false, nil
+	}
+	r.Body.Close()
+
+	r.ContentLength = int64(len(b))
+	r.GetBody = func() (io.ReadCloser, error) {
+		if len(b) == 0 {
+			return http.NoBody, nil
+		}
+		return ioutil.NopCloser(bytes.NewReader(b)), nil
+	}
+	r.Body, _ = r.GetBody()
+	return true, nil
+}
+
+// ReplayableBody sets the body of r to be read from getBody, which must return a new
+// reader of the same content (size bytes, or -1 if unknown) each time it is called.
+// Signers which hash the body then read it from a second copy, a chunk at a time,
+// rather than buffering it in memory, so that large uploads (e.g. from files, see
+// FileBody) can be signed and retried.
+func ReplayableBody(r *http.Request, getBody func() (io.ReadCloser, error), size int64) error {
+	body, err := getBody()
+	if err != nil {
+		return err
+	}
+	if r.Body != nil {
+		r.Body.Close()
+	}
+	r.Body, r.GetBody, r.ContentLength = body, getBody, size
+	if size == 0 {
+		r.Body.Close()
+		r.Body = http.NoBody
+	}
+	return nil
+}
+
+// FileBody sets the body of r to the contents of the named file, which is opened again
+// whenever the body must be re-read (see ReplayableBody).
+func FileBody(r *http.Request, name string) error {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	return ReplayableBody(r, func() (io.ReadCloser, error) {
+		return os.Open(name)
+	}, fi.Size())
+}
+
+// bodyCopy returns a new copy of the body of r, for signers which hash it, first
+// buffering the body if it has no GetBody and is no larger than maxSignedBody.
+func bodyCopy(r *http.Request) (io.ReadCloser, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return http.NoBody, nil
+	}
+	ok, err := bufferBody(r, maxSignedBody)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrBodyNotReplayable
+	}
+	return r.GetBody()
+}
+
+// readCloser combines a Reader with the Closer of the body it was made from.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
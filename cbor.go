@@ -0,0 +1,134 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// errCBOR is returned when decoding malformed or unsupported CBOR.
+var errCBOR = errors.New("httpauth: malformed CBOR")
+
+// cborMaxDepth is the maximum nesting depth of decoded CBOR values.
+const cborMaxDepth = 16
+
+// decodeCBOR decodes the first CBOR value in b (RFC 8949), returning it and the number of
+// bytes it used.  Only the subset used by WebAuthn is supported: definite-length
+// integers, byte and text strings, arrays and maps, and the simple values false, true
+// and null.  Integers are decoded as int64, byte strings as []byte, text strings as
+// string, arrays as []interface{} and maps as map[interface{}]interface{}.
+func decodeCBOR(b []byte) (interface{}, int, error) {
+	return decodeCBORDepth(b, 0)
+}
+
+func decodeCBORDepth(b []byte, depth int) (interface{}, int, error) {
+	if depth > cborMaxDepth || len(b) == 0 {
+		return nil, 0, errCBOR
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	n := 1
+
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(b) < 1+size {
+			return nil, 0, errCBOR
+		}
+		switch size {
+		case 1:
+			arg = uint64(b[1])
+		case 2:
+			arg = uint64(binary.BigEndian.Uint16(b[1:]))
+		case 4:
+			arg = uint64(binary.BigEndian.Uint32(b[1:]))
+		case 8:
+			arg = binary.BigEndian.Uint64(b[1:])
+		}
+		n += size
+	default:
+		// Indefinite lengths and reserved values.
+		return nil, 0, errCBOR
+	}
+
+	switch major {
+	case 0:
+		if arg > 1<<63-1 {
+			return nil, 0, errCBOR
+		}
+		return int64(arg), n, nil
+
+	case 1:
+		if arg > 1<<63-1 {
+			return nil, 0, errCBOR
+		}
+		return -1 - int64(arg), n, nil
+
+	case 2, 3:
+		if arg > uint64(len(b)-n) {
+			return nil, 0, errCBOR
+		}
+		s := b[n : n+int(arg)]
+		n += int(arg)
+		if major == 3 {
+			return string(s), n, nil
+		}
+		return append([]byte(nil), s...), n, nil
+
+	case 4:
+		if arg > uint64(len(b)-n) {
+			return nil, 0, errCBOR
+		}
+		l := make([]interface{}, 0, int(arg))
+		for i := uint64(0); i < arg; i++ {
+			v, m, err := decodeCBORDepth(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			l = append(l, v)
+			n += m
+		}
+		return l, n, nil
+
+	case 5:
+		if arg > uint64(len(b)-n)/2 {
+			return nil, 0, errCBOR
+		}
+		m := make(map[interface{}]interface{}, int(arg))
+		for i := uint64(0); i < arg; i++ {
+			k, kn, err := decodeCBORDepth(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += kn
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, 0, errCBOR
+			}
+			v, vn, err := decodeCBORDepth(b[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += vn
+			m[k] = v
+		}
+		return m, n, nil
+
+	case 7:
+		switch info {
+		case 20:
+			return false, n, nil
+		case 21:
+			return true, n, nil
+		case 22:
+			return nil, n, nil
+		}
+	}
+	return nil, 0, errCBOR
+}
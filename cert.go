@@ -0,0 +1,122 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// CertChecker defines the CheckCert method which provides TLS client certificate checking.
+// Certificates are checked after the TLS handshake, so chain verification should be
+// configured on the server (see tls.Config.ClientAuth and ClientCAs).
+type CertChecker interface {
+	// CheckCert returns true if and only if the client certificate is acceptable.
+	CheckCert(cert *x509.Certificate) bool
+}
+
+// CertFingerprints creates a CertChecker which accepts certificates whose hex-encoded
+// SHA-256 fingerprint is in fps (colons and case are ignored).
+func CertFingerprints(fps ...string) CertChecker {
+	m := make(map[string]bool, len(fps))
+	for _, fp := range fps {
+		m[normaliseFingerprint(fp)] = true
+	}
+	return certFingerprints{
+		m: m,
+	}
+}
+
+func normaliseFingerprint(fp string) string {
+	return strings.ToLower(strings.Replace(fp, ":", "", -1))
+}
+
+// CertFingerprint returns the hex-encoded SHA-256 fingerprint of the certificate, as
+// used by CertFingerprints.
+func CertFingerprint(cert *x509.Certificate) string {
+	h := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(h[:])
+}
+
+type certFingerprints struct {
+	m map[string]bool
+}
+
+// CheckCert implements CertChecker.
+func (c certFingerprints) CheckCert(cert *x509.Certificate) bool {
+	return c.m[CertFingerprint(cert)]
+}
+
+// CertNames creates a CertChecker which accepts certificates whose subject common name,
+// or any DNS, email or URI subject alternative name, is in names.  Names are only
+// trusted if the handshake verified the certificate chain (tls.VerifyClientCertIfGiven
+// or tls.RequireAndVerifyClientCert), so unverified certificates are always rejected:
+// with tls.RequestClientCert or tls.RequireAnyClientCert a client can present a
+// self-signed certificate with any names.
+func CertNames(names ...string) CertChecker {
+	m := make(map[string]bool, len(names))
+	for _, n := range names {
+		m[n] = true
+	}
+	return certNames{
+		m: m,
+	}
+}
+
+type certNames struct {
+	m map[string]bool
+}
+
+// requiresVerifiedChain implements chainVerifier.
+func (certNames) requiresVerifiedChain() bool { return true }
+
+// CheckCert implements CertChecker.
+func (c certNames) CheckCert(cert *x509.Certificate) bool {
+	if c.m[cert.Subject.CommonName] {
+		return true
+	}
+	for _, n := range cert.DNSNames {
+		if c.m[n] {
+			return true
+		}
+	}
+	for _, n := range cert.EmailAddresses {
+		if c.m[n] {
+			return true
+		}
+	}
+	for _, u := range cert.URIs {
+		if c.m[u.String()] {
+			return true
+		}
+	}
+	return false
+}
+
+// chainVerifier is implemented by CertCheckers which only accept certificates whose
+// chain was verified in the TLS handshake.
+type chainVerifier interface {
+	requiresVerifiedChain() bool
+}
+
+// checkPeerCert returns true if the TLS client certificate presented with r (see
+// peerCert) is accepted by cc.
+func checkPeerCert(cc CertChecker, r *http.Request, cert *x509.Certificate) bool {
+	if v, ok := cc.(chainVerifier); ok && v.requiresVerifiedChain() && len(r.TLS.VerifiedChains) == 0 {
+		return false
+	}
+	return cc.CheckCert(cert)
+}
+
+// peerCert returns the TLS client certificate presented with r, or nil if there is none.
+func peerCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
@@ -0,0 +1,148 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IPResolver resolves the IP address of the client which sent a request, using the
+// X-Forwarded-For, Forwarded or X-Real-IP headers only when the request was received
+// from a trusted proxy.
+type IPResolver struct {
+	trusted []*net.IPNet
+}
+
+// NewIPResolver creates an IPResolver which trusts proxies with addresses in the CIDR
+// ranges (e.g. "10.0.0.0/8"), or single IP addresses.
+func NewIPResolver(trusted ...string) (*IPResolver, error) {
+	nets := make([]*net.IPNet, 0, len(trusted))
+	for _, t := range trusted {
+		if !strings.Contains(t, "/") {
+			ip := net.ParseIP(t)
+			if ip == nil {
+				return nil, fmt.Errorf("httpauth: invalid IP address %q", t)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(t)
+		if err != nil {
+			return nil, fmt.Errorf("httpauth: invalid CIDR %q: %v", t, err)
+		}
+		nets = append(nets, n)
+	}
+	return &IPResolver{
+		trusted: nets,
+	}, nil
+}
+
+// isTrusted returns true if ip is the address of a trusted proxy.
+func (res *IPResolver) isTrusted(ip string) bool {
+	x := net.ParseIP(ip)
+	if x == nil {
+		return false
+	}
+	for _, n := range res.trusted {
+		if n.Contains(x) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client which sent r.  If r was received from a
+// trusted proxy, then the forwarding headers are followed back (skipping further trusted
+// proxies) to the first untrusted address, otherwise the peer address is returned.
+func (res *IPResolver) ClientIP(r *http.Request) string {
+	ip := remoteIP(r)
+	if res == nil || !res.isTrusted(ip) {
+		return ip
+	}
+
+	hops := forwardedFor(r)
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip = hops[i]
+		if !res.isTrusted(ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+// forwardedFor returns the chain of client addresses given by the forwarding headers of
+// r, in the order they were added.
+func forwardedFor(r *http.Request) []string {
+	var hops []string
+	if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		for _, v := range xff {
+			for _, x := range strings.Split(v, ",") {
+				if x = strings.TrimSpace(x); x != "" {
+					hops = append(hops, x)
+				}
+			}
+		}
+		return hops
+	}
+
+	if fwd := r.Header.Values("Forwarded"); len(fwd) > 0 {
+		for _, v := range fwd {
+			for _, elem := range strings.Split(v, ",") {
+				for _, pair := range strings.Split(elem, ";") {
+					pair = strings.TrimSpace(pair)
+					if len(pair) > 4 && strings.EqualFold(pair[:4], "for=") {
+						hops = append(hops, forwardedNode(pair[4:]))
+					}
+				}
+			}
+		}
+		return hops
+	}
+
+	if x := strings.TrimSpace(r.Header.Get("X-Real-IP")); x != "" {
+		hops = append(hops, x)
+	}
+	return hops
+}
+
+// forwardedNode returns the IP address from a Forwarded for= node, which may be quoted
+// and include a port (e.g. "[2001:db8::1]:4711").
+func forwardedNode(s string) string {
+	s = strings.Trim(s, `"`)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return host
+	}
+	return strings.Trim(s, "[]")
+}
+
+// remoteIP returns the IP address of the peer which sent r.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// TrustedProxies configures the handler to use res to determine client IP addresses
+// (for rate limiting, tarpitting and logging) from forwarding headers set by trusted
+// proxies.  By default the peer address of the request is used.
+func TrustedProxies(res *IPResolver) Option {
+	return func(h *handler) {
+		h.ip = res
+	}
+}
+
+// clientIP returns the IP address of the client which sent r.
+func (h *handler) clientIP(r *http.Request) string {
+	return h.ip.ClientIP(r)
+}
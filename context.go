@@ -0,0 +1,37 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"net/http"
+)
+
+type userKey struct{}
+
+// UserFromContext returns the authenticated username stored in ctx by a handler created
+// by NewHandler, if any.
+func UserFromContext(ctx context.Context) (string, bool) {
+	u, ok := ctx.Value(userKey{}).(string)
+	return u, ok
+}
+
+// withUser returns a shallow copy of r with the authenticated username in its context.
+func withUser(r *http.Request, username string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, username))
+}
+
+type anonymousKey struct{}
+
+// IsAnonymous returns true if ctx belongs to a request passed without credentials by a
+// handler configured with AllowAnonymous.
+func IsAnonymous(ctx context.Context) bool {
+	return ctx.Value(anonymousKey{}) != nil
+}
+
+// withAnonymous returns a shallow copy of r marked as anonymous in its context.
+func withAnonymous(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), anonymousKey{}, true))
+}
@@ -0,0 +1,213 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLoginFailed is returned by SessionSigner when the login request is rejected.
+var ErrLoginFailed = errors.New("httpauth: login failed")
+
+// SessionSigner is a ChallengeSigner for servers which use login forms and session
+// cookies (e.g. NewLoginHandler).  It logs in by posting Form (or JSON) to LoginURL,
+// stores the cookies set by the response and adds them to each request.  When the
+// session expires (its cookies expire, or a request receives http.StatusUnauthorized)
+// it logs in again, and Client or Do retry the request.
+//
+// A SessionSigner must not be copied after first use, and is safe for concurrent use.
+type SessionSigner struct {
+	// LoginURL is the URL to which login requests are posted.
+	LoginURL string
+
+	// Form is the login form, e.g. with "username" and "password" fields.
+	Form url.Values
+
+	// JSON, if non-nil, is encoded and posted as the login request body instead of
+	// Form.
+	JSON interface{}
+
+	// Client is used to make login requests.  If nil, http.DefaultClient is used.
+	// Redirects from the login response are never followed.
+	Client *http.Client
+
+	mu      sync.Mutex
+	cookies []*http.Cookie
+}
+
+// Sign implements Signer, logging in first if there is no current session.
+func (s *SessionSigner) Sign(r *http.Request) error {
+	return s.SignContext(r.Context(), r)
+}
+
+// SignContext implements ContextSigner, using ctx for the login request.
+func (s *SessionSigner) SignContext(ctx context.Context, r *http.Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.valid() {
+		if err := s.login(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Replace any session cookies from an earlier signing (e.g. of a retried request).
+	existing := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range existing {
+		if !s.hasCookie(c.Name) {
+			r.AddCookie(c)
+		}
+	}
+	for _, c := range s.cookies {
+		r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	return nil
+}
+
+// hasCookie returns true if name is the name of a session cookie.
+func (s *SessionSigner) hasCookie(name string) bool {
+	for _, c := range s.cookies {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Challenge implements ChallengeSigner by discarding the current session, so that the
+// next request logs in again.
+func (s *SessionSigner) Challenge(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cookies = nil
+	return true
+}
+
+// valid returns true if there are session cookies, none of which have expired.
+func (s *SessionSigner) valid() bool {
+	if len(s.cookies) == 0 {
+		return false
+	}
+	now := time.Now()
+	for _, c := range s.cookies {
+		if !c.Expires.IsZero() && !now.Before(c.Expires) {
+			return false
+		}
+	}
+	return true
+}
+
+// login posts the login request and stores the session cookies from the response.
+func (s *SessionSigner) login(ctx context.Context) error {
+	var body io.Reader
+	contentType := "application/x-www-form-urlencoded"
+	if s.JSON != nil {
+		b, err := json.Marshal(s.JSON)
+		if err != nil {
+			return err
+		}
+		body, contentType = bytes.NewReader(b), "application/json"
+	} else {
+		body = strings.NewReader(s.Form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.LoginURL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	client := http.DefaultClient
+	if s.Client != nil {
+		client = s.Client
+	}
+	c := *client
+	c.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4<<10))
+	resp.Body.Close()
+
+	var cookies []*http.Cookie
+	for _, ck := range resp.Cookies() {
+		if ck.MaxAge > 0 {
+			ck.Expires = time.Now().Add(time.Duration(ck.MaxAge) * time.Second)
+		}
+		if ck.MaxAge >= 0 && ck.Value != "" {
+			cookies = append(cookies, ck)
+		}
+	}
+	if resp.StatusCode >= 400 || len(cookies) == 0 {
+		return ErrLoginFailed
+	}
+	s.cookies = cookies
+	return nil
+}
+
+// Login posts the credentials form (e.g. with "username" and "password" fields) to
+// loginURL using c, so that the session cookies set in response are kept in the client's
+// cookie jar and sent with later requests.  Redirects from the login response are not
+// followed.  If c has no cookie jar then a new one is created on a copy of c.Client
+// (which is not modified), and c.Client is replaced by the copy, so Login must not be
+// called concurrently with other uses of c.  It returns ErrLoginFailed if the login is
+// rejected or the response sets no cookies.
+//
+// Unlike SessionSigner, the Client does not log in again when the session expires.
+func (c *Client) Login(ctx context.Context, loginURL string, credentials url.Values) error {
+	if c.Client == nil || c.Client.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return err
+		}
+		hc := &http.Client{}
+		if c.Client != nil {
+			*hc = *c.Client
+		}
+		hc.Jar = jar
+		c.Client = hc
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", loginURL, strings.NewReader(credentials.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	cc, hc := *c, *c.Client
+	hc.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	cc.Client = &hc
+	resp, err := cc.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4<<10))
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 || len(resp.Cookies()) == 0 {
+		return ErrLoginFailed
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"sync"
+	"time"
+)
+
+// RotatingCreds is a Checker of username-password pairs (or password hashes, see
+// NewRotatingHashedCreds) which allows passwords to be rotated without a hard cutover:
+// after a call to Rotate, both the new and the previous password are accepted until the
+// grace period ends, giving a fleet of clients time to pick up the new password.  It is
+// safe for concurrent use.
+type RotatingCreds struct {
+	mu      sync.RWMutex
+	m       map[string]rotatingCred
+	hashed  bool
+	unknown string // hash checked against the password for unknown usernames
+}
+
+type rotatingCred struct {
+	password string
+
+	previous string
+	expires  time.Time
+}
+
+// NewRotatingCreds creates a RotatingCreds with the initial map of user-password pairs.
+func NewRotatingCreds(m map[string]string) *RotatingCreds {
+	return newRotatingCreds(m, false)
+}
+
+// NewRotatingHashedCreds creates a RotatingCreds with the initial map of usernames to
+// password hashes, in the formats accepted by HashedCreds.  Set and Rotate then take
+// password hashes (see HashPassword) rather than passwords.  As with HashedCreds,
+// passwords for unknown usernames are checked against the most expensive hash.
+func NewRotatingHashedCreds(m map[string]string) *RotatingCreds {
+	return newRotatingCreds(m, true)
+}
+
+func newRotatingCreds(m map[string]string, hashed bool) *RotatingCreds {
+	c := &RotatingCreds{
+		m:       make(map[string]rotatingCred, len(m)),
+		hashed:  hashed,
+		unknown: unknownUserHash,
+	}
+	for username, password := range m {
+		c.set(username, rotatingCred{password: password})
+	}
+	return c
+}
+
+// set sets the credentials of the user.  The caller must hold c.mu.
+func (c *RotatingCreds) set(username string, rc rotatingCred) {
+	c.m[username] = rc
+	if c.hashed && passwordHashCost(rc.password) > passwordHashCost(c.unknown) {
+		c.unknown = rc.password
+	}
+}
+
+// Set sets the password for the user, immediately invalidating any previous password.
+func (c *RotatingCreds) Set(username, password string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(username, rotatingCred{password: password})
+}
+
+// Rotate sets a new password for the user, with the current password remaining valid
+// for the grace period.  If the user does not exist then it is added.
+func (c *RotatingCreds) Rotate(username, password string, grace time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rc, ok := c.m[username]
+	if !ok {
+		c.set(username, rotatingCred{password: password})
+		return
+	}
+	c.set(username, rotatingCred{
+		password: password,
+		previous: rc.password,
+		expires:  time.Now().Add(grace),
+	})
+}
+
+// Delete removes the user.
+func (c *RotatingCreds) Delete(username string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.m, username)
+}
+
+// Check implements Checker.  As with Creds, the comparisons are made even for unknown
+// usernames so that response timing does not reveal which usernames are valid.
+func (c *RotatingCreds) Check(username, password string) bool {
+	c.mu.RLock()
+	rc, ok := c.m[username]
+	unknown := c.unknown
+	c.mu.RUnlock()
+
+	match := equalPasswords
+	if c.hashed {
+		match = checkPasswordHash
+		if !ok {
+			rc.password = unknown
+		}
+	}
+	current := match(rc.password, password)
+	previous := time.Now().Before(rc.expires) && match(rc.previous, password)
+	return (current || previous) && ok
+}
+
+// Expiring creates a Checker which wraps c, failing Check for any user whose expiry time
+// (from the map of username-expiry pairs) has passed, e.g. for contractor or temporary
+// accounts.  Users without an entry never expire.  If onExpired is non-nil it is called
+// with the username whenever credentials which c accepts are rejected because they have
+// expired.
+func Expiring(c Checker, expiry map[string]time.Time, onExpired func(username string)) Checker {
+	return expiring{
+		Checker:   c,
+		expiry:    expiry,
+		onExpired: onExpired,
+	}
+}
+
+type expiring struct {
+	Checker
+	expiry    map[string]time.Time
+	onExpired func(username string)
+}
+
+// Check implements Checker.
+func (e expiring) Check(username, password string) bool {
+	if !e.Checker.Check(username, password) {
+		return false
+	}
+	if exp, ok := e.expiry[username]; ok && !time.Now().Before(exp) {
+		if e.onExpired != nil {
+			e.onExpired(username)
+		}
+		return false
+	}
+	return true
+}
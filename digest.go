@@ -0,0 +1,129 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DigestSigner is a ChallengeSigner which adds Digest access authentication (RFC 7616)
+// headers to Requests.  The first request is sent without credentials; when it is
+// challenged the response is computed (using SHA-256 or MD5, and qop=auth where offered)
+// and the request retried by Client or Do.  The server nonce is then reused for later
+// requests, with an increasing nonce count, until the server sends a new challenge.
+//
+// A DigestSigner must not be copied after first use, and is safe for concurrent use.
+type DigestSigner struct {
+	User, Pass string
+
+	mu        sync.Mutex
+	challenge map[string]string
+	nc        uint32
+}
+
+// digestAlgorithms are the supported Digest algorithms, in order of preference.
+var digestAlgorithms = []string{"SHA-256", "SHA-256-SESS", "MD5", "MD5-SESS"}
+
+// Challenge implements ChallengeSigner.  It returns false if resp has no supported
+// Digest challenge, or if the challenge is for the nonce already in use (and not marked
+// stale), meaning the credentials were rejected.
+func (d *DigestSigner) Challenge(resp *http.Response) bool {
+	var best map[string]string
+	rank := len(digestAlgorithms)
+	for _, c := range ParseChallenges(resp.Header, "WWW-Authenticate") {
+		if c.Scheme != "digest" {
+			continue
+		}
+		p := c.Params
+		if p["nonce"] == "" || (p["qop"] != "" && !containsString(digestQops(p["qop"]), "auth")) {
+			continue
+		}
+		if p["algorithm"] == "" {
+			p["algorithm"] = "MD5"
+		}
+		for i, a := range digestAlgorithms {
+			if strings.EqualFold(a, p["algorithm"]) && i < rank {
+				best, rank = p, i
+			}
+		}
+	}
+	if best == nil {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.challenge != nil && d.challenge["nonce"] == best["nonce"] && !strings.EqualFold(best["stale"], "true") {
+		return false
+	}
+	d.challenge, d.nc = best, 0
+	return true
+}
+
+// digestQops returns the quality of protection values in the comma-separated list s.
+func digestQops(s string) []string {
+	qops := strings.Split(s, ",")
+	for i, q := range qops {
+		qops[i] = strings.ToLower(strings.TrimSpace(q))
+	}
+	return qops
+}
+
+// Sign implements Signer.  Requests are left unsigned until a challenge has been
+// received.
+func (d *DigestSigner) Sign(r *http.Request) error {
+	d.mu.Lock()
+	c := d.challenge
+	d.nc++
+	nc := d.nc
+	d.mu.Unlock()
+	if c == nil {
+		return nil
+	}
+
+	cnonce, err := randomString(16)
+	if err != nil {
+		return err
+	}
+	alg := strings.ToUpper(c["algorithm"])
+	var h func() hash.Hash = md5.New
+	if strings.HasPrefix(alg, "SHA-256") {
+		h = sha256.New
+	}
+	sum := func(parts ...string) string {
+		hh := h()
+		hh.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	uri := r.URL.RequestURI()
+	ha1 := sum(d.User, c["realm"], d.Pass)
+	if strings.HasSuffix(alg, "-SESS") {
+		ha1 = sum(ha1, c["nonce"], cnonce)
+	}
+	ha2 := sum(r.Method, uri)
+
+	auth := "Digest username=" + quote(d.User) + ", realm=" + quote(c["realm"]) +
+		", nonce=" + quote(c["nonce"]) + ", uri=" + quote(uri) + ", algorithm=" + c["algorithm"]
+	if c["qop"] != "" {
+		ncs := fmt.Sprintf("%08x", nc)
+		auth += ", response=" + quote(sum(ha1, c["nonce"], ncs, cnonce, "auth", ha2)) +
+			", qop=auth, nc=" + ncs + ", cnonce=" + quote(cnonce)
+	} else {
+		auth += ", response=" + quote(sum(ha1, c["nonce"], ha2))
+	}
+	if opaque, ok := c["opaque"]; ok {
+		auth += ", opaque=" + quote(opaque)
+	}
+	r.Header.Set("Authorization", auth)
+	return nil
+}
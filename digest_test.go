@@ -0,0 +1,202 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth_test
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	. "github.com/dhowden/httpauth"
+)
+
+// digestServer is a minimal Digest authentication server for testing DigestSigner.
+type digestServer struct {
+	algorithms []string
+	nonce      string
+	nc         string
+	challenges int
+}
+
+func (s *digestServer) challenge(w http.ResponseWriter, stale bool) {
+	s.challenges++
+	s.nonce = fmt.Sprintf("nonce%d", s.challenges)
+	s.nc = ""
+	for _, alg := range s.algorithms {
+		c := fmt.Sprintf(`Digest realm="test", qop="auth,auth-int", nonce=%q, opaque="op", algorithm=%s`, s.nonce, alg)
+		if stale {
+			c += ", stale=true"
+		}
+		w.Header().Add("WWW-Authenticate", c)
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func (s *digestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Digest ") {
+		s.challenge(w, false)
+		return
+	}
+	p := map[string]string{}
+	for _, kv := range strings.Split(auth[len("Digest "):], ", ") {
+		k, v, _ := strings.Cut(kv, "=")
+		p[k] = strings.Trim(v, `"`)
+	}
+
+	if p["nonce"] != s.nonce || p["nc"] <= s.nc {
+		s.challenge(w, true)
+		return
+	}
+	s.nc = p["nc"]
+
+	var h func() hash.Hash = md5.New
+	if p["algorithm"] == "SHA-256" {
+		h = sha256.New
+	}
+	sum := func(parts ...string) string {
+		hh := h()
+		hh.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+	ha1 := sum(p["username"], "test", "Circle of Life")
+	ha2 := sum(r.Method, p["uri"])
+	expected := sum(ha1, p["nonce"], p["nc"], p["cnonce"], "auth", ha2)
+	if p["response"] != expected || p["opaque"] != "op" || p["qop"] != "auth" || p["uri"] != r.URL.RequestURI() {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="test", qop="auth", nonce=%q, algorithm=MD5`, s.nonce))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("X-Algorithm", p["algorithm"])
+	handlerFuncOK(w, r)
+}
+
+func TestDigestSigner(t *testing.T) {
+	ds := &digestServer{algorithms: []string{"MD5", "SHA-256"}}
+	s := httptest.NewServer(ds)
+	defer s.Close()
+
+	d := &DigestSigner{User: "Mufasa", Pass: "Circle of Life"}
+	c := NewClient(s.Client(), d)
+	for ii := 0; ii < 3; ii++ {
+		resp, err := c.Post(s.URL+"/dir/index.html?x=1", "text/plain", strings.NewReader("body"))
+		if err != nil {
+			t.Fatalf("[%d] c.Post() returned unexpected error: %v", ii, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("[%d] resp.StatusCode = %d, expected: %d", ii, resp.StatusCode, http.StatusOK)
+		}
+		if alg := resp.Header.Get("X-Algorithm"); alg != "SHA-256" {
+			t.Errorf("[%d] algorithm = %q, expected: %q", ii, alg, "SHA-256")
+		}
+	}
+	if ds.challenges != 1 {
+		t.Errorf("server sent %d challenges, expected 1", ds.challenges)
+	}
+
+	// Stale nonce
+	ds.nonce = "expired"
+	resp, err := c.Get(s.URL + "/")
+	if err != nil {
+		t.Fatalf("c.Get() returned unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("stale: resp.StatusCode = %d, expected: %d", resp.StatusCode, http.StatusOK)
+	}
+
+	// Wrong password
+	c = NewClient(s.Client(), &DigestSigner{User: "Mufasa", Pass: "wrong"})
+	resp, err = c.Get(s.URL + "/")
+	if err != nil {
+		t.Fatalf("c.Get() returned unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong password: resp.StatusCode = %d, expected: %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	// MD5 only
+	ds.algorithms = []string{"MD5"}
+	c = NewClient(s.Client(), &DigestSigner{User: "Mufasa", Pass: "Circle of Life"})
+	resp, err = c.Get(s.URL + "/")
+	if err != nil {
+		t.Fatalf("c.Get() returned unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Algorithm") != "MD5" {
+		t.Errorf("MD5: resp.StatusCode = %d, algorithm = %q", resp.StatusCode, resp.Header.Get("X-Algorithm"))
+	}
+}
+
+func TestProxyAuthSigner(t *testing.T) {
+	ds := &digestServer{algorithms: []string{"SHA-256"}}
+	proxies := []http.Handler{
+		NewHandler(Creds(map[string]string{"Mufasa": "Circle of Life"}), http.HandlerFunc(handlerFuncOK), Proxy()),
+		// Translate the Digest server into a proxy.
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set("Authorization", r.Header.Get("Proxy-Authorization"))
+			rw := httptest.NewRecorder()
+			ds.ServeHTTP(rw, r)
+			if rw.Code == http.StatusUnauthorized {
+				w.Header()["Proxy-Authenticate"] = rw.Header()["Www-Authenticate"]
+				w.WriteHeader(http.StatusProxyAuthRequired)
+				return
+			}
+			w.WriteHeader(rw.Code)
+		}),
+	}
+	signers := []Signer{
+		BasicAuthSigner{User: "Mufasa", Pass: "Circle of Life"},
+		&DigestSigner{User: "Mufasa", Pass: "Circle of Life"},
+	}
+
+	for ii, p := range proxies {
+		s := httptest.NewServer(p)
+		defer s.Close()
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			t.Fatalf("unexpected error parsing URL: %v", err)
+		}
+		client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(u)}}
+
+		for jj, signer := range []Signer{BearerTokenSigner{Token: "x"}, ProxyAuthSigner(signers[ii])} {
+			expected := http.StatusProxyAuthRequired
+			if jj == 1 {
+				expected = http.StatusOK
+			}
+			resp, err := NewClient(client, signer).Get("http://example.com/dir/index.html")
+			if err != nil {
+				t.Fatalf("[%d, %d] Get() returned unexpected error: %v", ii, jj, err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != expected {
+				t.Errorf("[%d, %d] resp.StatusCode = %d, expected: %d", ii, jj, resp.StatusCode, expected)
+			}
+		}
+	}
+
+	// https requests are tunnelled, so only the CONNECT request carries credentials.
+	r, err := http.NewRequest("GET", "https://example.com/", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	if err := ProxyAuthSigner(signers[0]).Sign(r); err != nil || r.Header.Get("Proxy-Authorization") != "" {
+		t.Errorf("https: Sign() = %v with Proxy-Authorization %q, expected unsigned", err, r.Header.Get("Proxy-Authorization"))
+	}
+	h, err := ProxyConnectHeader(signers[0])(context.Background(), nil, "example.com:443")
+	if expected := "Basic TXVmYXNhOkNpcmNsZSBvZiBMaWZl"; err != nil || h.Get("Proxy-Authorization") != expected {
+		t.Errorf("ProxyConnectHeader() = %v, %v, expected Proxy-Authorization %q", h, err, expected)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Errors returned when verifying DPoP proofs.
+var (
+	ErrDPoPProof   = errors.New("httpauth: invalid DPoP proof")
+	ErrDPoPReplay  = errors.New("httpauth: DPoP proof has already been used")
+	ErrDPoPBinding = errors.New("httpauth: token is not bound to the DPoP proof key")
+)
+
+// DefaultDPoPMaxAge is the default maximum age of a DPoP proof.
+const DefaultDPoPMaxAge = 5 * time.Minute
+
+// DPoP verifies sender-constrained access tokens (RFC 9449): requests must use the DPoP
+// authorization scheme and carry a DPoP proof signed (ES256 or RS256) by the key the
+// access token is bound to, via the token's cnf.jkt claim.
+type DPoP struct {
+	// Tokens validates the access tokens.
+	Tokens TokenChecker
+
+	// Nonces records the jti of each proof, so that proofs cannot be replayed.  Must
+	// be set.
+	Nonces NonceStore
+
+	// MaxAge is the maximum age of a proof (and also the allowance for clock skew).
+	// Defaults to DefaultDPoPMaxAge.
+	MaxAge time.Duration
+
+	// BaseURL, if non-empty, is the scheme and host (e.g. "https://api.example.com")
+	// which proofs must be made for, for use behind proxies.  By default it is derived
+	// from the request.
+	BaseURL string
+}
+
+func (d *DPoP) maxAge() time.Duration {
+	if d.MaxAge == 0 {
+		return DefaultDPoPMaxAge
+	}
+	return d.MaxAge
+}
+
+// DPoPScheme creates a Scheme which authenticates requests using DPoP-bound access
+// tokens, adding the token claims to the request context (see ClaimsFromContext).
+func DPoPScheme(d *DPoP) Scheme {
+	return dpopScheme{d}
+}
+
+// NewDPoPHandler returns an http.Handler which passes requests with a valid DPoP-bound
+// access token and proof to the given http.Handler (responds with
+// http.StatusUnauthorized otherwise).
+func NewDPoPHandler(d *DPoP, h http.Handler) http.Handler {
+	return NewMultiHandler(h, DPoPScheme(d))
+}
+
+type dpopScheme struct {
+	d *DPoP
+}
+
+// Authenticate implements Scheme.
+func (s dpopScheme) Authenticate(r *http.Request) (*http.Request, bool) {
+	rr, err := s.authenticate(r)
+	return rr, err == nil
+}
+
+// Challenge implements Scheme.
+func (s dpopScheme) Challenge() string { return `DPoP algs="ES256 RS256"` }
+
+// challenge implements detailedScheme.
+func (s dpopScheme) challenge(err error) string {
+	switch err {
+	case ErrNoCredentials:
+		return s.Challenge()
+	case ErrDPoPProof, ErrDPoPReplay:
+		return `DPoP algs="ES256 RS256", error="invalid_dpop_proof", error_description=` + quote(tokenErrorDescription(err))
+	}
+	return `DPoP algs="ES256 RS256", error="invalid_token", error_description=` + quote(tokenErrorDescription(err))
+}
+
+// authenticate implements detailedScheme.
+func (s dpopScheme) authenticate(r *http.Request) (*http.Request, error) {
+	scheme, token := splitScheme(r.Header.Get("Authorization"))
+	if scheme != "dpop" || token == "" {
+		return r, ErrNoCredentials
+	}
+	proofs := r.Header.Values("DPoP")
+	if len(proofs) != 1 {
+		return r, ErrDPoPProof
+	}
+	jkt, err := s.d.verifyProof(proofs[0], r, token)
+	if err != nil {
+		return r, err
+	}
+
+	claims, err := s.d.Tokens.CheckToken(token)
+	if err != nil {
+		return r, err
+	}
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	if bound, _ := cnf["jkt"].(string); bound == "" || bound != jkt {
+		return r, ErrDPoPBinding
+	}
+	return r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)), nil
+}
+
+// verifyProof verifies the DPoP proof for r and the access token, returning the JWK
+// thumbprint of the proof key.
+func (d *DPoP) verifyProof(proof string, r *http.Request, token string) (string, error) {
+	parts := strings.Split(proof, ".")
+	if len(parts) != 3 {
+		return "", ErrDPoPProof
+	}
+	var hdr struct {
+		Typ string     `json:"typ"`
+		Alg string     `json:"alg"`
+		JWK jsonWebKey `json:"jwk"`
+	}
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return "", ErrDPoPProof
+	}
+	if hdr.Typ != "dpop+jwt" || (hdr.Alg != "ES256" && hdr.Alg != "RS256") {
+		return "", ErrDPoPProof
+	}
+	key, err := hdr.JWK.publicKey()
+	if err != nil || !keyMatchesAlg(key, hdr.Alg) {
+		return "", ErrDPoPProof
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrDPoPProof
+	}
+	if err := verifySignature(hdr.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return "", ErrDPoPProof
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", ErrDPoPProof
+	}
+	jti, _ := claims["jti"].(string)
+	htm, _ := claims["htm"].(string)
+	htu, _ := claims["htu"].(string)
+	ath, _ := claims["ath"].(string)
+	iat, ok := claims.time("iat")
+	if jti == "" || htm != r.Method || !d.matchesURL(htu, r) || !ok {
+		return "", ErrDPoPProof
+	}
+	now := time.Now()
+	if iat.Before(now.Add(-d.maxAge())) || iat.After(now.Add(d.maxAge())) {
+		return "", ErrDPoPProof
+	}
+	h := sha256.Sum256([]byte(token))
+	if ath != base64.RawURLEncoding.EncodeToString(h[:]) {
+		return "", ErrDPoPProof
+	}
+	if d.Nonces.Seen(jti, iat.Add(2*d.maxAge())) {
+		return "", ErrDPoPReplay
+	}
+	return jwkThumbprint(key), nil
+}
+
+// matchesURL returns true if the htu claim of a proof matches the URL of r, ignoring
+// any query or fragment.
+func (d *DPoP) matchesURL(htu string, r *http.Request) bool {
+	if i := strings.IndexAny(htu, "?#"); i >= 0 {
+		htu = htu[:i]
+	}
+	base := strings.TrimSuffix(d.BaseURL, "/")
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	// The scheme and host are case-insensitive, the path is not.
+	return len(htu) >= len(base) && strings.EqualFold(htu[:len(base)], base) && htu[len(base):] == r.URL.EscapedPath()
+}
+
+// jwkThumbprint returns the base64url-encoded SHA-256 JWK thumbprint (RFC 7638) of key.
+func jwkThumbprint(key interface{}) string {
+	var b []byte
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		b, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{"P-256", "EC", base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, 32))), base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, 32)))})
+	case *rsa.PublicKey:
+		b, _ = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()), "RSA", base64.RawURLEncoding.EncodeToString(k.N.Bytes())})
+	}
+	h := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
@@ -0,0 +1,119 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/dhowden/httpauth"
+)
+
+func signES256(t *testing.T, key *ecdsa.PrivateKey, hdr, claims map[string]interface{}) string {
+	signed := encodeSegment(t, hdr) + "." + encodeSegment(t, claims)
+	h := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, h[:])
+	if err != nil {
+		t.Fatalf("unexpected error signing token: %v", err)
+	}
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestDPoP(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwk := map[string]interface{}{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   b64(key.X.FillBytes(make([]byte, 32))),
+		"y":   b64(key.Y.FillBytes(make([]byte, 32))),
+	}
+	thumb := sha256.Sum256([]byte(`{"crv":"P-256","kty":"EC","x":"` + jwk["x"].(string) + `","y":"` + jwk["y"].(string) + `"}`))
+
+	secret := []byte("secret")
+	hs := map[string]interface{}{"alg": "HS256"}
+	token := signHS256(t, secret, hs, map[string]interface{}{"sub": "alice", "cnf": map[string]string{"jkt": b64(thumb[:])}})
+	unbound := signHS256(t, secret, hs, map[string]interface{}{"sub": "alice", "cnf": map[string]string{"jkt": "other"}})
+
+	proof := func(method, url, token string) string {
+		ath := sha256.Sum256([]byte(token))
+		jti := make([]byte, 8)
+		rand.Read(jti)
+		return signES256(t, key, map[string]interface{}{"typ": "dpop+jwt", "alg": "ES256", "jwk": jwk}, map[string]interface{}{
+			"jti": b64(jti),
+			"htm": method,
+			"htu": url,
+			"iat": time.Now().Unix(),
+			"ath": b64(ath[:]),
+		})
+	}
+
+	h := NewDPoPHandler(&DPoP{Tokens: &JWT{Keys: HMACKey(secret)}, Nonces: NewMemoryNonceStore()}, http.HandlerFunc(handlerFuncOK))
+
+	replayed := proof("GET", "http://example.com/items", token)
+	tests := []struct {
+		scheme, token, proof string
+		code                 int
+		challenge            string
+	}{
+		{"DPoP", token, replayed, http.StatusOK, ""},
+		{"DPoP", token, replayed, http.StatusUnauthorized, "invalid_dpop_proof"},
+		{"DPoP", token, proof("POST", "http://example.com/items", token), http.StatusUnauthorized, "invalid_dpop_proof"},
+		{"DPoP", token, proof("GET", "http://example.com/other", token), http.StatusUnauthorized, "invalid_dpop_proof"},
+		{"DPoP", token, proof("GET", "http://example.com/items", unbound), http.StatusUnauthorized, "invalid_dpop_proof"},
+		{"DPoP", unbound, proof("GET", "http://example.com/items", unbound), http.StatusUnauthorized, "invalid_token"},
+		{"DPoP", token, "", http.StatusUnauthorized, "invalid_dpop_proof"},
+		{"Bearer", token, proof("GET", "http://example.com/items", token), http.StatusUnauthorized, ""},
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest("GET", "http://example.com/items?x=1", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.Header.Set("Authorization", tt.scheme+" "+tt.token)
+		if tt.proof != "" {
+			r.Header.Set("DPoP", tt.proof)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("[%d] w.Code = %d, expected: %d", ii, w.Code, tt.code)
+		}
+		if got := w.Header().Get("WWW-Authenticate"); tt.code != http.StatusOK && !strings.Contains(got, tt.challenge) {
+			t.Errorf("[%d] WWW-Authenticate = %s, expected error %q", ii, got, tt.challenge)
+		}
+	}
+
+	// DPoP-bound tokens are not accepted as bearer tokens.
+	bh := NewBearerHandler(&JWT{Keys: HMACKey(secret)}, http.HandlerFunc(handlerFuncOK))
+	for ii, tt := range []struct {
+		token string
+		code  int
+	}{
+		{token, http.StatusUnauthorized},
+		{signHS256(t, secret, hs, map[string]interface{}{"sub": "alice"}), http.StatusOK},
+	} {
+		r, _ := http.NewRequest("GET", "http://example.com/items", nil)
+		r.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+		bh.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("[%d] bearer: w.Code = %d, expected: %d", ii, w.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import "net/http"
+
+// ForwardedUserHeader is the response header used to pass the authenticated username to
+// a reverse proxy or upstream service.
+const ForwardedUserHeader = "X-Forwarded-User"
+
+// NewForwardAuthHandler returns an http.Handler implementing the forward authentication
+// contract used by reverse proxies (e.g. Traefik forwardAuth and nginx auth_request):
+// requests authenticated using the Checker and Options receive an empty
+// http.StatusOK response with the username in the X-Forwarded-User header, all others
+// receive the usual failure response (see NewHandler).
+func NewForwardAuthHandler(c Checker, opts ...Option) http.Handler {
+	return NewHandler(c, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, ok := UserFromContext(r.Context()); ok {
+			w.Header().Set(ForwardedUserHeader, u)
+		}
+		w.WriteHeader(http.StatusOK)
+	}), opts...)
+}
@@ -0,0 +1,183 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package grpcbridge adapts package httpauth Signers and handlers for use with gRPC, so
+// that services which serve both HTTP and gRPC can share one authentication
+// configuration.  It is a separate package so that httpauth itself does not depend on
+// google.golang.org/grpc.
+package grpcbridge
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/dhowden/httpauth"
+)
+
+// PerRPCCredentials implements credentials.PerRPCCredentials using an httpauth.Signer:
+// the headers added by the Signer are sent as request metadata.  Each call is signed
+// as a POST request to the service URI with no body, so only Signers whose headers do
+// not depend on the request path or body (e.g. BasicAuthSigner, BearerTokenSigner,
+// APIKeySigner or TokenSourceSigner) are suitable.
+type PerRPCCredentials struct {
+	Signer httpauth.Signer
+
+	// Insecure allows credentials to be sent over connections without transport
+	// security.
+	Insecure bool
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials.
+func (c PerRPCCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	var u string
+	if len(uri) > 0 {
+		u = uri[0]
+	}
+	r, err := http.NewRequestWithContext(ctx, "POST", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cs, ok := c.Signer.(httpauth.ContextSigner); ok {
+		err = cs.SignContext(ctx, r)
+	} else {
+		err = c.Signer.Sign(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	md := make(map[string]string, len(r.Header))
+	for k, v := range r.Header {
+		md[strings.ToLower(k)] = strings.Join(v, ", ")
+	}
+	return md, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials.
+func (c PerRPCCredentials) RequireTransportSecurity() bool {
+	return !c.Insecure
+}
+
+// UnaryServerInterceptor returns a gRPC unary interceptor which authenticates calls
+// with basic authentication credentials (sent in the authorization metadata, e.g. by
+// PerRPCCredentials with a BasicAuthSigner) using the Checker and Options, as for
+// httpauth.NewHandler.
+func UnaryServerInterceptor(c httpauth.Checker, opts ...httpauth.Option) grpc.UnaryServerInterceptor {
+	return UnaryMiddlewareInterceptor(httpauth.Middleware(c, opts...))
+}
+
+// StreamServerInterceptor is like UnaryServerInterceptor, for streaming calls.
+func StreamServerInterceptor(c httpauth.Checker, opts ...httpauth.Option) grpc.StreamServerInterceptor {
+	return StreamMiddlewareInterceptor(httpauth.Middleware(c, opts...))
+}
+
+// UnaryMiddlewareInterceptor returns a gRPC unary interceptor which authenticates calls
+// using HTTP middleware (e.g. from httpauth.Middleware, or wrapping NewBearerHandler).
+// Each call is presented to the middleware as a POST request for the full method name,
+// with the call metadata as headers.  Calls passed by the middleware are handled with
+// the context of the request it passes on (see httpauth.UserFromContext and
+// httpauth.ClaimsFromContext), others fail with codes.Unauthenticated (or
+// codes.PermissionDenied or codes.ResourceExhausted, for http.StatusForbidden and
+// http.StatusTooManyRequests responses).
+func UnaryMiddlewareInterceptor(mw func(http.Handler) http.Handler) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var resp interface{}
+		err := serve(ctx, info.FullMethod, mw, func(ctx context.Context) error {
+			var err error
+			resp, err = handler(ctx, req)
+			return err
+		})
+		return resp, err
+	}
+}
+
+// StreamMiddlewareInterceptor is like UnaryMiddlewareInterceptor, for streaming calls.
+func StreamMiddlewareInterceptor(mw func(http.Handler) http.Handler) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return serve(ss.Context(), info.FullMethod, mw, func(ctx context.Context) error {
+			return handler(srv, serverStream{ss, ctx})
+		})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context implements grpc.ServerStream.
+func (s serverStream) Context() context.Context { return s.ctx }
+
+// serve presents the call to the middleware as an HTTP request, calling f with the
+// context of the request passed on by the middleware.
+func serve(ctx context.Context, method string, mw func(http.Handler) http.Handler, f func(ctx context.Context) error) error {
+	r, err := http.NewRequestWithContext(ctx, "POST", method, nil)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, "invalid method")
+	}
+	r.Proto, r.ProtoMajor, r.ProtoMinor = "HTTP/2.0", 2, 0
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, v := range md {
+		if k == ":authority" {
+			r.Host = strings.Join(v, "")
+			continue
+		}
+		for _, vv := range v {
+			r.Header.Add(k, vv)
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		r.RemoteAddr = p.Addr.String()
+	}
+
+	called := false
+	w := &responseWriter{header: make(http.Header)}
+	mw(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		called = true
+		err = f(r.Context())
+	})).ServeHTTP(w, r)
+	if called {
+		return err
+	}
+
+	switch w.status {
+	case http.StatusForbidden:
+		return status.Error(codes.PermissionDenied, "permission denied")
+	case http.StatusTooManyRequests:
+		return status.Error(codes.ResourceExhausted, "too many requests")
+	}
+	return status.Error(codes.Unauthenticated, "unauthenticated")
+}
+
+// responseWriter is an http.ResponseWriter which records the status of responses
+// written by middleware which rejects a call.
+type responseWriter struct {
+	header http.Header
+	status int
+}
+
+// Header implements http.ResponseWriter.
+func (w *responseWriter) Header() http.Header { return w.header }
+
+// Write implements http.ResponseWriter.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
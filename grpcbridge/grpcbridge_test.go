@@ -0,0 +1,93 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package grpcbridge_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/dhowden/httpauth"
+	. "github.com/dhowden/httpauth/grpcbridge"
+)
+
+func TestPerRPCCredentials(t *testing.T) {
+	c := PerRPCCredentials{Signer: httpauth.BasicAuthSigner{User: "alice", Pass: "secret"}}
+	md, err := c.GetRequestMetadata(context.Background(), "https://example.com/pkg.Service")
+	if err != nil {
+		t.Fatalf("GetRequestMetadata() returned unexpected error: %v", err)
+	}
+	if got, expected := md["authorization"], "Basic YWxpY2U6c2VjcmV0"; got != expected {
+		t.Errorf("md[%q] = %q, expected: %q", "authorization", got, expected)
+	}
+	if !c.RequireTransportSecurity() {
+		t.Errorf("RequireTransportSecurity() = false, expected true")
+	}
+}
+
+type stream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s stream) Context() context.Context { return s.ctx }
+
+func TestServerInterceptors(t *testing.T) {
+	creds := httpauth.Creds(map[string]string{"alice": "secret"})
+	unary := UnaryServerInterceptor(creds)
+	streaming := StreamServerInterceptor(creds)
+	info := &grpc.UnaryServerInfo{FullMethod: "/pkg.Service/Method"}
+
+	tests := []struct {
+		name string
+		s    httpauth.Signer
+		code codes.Code
+	}{
+		{"valid", httpauth.BasicAuthSigner{User: "alice", Pass: "secret"}, codes.OK},
+		{"invalid", httpauth.BasicAuthSigner{User: "alice", Pass: "wrong"}, codes.Unauthenticated},
+		{"none", httpauth.SignerFunc(func(*http.Request) error { return nil }), codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		md, err := PerRPCCredentials{Signer: tt.s}.GetRequestMetadata(context.Background(), "https://example.com/pkg.Service")
+		if err != nil {
+			t.Fatalf("%s: GetRequestMetadata() returned unexpected error: %v", tt.name, err)
+		}
+		var pairs []string
+		for k, v := range md {
+			pairs = append(pairs, k, v)
+		}
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+
+		var user string
+		_, err = unary(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			user, _ = httpauth.UserFromContext(ctx)
+			return nil, nil
+		})
+		if code := status.Code(err); code != tt.code {
+			t.Errorf("%s: unary code = %v, expected: %v", tt.name, code, tt.code)
+		}
+		if tt.code == codes.OK && user != "alice" {
+			t.Errorf("%s: unary user = %q, expected: %q", tt.name, user, "alice")
+		}
+
+		user = ""
+		err = streaming(nil, stream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: info.FullMethod}, func(srv interface{}, ss grpc.ServerStream) error {
+			user, _ = httpauth.UserFromContext(ss.Context())
+			return nil
+		})
+		if code := status.Code(err); code != tt.code {
+			t.Errorf("%s: stream code = %v, expected: %v", tt.name, code, tt.code)
+		}
+		if tt.code == codes.OK && user != "alice" {
+			t.Errorf("%s: stream user = %q, expected: %q", tt.name, user, "alice")
+		}
+	}
+}
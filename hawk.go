@@ -0,0 +1,261 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HawkSigner is a ChallengeSigner which signs requests using the Hawk scheme with
+// HMAC-SHA256 credentials, for services which still use Hawk (and for verification by
+// HawkVerifier).  Requests with a body also carry a payload hash.  If the server
+// rejects a request with a (valid) stale timestamp challenge, the signer adjusts for
+// its clock offset and the request is retried (by Client or Do).
+//
+// A HawkSigner must not be copied after first use, and is safe for concurrent use.
+type HawkSigner struct {
+	ID  string
+	Key []byte
+
+	// Ext is optional application-specific data sent with (and covered by) the MAC.
+	Ext string
+
+	mu     sync.Mutex
+	offset time.Duration // server time - local time, from stale timestamp challenges
+}
+
+// Sign implements Signer.
+func (s *HawkSigner) Sign(r *http.Request) error {
+	var hash string
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := bodyCopy(r)
+		if err != nil {
+			return err
+		}
+		hash, err = hawkPayloadHash(r.Header.Get("Content-Type"), body)
+		body.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	nonce, err := randomString(8)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	ts := strconv.FormatInt(time.Now().Add(s.offset).Unix(), 10)
+	s.mu.Unlock()
+
+	auth := "Hawk id=" + quote(s.ID) + ", ts=" + quote(ts) + ", nonce=" + quote(nonce)
+	if hash != "" {
+		auth += ", hash=" + quote(hash)
+	}
+	if s.Ext != "" {
+		auth += ", ext=" + quote(s.Ext)
+	}
+	mac := hawkMAC(s.Key, ts, nonce, r, hash, s.Ext)
+	r.Header.Set("Authorization", auth+", mac="+quote(mac))
+	return nil
+}
+
+// Challenge implements ChallengeSigner.  It returns true if resp has a stale timestamp
+// challenge with a valid timestamp MAC, after updating the signer's clock offset.
+func (s *HawkSigner) Challenge(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	for _, c := range ParseChallenges(resp.Header, "WWW-Authenticate") {
+		if c.Scheme != "hawk" || c.Params["ts"] == "" {
+			continue
+		}
+		ts, err := strconv.ParseInt(c.Params["ts"], 10, 64)
+		if err != nil || !hmac.Equal([]byte(hawkTimestampMAC(s.Key, c.Params["ts"])), []byte(c.Params["tsm"])) {
+			return false
+		}
+		s.mu.Lock()
+		s.offset = time.Until(time.Unix(ts, 0))
+		s.mu.Unlock()
+		return true
+	}
+	return false
+}
+
+// HawkVerifier verifies requests signed using the Hawk scheme (e.g. by HawkSigner).
+// Payload hashes are checked when present.
+type HawkVerifier struct {
+	// Credentials provides the HMAC-SHA256 keys by Hawk ID.
+	Credentials SecretSource
+
+	// MaxSkew is the maximum difference between the request timestamp and the
+	// current time.  Defaults to 1 minute.
+	MaxSkew time.Duration
+
+	// Nonces records nonces to reject replayed requests.  Defaults to an in-memory
+	// store (see NewMemoryNonceStore).
+	Nonces NonceStore
+
+	// MaxBody is the maximum size of request body which will be read to verify the
+	// payload hash.  Defaults to 10MB.
+	MaxBody int64
+
+	// RequirePayloadHash rejects requests which do not carry a payload hash.
+	RequirePayloadHash bool
+}
+
+// NewHawkHandler returns an http.Handler which verifies Hawk request signatures using
+// the HawkVerifier and passes requests to the given http.Handler when the signature is
+// valid (responds with http.StatusUnauthorized otherwise, including a stale timestamp
+// challenge for correctly signed requests with an out of range timestamp).
+func NewHawkHandler(v *HawkVerifier, h http.Handler) http.Handler {
+	vv := *v
+	v = &vv
+	if v.MaxSkew == 0 {
+		v.MaxSkew = time.Minute
+	}
+	if v.Nonces == nil {
+		v.Nonces = NewMemoryNonceStore()
+	}
+	if v.MaxBody == 0 {
+		v.MaxBody = maxSignedBody
+	}
+	return &hawkHandler{
+		Handler: h,
+		v:       v,
+	}
+}
+
+type hawkHandler struct {
+	http.Handler
+	v *HawkVerifier
+}
+
+// ServeHTTP implements http.Handler.
+func (h *hawkHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if ok, challenge := h.v.verify(r); !ok {
+		unauthorized(w, r, challenge)
+		return
+	}
+	h.Handler.ServeHTTP(w, r)
+}
+
+// verify returns true if r carries a valid, fresh Hawk signature.  Otherwise it returns
+// false and the challenge to send with the response.  The request body is replaced so
+// that it can be read again.
+func (v *HawkVerifier) verify(r *http.Request) (bool, string) {
+	scheme, params := splitScheme(r.Header.Get("Authorization"))
+	if scheme != "hawk" {
+		return false, "Hawk"
+	}
+	p := parseParams(params)
+	key, ok := v.Credentials.Secret(p["id"])
+	if !ok || p["nonce"] == "" || p["app"] != "" {
+		return false, "Hawk"
+	}
+	ts, err := strconv.ParseInt(p["ts"], 10, 64)
+	if err != nil {
+		return false, "Hawk"
+	}
+
+	mac := hawkMAC(key, p["ts"], p["nonce"], r, p["hash"], p["ext"])
+	if !hmac.Equal([]byte(mac), []byte(p["mac"])) {
+		return false, "Hawk"
+	}
+
+	if p["hash"] != "" {
+		body, ok := readBody(r, v.MaxBody)
+		if !ok {
+			return false, "Hawk"
+		}
+		hash, _ := hawkPayloadHash(r.Header.Get("Content-Type"), bytes.NewReader(body))
+		if !hmac.Equal([]byte(hash), []byte(p["hash"])) {
+			return false, "Hawk"
+		}
+	} else if v.RequirePayloadHash {
+		return false, "Hawk"
+	}
+
+	t := time.Unix(ts, 0)
+	if skew := time.Since(t); skew > v.MaxSkew || skew < -v.MaxSkew {
+		now := strconv.FormatInt(time.Now().Unix(), 10)
+		return false, "Hawk ts=" + quote(now) +
+			", tsm=" + quote(hawkTimestampMAC(key, now)) +
+			", error=" + quote("Stale timestamp")
+	}
+	if v.Nonces.Seen(p["id"]+":"+p["nonce"], t.Add(v.MaxSkew)) {
+		return false, "Hawk"
+	}
+	return true, ""
+}
+
+// hawkMAC returns the base64-encoded Hawk header MAC for the request.
+func hawkMAC(key []byte, ts, nonce string, r *http.Request, hash, ext string) string {
+	host, port := hawkHostPort(r)
+	ext = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(ext)
+	return hawkSum(key, "hawk.1.header\n"+
+		ts+"\n"+
+		nonce+"\n"+
+		strings.ToUpper(r.Method)+"\n"+
+		r.URL.RequestURI()+"\n"+
+		host+"\n"+
+		port+"\n"+
+		hash+"\n"+
+		ext+"\n")
+}
+
+// hawkTimestampMAC returns the base64-encoded MAC of the timestamp ts, as sent in stale
+// timestamp challenges.
+func hawkTimestampMAC(key []byte, ts string) string {
+	return hawkSum(key, "hawk.1.ts\n"+ts+"\n")
+}
+
+func hawkSum(key []byte, s string) string {
+	mac := hmac.New(sha256.New, key)
+	io.WriteString(mac, s)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// hawkPayloadHash returns the base64-encoded Hawk payload hash of the body with the
+// given content type.
+func hawkPayloadHash(contentType string, body io.Reader) (string, error) {
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mt
+	}
+	h := sha256.New()
+	io.WriteString(h, "hawk.1.payload\n"+strings.ToLower(contentType)+"\n")
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	io.WriteString(h, "\n")
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// hawkHostPort returns the (lower-case) host and port the request is sent to, using the
+// default port for the scheme if there is none.
+func hawkHostPort(r *http.Request) (string, string) {
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	h, port, err := net.SplitHostPort(host)
+	if err != nil {
+		h, port = strings.Trim(host, "[]"), "80"
+		if r.URL.Scheme == "https" || r.TLS != nil {
+			port = "443"
+		}
+	}
+	return strings.ToLower(h), port
+}
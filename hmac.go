@@ -0,0 +1,247 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hmacScheme is the Authorization scheme used for HMAC request signatures.
+const hmacScheme = "HMAC-SHA256"
+
+// maxSignedBody is the default limit on the size of request bodies read to verify
+// signatures.
+const maxSignedBody = 10 << 20
+
+// SecretSource defines the Secret method which provides shared secrets by key ID.
+type SecretSource interface {
+	// Secret returns the secret for the key ID, and false if there is no such key.
+	Secret(id string) ([]byte, bool)
+}
+
+// Secrets creates a SecretSource which uses the map of key ID-secret pairs.
+func Secrets(m map[string][]byte) SecretSource {
+	return secrets{
+		m: m,
+	}
+}
+
+type secrets struct {
+	m map[string][]byte
+}
+
+// Secret implements SecretSource.
+func (s secrets) Secret(id string) ([]byte, bool) {
+	k, ok := s.m[id]
+	return k, ok
+}
+
+// HMACSigner is a Signer which signs the request method, path, a timestamp, a random
+// nonce and the SHA-256 digest of the body using HMAC-SHA256 with a shared secret,
+// for verification by HMACVerifier.  By default the signature is sent in the
+// Authorization header:
+//
+//	Authorization: HMAC-SHA256 id="<key ID>", ts="<unix time>", nonce="<nonce>", sig="<signature>"
+type HMACSigner struct {
+	KeyID  string
+	Secret []byte
+
+	// Header is the name of the header carrying the signature.  Defaults to
+	// "Authorization".
+	Header string
+
+	// Scheme is the scheme name which prefixes the signature parameters.  Defaults to
+	// "HMAC-SHA256".
+	Scheme string
+}
+
+// Sign implements Signer.
+func (s HMACSigner) Sign(r *http.Request) error {
+	digest, err := bodyDigest(r)
+	if err != nil {
+		return err
+	}
+	nonce, err := randomString(16)
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	sig := hmacSignature(s.Secret, r.Method, r.URL.RequestURI(), ts, nonce, digest)
+
+	r.Header.Set(hmacHeader(s.Header), hmacSchemeName(s.Scheme)+
+		" id="+quote(s.KeyID)+
+		", ts="+quote(ts)+
+		", nonce="+quote(nonce)+
+		", sig="+quote(sig))
+	return nil
+}
+
+// HMACVerifier verifies requests signed by HMACSigner.
+type HMACVerifier struct {
+	// Secrets provides the shared secrets by key ID.
+	Secrets SecretSource
+
+	// MaxSkew is the maximum difference between the request timestamp and the
+	// current time.  Defaults to 5 minutes.
+	MaxSkew time.Duration
+
+	// Nonces records nonces to reject replayed requests.  Defaults to an in-memory
+	// store (see NewMemoryNonceStore).
+	Nonces NonceStore
+
+	// MaxBody is the maximum size of request body which will be read to verify the
+	// signature.  Defaults to 10MB.
+	MaxBody int64
+
+	// Header and Scheme are the signature header name and scheme, as for HMACSigner.
+	// Default to "Authorization" and "HMAC-SHA256".
+	Header, Scheme string
+}
+
+// hmacHeader returns the name of the signature header, defaulting to Authorization.
+func hmacHeader(header string) string {
+	if header == "" {
+		return "Authorization"
+	}
+	return header
+}
+
+// hmacSchemeName returns the signature scheme, defaulting to hmacScheme.
+func hmacSchemeName(scheme string) string {
+	if scheme == "" {
+		return hmacScheme
+	}
+	return scheme
+}
+
+// NewHMACHandler returns an http.Handler which verifies HMAC request signatures using
+// the HMACVerifier and passes requests to the given http.Handler when the signature is
+// valid (responds with http.StatusUnauthorized otherwise).
+func NewHMACHandler(v *HMACVerifier, h http.Handler) http.Handler {
+	vv := *v
+	v = &vv
+	if v.MaxSkew == 0 {
+		v.MaxSkew = 5 * time.Minute
+	}
+	if v.Nonces == nil {
+		v.Nonces = NewMemoryNonceStore()
+	}
+	if v.MaxBody == 0 {
+		v.MaxBody = maxSignedBody
+	}
+	v.Header, v.Scheme = hmacHeader(v.Header), hmacSchemeName(v.Scheme)
+	return &hmacHandler{
+		Handler: h,
+		v:       v,
+	}
+}
+
+type hmacHandler struct {
+	http.Handler
+	v *HMACVerifier
+}
+
+// ServeHTTP implements http.Handler.
+func (h *hmacHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.v.verify(r) {
+		unauthorized(w, r, h.v.Scheme)
+		return
+	}
+	h.Handler.ServeHTTP(w, r)
+}
+
+// verify returns true if r carries a valid, fresh signature.  The request body is
+// replaced so that it can be read again.
+func (v *HMACVerifier) verify(r *http.Request) bool {
+	scheme, params := splitScheme(r.Header.Get(v.Header))
+	if scheme != strings.ToLower(v.Scheme) {
+		return false
+	}
+	p := parseParams(params)
+	secret, ok := v.Secrets.Secret(p["id"])
+	if !ok || p["nonce"] == "" {
+		return false
+	}
+
+	ts, err := strconv.ParseInt(p["ts"], 10, 64)
+	if err != nil {
+		return false
+	}
+	t := time.Unix(ts, 0)
+	if skew := time.Since(t); skew > v.MaxSkew || skew < -v.MaxSkew {
+		return false
+	}
+
+	body, ok := readBody(r, v.MaxBody)
+	if !ok {
+		return false
+	}
+	h := sha256.Sum256(body)
+	digest := hex.EncodeToString(h[:])
+
+	sig := hmacSignature(secret, r.Method, r.URL.RequestURI(), p["ts"], p["nonce"], digest)
+	if !hmac.Equal([]byte(sig), []byte(p["sig"])) {
+		return false
+	}
+	return !v.Nonces.Seen(p["id"]+":"+p["nonce"], t.Add(v.MaxSkew))
+}
+
+// hmacSignature returns the base64-encoded HMAC-SHA256 signature of the request
+// components.
+func hmacSignature(secret []byte, method, uri, ts, nonce, digest string) string {
+	mac := hmac.New(sha256.New, secret)
+	io.WriteString(mac, method+"\n"+uri+"\n"+ts+"\n"+nonce+"\n"+digest)
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// readBody reads the body of r (up to max bytes), replacing it so that it can be read
+// again.  It returns false if the body could not be read or was larger than max.
+func readBody(r *http.Request, max int64) ([]byte, bool) {
+	if r.Body == nil {
+		return nil, true
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, max+1))
+	r.Body.Close()
+	if err != nil || int64(len(body)) > max {
+		return nil, false
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
+// bodyDigest returns the hex-encoded SHA-256 digest of the request body, read from a
+// copy of the body (see bodyCopy) so that it can be sent, and retried, after signing.
+func bodyDigest(r *http.Request) (string, error) {
+	body, err := bodyCopy(r)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// randomString returns a hex-encoded string of n random bytes.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
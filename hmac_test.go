@@ -0,0 +1,286 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/dhowden/httpauth"
+)
+
+func TestHMAC(t *testing.T) {
+	secret := []byte("shhhh")
+	s := HMACSigner{KeyID: "alice", Secret: secret}
+
+	var body string
+	h := NewHMACHandler(&HMACVerifier{
+		Secrets: Secrets(map[string][]byte{"alice": secret}),
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		handlerFuncOK(w, r)
+	}))
+
+	r, err := http.NewRequest("POST", "/path?q=1", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	if err := s.Sign(r); err != nil {
+		t.Fatalf("s.Sign() returned unexpected error: %v", err)
+	}
+	auth := r.Header.Get("Authorization")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusOK)
+	}
+	if body != "hello" {
+		t.Errorf("body = %q, expected: %q", body, "hello")
+	}
+
+	// Replayed request
+	r, _ = http.NewRequest("POST", "/path?q=1", strings.NewReader("hello"))
+	r.Header.Set("Authorization", auth)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("replay: w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// Tampered body
+	r, _ = http.NewRequest("POST", "/path?q=1", strings.NewReader("hello"))
+	s.Sign(r)
+	r.Body = ioutil.NopCloser(strings.NewReader("goodbye"))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("tampered: w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// Unknown key
+	r, _ = http.NewRequest("GET", "/", nil)
+	HMACSigner{KeyID: "bob", Secret: secret}.Sign(r)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown key: w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHMACHeaderFormat(t *testing.T) {
+	secret := []byte("shhhh")
+	s := HMACSigner{KeyID: "alice", Secret: secret, Header: "X-Signature", Scheme: "ACME-HMAC"}
+	v := &HMACVerifier{Secrets: Secrets(map[string][]byte{"alice": secret}), Header: "X-Signature", Scheme: "ACME-HMAC"}
+	h := NewHMACHandler(v, http.HandlerFunc(handlerFuncOK))
+
+	r, err := http.NewRequest("POST", "/path", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	if err := s.Sign(r); err != nil {
+		t.Fatalf("s.Sign() returned unexpected error: %v", err)
+	}
+	if got := r.Header.Get("X-Signature"); !strings.HasPrefix(got, "ACME-HMAC id=") {
+		t.Errorf("X-Signature = %q, expected ACME-HMAC signature", got)
+	}
+	if r.Header.Get("Authorization") != "" {
+		t.Errorf("Authorization = %q, expected empty", r.Header.Get("Authorization"))
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusOK)
+	}
+
+	// Default format is not accepted.
+	r, _ = http.NewRequest("POST", "/path", strings.NewReader("hello"))
+	HMACSigner{KeyID: "alice", Secret: secret}.Sign(r)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); got != "ACME-HMAC" {
+		t.Errorf("WWW-Authenticate = %q, expected: %q", got, "ACME-HMAC")
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	secret := []byte("whsec")
+	sign := func(payload string) string {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(payload))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name   string
+		v      WebhookVerifier
+		header http.Header
+		body   string
+		code   int
+	}{
+		{"github", WebhookVerifier{Format: WebhookGitHub}, http.Header{"X-Hub-Signature-256": {"sha256=" + sign("hello")}}, "hello", http.StatusOK},
+		{"github tampered", WebhookVerifier{Format: WebhookGitHub}, http.Header{"X-Hub-Signature-256": {"sha256=" + sign("hello")}}, "goodbye", http.StatusUnauthorized},
+		{"github missing", WebhookVerifier{Format: WebhookGitHub}, http.Header{}, "hello", http.StatusUnauthorized},
+		{"stripe", WebhookVerifier{Format: WebhookStripe}, http.Header{"Stripe-Signature": {"t=" + now + ",v1=" + sign("x") + ",v1=" + sign(now+".hello")}}, "hello", http.StatusOK},
+		{"stripe expired", WebhookVerifier{Format: WebhookStripe}, http.Header{"Stripe-Signature": {"t=" + old + ",v1=" + sign(old+".hello")}}, "hello", http.StatusUnauthorized},
+		{"stripe timestamp", WebhookVerifier{Format: WebhookStripe}, http.Header{"Stripe-Signature": {"t=" + now + ",v1=" + sign(old+".hello")}}, "hello", http.StatusUnauthorized},
+		{"hmac", WebhookVerifier{}, http.Header{"X-Signature": {sign("hello")}}, "hello", http.StatusOK},
+		{"hmac header", WebhookVerifier{Header: "X-Sig"}, http.Header{"X-Sig": {"sha256=" + sign("hello")}}, "hello", http.StatusOK},
+		{"hmac timestamp", WebhookVerifier{TimestampHeader: "X-Timestamp"}, http.Header{"X-Signature": {sign(now + ".hello")}, "X-Timestamp": {now}}, "hello", http.StatusOK},
+		{"hmac no timestamp", WebhookVerifier{TimestampHeader: "X-Timestamp"}, http.Header{"X-Signature": {sign("hello")}}, "hello", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		tt.v.Secrets = [][]byte{[]byte("old"), secret}
+		var body string
+		h := NewWebhookHandler(&tt.v, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+			handlerFuncOK(w, r)
+		}))
+
+		r, err := http.NewRequest("POST", "/hook", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		for k, v := range tt.header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s: w.Code = %d, expected: %d", tt.name, w.Code, tt.code)
+		}
+		if tt.code == http.StatusOK && body != tt.body {
+			t.Errorf("%s: body = %q, expected: %q", tt.name, body, tt.body)
+		}
+	}
+}
+
+func TestHawk(t *testing.T) {
+	key := []byte("werxhqb98rpaxn39848xrunpaw3489ruxnpa98w4rxn")
+	creds := Secrets(map[string][]byte{"dh37fgj492je": key})
+
+	// Example requests from the Hawk specification.
+	tests := []struct {
+		method, contentType, body, auth string
+	}{
+		{"GET", "", "", `Hawk id="dh37fgj492je", ts="1353832234", nonce="j4h3g2", ext="some-app-ext-data", mac="6R4rV5iE+NPoym+WwjeHzjAGXUtLNIxmo1vpMofpLAE="`},
+		{"POST", "text/plain", "Thank you for flying Hawk", `Hawk id="dh37fgj492je", ts="1353832234", nonce="j4h3g2", hash="Yi9LfIIFRtBEPt74PVmbTF/xVAwPn7ub15ePICfgnuY=", ext="some-app-ext-data", mac="aSe1DERmZuRl3pI36/9BdZmnErTw3sNzOOAUlfeKjVw="`},
+	}
+	for _, tt := range tests {
+		h := NewHawkHandler(&HawkVerifier{Credentials: creds, MaxSkew: 100 * 365 * 24 * time.Hour}, http.HandlerFunc(handlerFuncOK))
+		r, _ := http.NewRequest(tt.method, "http://example.com:8000/resource/1?b=1&a=2", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", tt.contentType)
+		r.Header.Set("Authorization", tt.auth)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: w.Code = %d, expected: %d", tt.method, w.Code, http.StatusOK)
+		}
+	}
+
+	// With the default skew the example timestamp is stale.
+	h := NewHawkHandler(&HawkVerifier{Credentials: creds}, http.HandlerFunc(handlerFuncOK))
+	r, _ := http.NewRequest("GET", "http://example.com:8000/resource/1?b=1&a=2", nil)
+	r.Header.Set("Authorization", tests[0].auth)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("stale: w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); !strings.Contains(got, `error="Stale timestamp"`) {
+		t.Errorf("stale: WWW-Authenticate = %q, expected stale timestamp challenge", got)
+	}
+
+	// The signer adjusts its clock from stale timestamp challenges.
+	s := &HawkSigner{ID: "dh37fgj492je", Key: key}
+	ahead := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("hawk.1.ts\n" + ahead + "\n"))
+	resp := &http.Response{StatusCode: http.StatusUnauthorized, Header: http.Header{
+		"Www-Authenticate": {`Hawk ts="` + ahead + `", tsm="` + base64.StdEncoding.EncodeToString(mac.Sum(nil)) + `", error="Stale timestamp"`},
+	}}
+	if !s.Challenge(resp) {
+		t.Fatalf("s.Challenge() = false, expected true")
+	}
+	r, _ = http.NewRequest("GET", "http://example.com/", nil)
+	s.Sign(r)
+	if got := r.Header.Get("Authorization"); !strings.Contains(got, `ts="`+ahead+`"`) {
+		t.Errorf("Authorization = %q, expected ts=%q", got, ahead)
+	}
+	resp.Header.Set("WWW-Authenticate", `Hawk ts="`+ahead+`", tsm="bad", error="Stale timestamp"`)
+	if s.Challenge(resp) {
+		t.Errorf("s.Challenge() = true for invalid tsm, expected false")
+	}
+
+	// Round trip, with replay and tampering.
+	var body string
+	srv := httptest.NewServer(NewHawkHandler(&HawkVerifier{Credentials: creds, RequirePayloadHash: true}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		handlerFuncOK(w, r)
+	})))
+	defer srv.Close()
+
+	s = &HawkSigner{ID: "dh37fgj492je", Key: key, Ext: `a\b`}
+	c := &Client{Signer: s}
+	resp, err := c.Post(srv.URL+"/x?y=1", "application/json; charset=utf-8", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("c.Post() returned unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || body != `{}` {
+		t.Errorf("resp.StatusCode = %d, body = %q, expected: %d, %q", resp.StatusCode, body, http.StatusOK, `{}`)
+	}
+
+	r, _ = http.NewRequest("POST", srv.URL+"/x", strings.NewReader("hello"))
+	s.Sign(r)
+	auth := r.Header.Get("Authorization")
+	for _, body := range []string{"hello", "goodbye"} {
+		r, _ = http.NewRequest("POST", srv.URL+"/x", strings.NewReader(body))
+		r.Header.Set("Authorization", auth)
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if body == "hello" && resp.StatusCode != http.StatusOK {
+			t.Errorf("resp.StatusCode = %d, expected: %d", resp.StatusCode, http.StatusOK)
+		}
+		if body == "goodbye" && resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("tampered: resp.StatusCode = %d, expected: %d", resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+
+	// Replayed request, and missing payload hash.
+	r, _ = http.NewRequest("POST", srv.URL+"/x", strings.NewReader("hello"))
+	r.Header.Set("Authorization", auth)
+	for i, r := range []*http.Request{r, func() *http.Request { r, _ := http.NewRequest("GET", srv.URL+"/x", nil); s.Sign(r); return r }()} {
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("[%d] resp.StatusCode = %d, expected: %d", i, resp.StatusCode, http.StatusUnauthorized)
+		}
+	}
+}
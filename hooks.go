@@ -0,0 +1,70 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// OnSuccess configures the handler to call f with the request and username after each
+// successful credential check.  If there are several OnSuccess (or Log) options then each
+// function is called, in order.
+func OnSuccess(f func(r *http.Request, username string)) Option {
+	return func(h *handler) {
+		prev := h.onSuccess
+		if prev == nil {
+			h.onSuccess = f
+			return
+		}
+		h.onSuccess = func(r *http.Request, username string) {
+			prev(r, username)
+			f(r, username)
+		}
+	}
+}
+
+// OnFailure configures the handler to call f with the request, the username (if any)
+// and the reason (e.g. ErrNoCredentials or ErrInvalidCredentials) after each failed
+// credential check.  If there are several OnFailure (or Log) options then each function
+// is called, in order.
+func OnFailure(f func(r *http.Request, username string, reason error)) Option {
+	return func(h *handler) {
+		prev := h.onFailure
+		if prev == nil {
+			h.onFailure = f
+			return
+		}
+		h.onFailure = func(r *http.Request, username string, reason error) {
+			prev(r, username, reason)
+			f(r, username, reason)
+		}
+	}
+}
+
+// Log configures the handler to log the outcome of each credential check to l,
+// successes at slog.LevelInfo and failures at slog.LevelWarn, in addition to any
+// OnSuccess and OnFailure hooks.
+func Log(l *slog.Logger) Option {
+	return func(h *handler) {
+		OnSuccess(func(r *http.Request, username string) {
+			l.LogAttrs(r.Context(), slog.LevelInfo, "authentication succeeded",
+				slog.String("username", username),
+				slog.String("client_ip", h.clientIP(r)),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+			)
+		})(h)
+		OnFailure(func(r *http.Request, username string, reason error) {
+			l.LogAttrs(r.Context(), slog.LevelWarn, "authentication failed",
+				slog.String("username", username),
+				slog.String("reason", reason.Error()),
+				slog.String("client_ip", h.clientIP(r)),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+			)
+		})(h)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// HostMux is an http.Handler which authenticates requests using the Checker and realm
+// registered for the request Host, so that one server can protect several virtual hosts
+// with separate credentials.  Requests for unregistered hosts receive
+// http.StatusNotFound.
+type HostMux struct {
+	h    http.Handler
+	opts []Option
+
+	mu        sync.RWMutex
+	hosts     map[string]http.Handler
+	wildcards map[string]http.Handler
+}
+
+// NewHostMux creates a HostMux which passes authenticated requests to the given
+// http.Handler.  The Options apply to every host, followed by any given to Handle.
+func NewHostMux(h http.Handler, opts ...Option) *HostMux {
+	return &HostMux{
+		h:         h,
+		opts:      opts,
+		hosts:     make(map[string]http.Handler),
+		wildcards: make(map[string]http.Handler),
+	}
+}
+
+// Handle registers the Checker and realm (see Realm) for the host.  The host may be a
+// wildcard "*.example.com", which matches any subdomain of example.com (but not
+// example.com itself), or "*" which matches any host.  Exact hosts take precedence over
+// wildcards, and longer wildcards over shorter ones.  If c is nil then requests for the
+// host are passed on without authentication.
+func (m *HostMux) Handle(host string, c Checker, realm string, opts ...Option) {
+	var h http.Handler = m.h
+	if c != nil {
+		o := make([]Option, 0, len(m.opts)+len(opts)+1)
+		o = append(o, m.opts...)
+		if realm != "" {
+			o = append(o, Realm(realm))
+		}
+		o = append(o, opts...)
+		h = NewHandler(c, m.h, o...)
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case host == "*":
+		m.wildcards[""] = h
+	case strings.HasPrefix(host, "*."):
+		m.wildcards[host[1:]] = h
+	default:
+		m.hosts[host] = h
+	}
+}
+
+// handler returns the handler registered for the host, or nil if there is none.
+func (m *HostMux) handler(host string) http.Handler {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if h, ok := m.hosts[host]; ok {
+		return h
+	}
+	for {
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			break
+		}
+		if h, ok := m.wildcards[host[i:]]; ok {
+			return h
+		}
+		host = host[i+1:]
+	}
+	return m.wildcards[""]
+}
+
+// ServeHTTP implements http.Handler.
+func (m *HostMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h := m.handler(requestHost(r))
+	if h == nil {
+		writeError(w, r, http.StatusNotFound)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+// requestHost returns the lower-cased host of r without any port or trailing dot.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
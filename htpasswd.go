@@ -0,0 +1,481 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HashFormat is a password hash format used in htpasswd files (see HashPassword).
+type HashFormat int
+
+// Password hash formats supported by HashPassword.
+const (
+	// HashBcrypt is bcrypt ("$2y$") with cost 10, the most secure format.
+	HashBcrypt HashFormat = iota
+
+	// HashAPR1 is Apache's MD5-based format ("$apr1$"), the default of htpasswd.
+	HashAPR1
+
+	// HashSHA is unsalted SHA-1 ("{SHA}"), for compatibility with old servers only.
+	HashSHA
+)
+
+// ErrInvalidHtpasswdEntry is returned by SetHtpasswd for usernames or hashes which cannot
+// be stored in htpasswd files.
+var ErrInvalidHtpasswdEntry = errors.New("httpauth: invalid htpasswd entry")
+
+// HashPassword returns the hash of the password in the format f, with a random salt, as
+// created by Apache's htpasswd.
+func HashPassword(password string, f HashFormat) (string, error) {
+	switch f {
+	case HashBcrypt:
+		return BcryptHash(password, bcryptCost)
+
+	case HashAPR1:
+		salt, err := cryptSalt(8)
+		if err != nil {
+			return "", err
+		}
+		return md5Crypt(password, salt, "$apr1$"), nil
+
+	case HashSHA:
+		h := sha1.Sum([]byte(password))
+		return "{SHA}" + base64.StdEncoding.EncodeToString(h[:]), nil
+	}
+	return "", errors.New("httpauth: unknown hash format")
+}
+
+// BcryptHash returns the bcrypt hash ("$2y$") of the password with a random salt and the
+// cost (log2 of the number of key expansion rounds, from 4 to 31), as created by Apache's
+// htpasswd -B -C cost.  Only the first 72 bytes of the password are used.
+func BcryptHash(password string, cost int) (string, error) {
+	if cost < 4 || cost > 31 {
+		return "", errors.New("httpauth: invalid bcrypt cost")
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return bcrypt([]byte(password), salt, cost), nil
+}
+
+// SetHtpasswd sets the password hash (see HashPassword) of the user in the htpasswd file
+// at path, replacing the user's entry if there is one and appending it otherwise.  Other
+// lines (including comments) are kept.  The file is created with mode 0600 if it does not
+// exist, and is otherwise replaced atomically, keeping its mode.
+func SetHtpasswd(path, username, hash string) error {
+	if username == "" || strings.ContainsAny(username, ":\r\n") || strings.ContainsAny(hash, "\r\n") {
+		return ErrInvalidHtpasswdEntry
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	mode := os.FileMode(0600)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	entry := username + ":" + hash
+	var lines []string
+	if len(b) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	}
+	found := false
+	for i, l := range lines {
+		if strings.HasPrefix(strings.TrimSuffix(l, "\r"), username+":") {
+			lines[i] = entry
+			found = true
+		}
+	}
+	if !found {
+		lines = append(lines, entry)
+	}
+	return writeFileAtomic(path, []byte(strings.Join(lines, "\n")+"\n"), mode)
+}
+
+// HashedCreds creates a Checker which uses the map of usernames to password hashes, in
+// the formats used in htpasswd files: bcrypt ("$2y$", "$2b$" and "$2a$"), Apache MD5
+// ("$apr1$"), MD5 crypt ("$1$") and SHA-1 ("{SHA}"), and the SHA-256 ("$5$") and
+// SHA-512 ("$6$") crypt formats (with optional "rounds=" parameter) used in system
+// password files.  Users whose hashes have other formats are rejected.
+//
+// Passwords for unknown usernames are checked against the most expensive hash in the
+// map (e.g. the bcrypt hash with the highest cost), so that they take as long as the
+// slowest known user.  When formats and costs are mixed, users with cheaper hashes can
+// still be told apart from unknown users by timing.
+func HashedCreds(m map[string]string) Checker {
+	return newHashedCreds(m)
+}
+
+type hashedCreds struct {
+	m       map[string]string
+	unknown string // checked against the password for unknown usernames
+}
+
+// unknownUserHash is checked against the password for unknown usernames if there are no
+// users.
+const unknownUserHash = "$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/"
+
+func newHashedCreds(m map[string]string) hashedCreds {
+	c := hashedCreds{m: m, unknown: unknownUserHash}
+	highest := -1
+	for _, h := range m {
+		if cost := passwordHashCost(h); cost > highest {
+			c.unknown, highest = h, cost
+		}
+	}
+	return c
+}
+
+// Check implements Checker.
+func (c hashedCreds) Check(username, password string) bool {
+	h, ok := c.m[username]
+	if !ok {
+		h = c.unknown
+	}
+	return checkPasswordHash(h, password) && ok
+}
+
+// passwordHashCost returns the approximate time in microseconds taken to check a
+// password against hash.
+func passwordHashCost(hash string) int {
+	switch {
+	case strings.HasPrefix(hash, "$apr1$"), strings.HasPrefix(hash, "$1$"):
+		return 300
+	case strings.HasPrefix(hash, "$2"):
+		cost := 0
+		if len(hash) > 6 {
+			cost, _ = strconv.Atoi(hash[4:6])
+		}
+		return 80 << min(max(cost, 0), 31)
+	case strings.HasPrefix(hash, "$5$"), strings.HasPrefix(hash, "$6$"):
+		rounds := 5000
+		if r, ok := strings.CutPrefix(hash[3:], "rounds="); ok {
+			n, _, _ := strings.Cut(r, "$")
+			if v, err := strconv.Atoi(n); err == nil {
+				rounds = min(max(v, 1000), 999999999)
+			}
+		}
+		if hash[1] == '5' {
+			return rounds * 3 / 10
+		}
+		return rounds * 7 / 10
+	}
+	return 1
+}
+
+// checkPasswordHash returns true if hash is a hash of the password (see HashedCreds).
+func checkPasswordHash(hash, password string) bool {
+	var h string
+	switch {
+	case strings.HasPrefix(hash, "$apr1$"), strings.HasPrefix(hash, "$1$"):
+		magic := hash[:strings.IndexByte(hash[1:], '$')+2]
+		salt, _, ok := strings.Cut(hash[len(magic):], "$")
+		if !ok {
+			return false
+		}
+		h = md5Crypt(password, salt, magic)
+	case strings.HasPrefix(hash, "$2"):
+		h = bcryptRehash(hash, password)
+	case strings.HasPrefix(hash, "$5$"), strings.HasPrefix(hash, "$6$"):
+		h = shaCrypt(hash, password)
+	case strings.HasPrefix(hash, "{SHA}"):
+		h, _ = HashPassword(password, HashSHA)
+	default:
+		return false
+	}
+	return h != "" && subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1
+}
+
+// ParseHtpasswd parses the entries ("username:hash" lines) of an htpasswd file from r,
+// for use with HashedCreds.  Blank lines, comments and lines without a colon are
+// ignored.
+func ParseHtpasswd(r io.Reader) (map[string]string, error) {
+	m := make(map[string]string)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if user, hash, ok := strings.Cut(line, ":"); ok && user != "" {
+			m[user] = hash
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// HtpasswdFile creates a Checker which uses the entries of the htpasswd file at path (see
+// HashedCreds and ParseHtpasswd), such as those created by Apache's htpasswd or
+// SetHtpasswd.  The file is read again when its modification time or size changes, so
+// that users can be added or removed without a restart.  If it cannot be read again then
+// the previous entries are used.
+func HtpasswdFile(path string) (Checker, error) {
+	f := &htpasswdFile{path: path}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+type htpasswdFile struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	creds   hashedCreds
+}
+
+// Check implements Checker.
+func (f *htpasswdFile) Check(username, password string) bool {
+	f.mu.Lock()
+	if fi, err := os.Stat(f.path); err == nil && (!fi.ModTime().Equal(f.modTime) || fi.Size() != f.size) {
+		f.load()
+	}
+	c := f.creds
+	f.mu.Unlock()
+	return c.Check(username, password)
+}
+
+// load reads the file, replacing the entries if successful.
+func (f *htpasswdFile) load() error {
+	r, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	fi, err := r.Stat()
+	if err != nil {
+		return err
+	}
+	m, err := ParseHtpasswd(r)
+	if err != nil {
+		return err
+	}
+	f.modTime, f.size, f.creds = fi.ModTime(), fi.Size(), newHashedCreds(m)
+	return nil
+}
+
+// cryptAlphabet is the alphabet used for salts and hashes in crypt formats.
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// cryptSalt returns a random salt of n characters from cryptAlphabet.
+func cryptSalt(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = cryptAlphabet[b[i]%64]
+	}
+	return string(b), nil
+}
+
+// cryptEncode appends the n low 6-bit groups of v to buf, least significant first,
+// using cryptAlphabet.
+func cryptEncode(buf *bytes.Buffer, v uint32, n int) {
+	for ; n > 0; n-- {
+		buf.WriteByte(cryptAlphabet[v&0x3f])
+		v >>= 6
+	}
+}
+
+// md5Crypt returns the MD5-based crypt hash of the password with the salt (of at most 8
+// characters) and magic prefix ("$1$", or "$apr1$" for Apache).
+func md5Crypt(password, salt, magic string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+
+	alt := md5.New()
+	alt.Write([]byte(password + salt + password))
+	mixin := alt.Sum(nil)
+
+	h := md5.New()
+	h.Write([]byte(password + magic + salt))
+	for i := len(password); i > 0; i -= 16 {
+		h.Write(mixin[:min(i, 16)])
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write([]byte{0})
+		} else {
+			h.Write([]byte(password[:1]))
+		}
+	}
+	sum := h.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		h := md5.New()
+		if i&1 != 0 {
+			h.Write([]byte(password))
+		} else {
+			h.Write(sum)
+		}
+		if i%3 != 0 {
+			h.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			h.Write([]byte(password))
+		}
+		if i&1 != 0 {
+			h.Write(sum)
+		} else {
+			h.Write([]byte(password))
+		}
+		sum = h.Sum(nil)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(magic + salt + "$")
+	for i := 0; i < 5; i++ {
+		j := i + 12
+		if j == 16 {
+			j = 5
+		}
+		cryptEncode(&buf, uint32(sum[i])<<16|uint32(sum[i+6])<<8|uint32(sum[j]), 4)
+	}
+	cryptEncode(&buf, uint32(sum[11]), 2)
+	return buf.String()
+}
+
+// shaCryptOrder is the order in which the bytes of SHA-256 and SHA-512 crypt digests are
+// encoded, in groups of three.
+var shaCryptOrder = map[int][]int{
+	sha256.Size: {0, 10, 20, 21, 1, 11, 12, 22, 2, 3, 13, 23, 24, 4, 14, 15, 25, 5, 6, 16, 26, 27, 7, 17, 18, 28, 8, 9, 19, 29},
+	sha512.Size: {0, 21, 42, 22, 43, 1, 44, 2, 23, 3, 24, 45, 25, 46, 4, 47, 5, 26, 6, 27, 48, 28, 49, 7, 50, 8, 29, 9, 30, 51,
+		31, 52, 10, 53, 11, 32, 12, 33, 54, 34, 55, 13, 56, 14, 35, 15, 36, 57, 37, 58, 16, 59, 17, 38, 18, 39, 60, 40, 61, 19,
+		62, 20, 41},
+}
+
+// shaCrypt returns the SHA-256 ("$5$") or SHA-512 ("$6$") crypt hash of the password with
+// the format, rounds and salt of the stored hash, or "" if it is invalid.
+func shaCrypt(stored, password string) string {
+	magic, setting := stored[:3], stored[3:]
+	newHash := sha256.New
+	if magic == "$6$" {
+		newHash = sha512.New
+	}
+
+	rounds, param := 5000, ""
+	if r, ok := strings.CutPrefix(setting, "rounds="); ok {
+		n, rest, ok := strings.Cut(r, "$")
+		v, err := strconv.Atoi(n)
+		if !ok || err != nil || v < 0 {
+			return ""
+		}
+		rounds = min(max(v, 1000), 999999999)
+		param, setting = "rounds="+strconv.Itoa(rounds)+"$", rest
+	}
+	salt, _, ok := strings.Cut(setting, "$")
+	if !ok {
+		return ""
+	}
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+
+	p, s := []byte(password), []byte(salt)
+	sum := func(h hash.Hash) []byte { return h.Sum(nil) }
+	write := func(h hash.Hash, bs ...[]byte) hash.Hash {
+		for _, b := range bs {
+			h.Write(b)
+		}
+		return h
+	}
+
+	b := sum(write(newHash(), p, s, p))
+	h := write(newHash(), p, s)
+	for i := len(p); i > 0; i -= len(b) {
+		h.Write(b[:min(i, len(b))])
+	}
+	for i := len(p); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			h.Write(b)
+		} else {
+			h.Write(p)
+		}
+	}
+	a := sum(h)
+
+	h = newHash()
+	for range p {
+		h.Write(p)
+	}
+	ps := shaCryptRepeat(sum(h), len(p))
+	h = newHash()
+	for i := 0; i < 16+int(a[0]); i++ {
+		h.Write(s)
+	}
+	ss := shaCryptRepeat(sum(h), len(s))
+
+	c := a
+	for i := 0; i < rounds; i++ {
+		h := newHash()
+		if i&1 != 0 {
+			h.Write(ps)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(ss)
+		}
+		if i%7 != 0 {
+			h.Write(ps)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(ps)
+		}
+		c = sum(h)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(magic + param + salt + "$")
+	order := shaCryptOrder[len(c)]
+	for i := 0; i < len(order); i += 3 {
+		cryptEncode(&buf, uint32(c[order[i]])<<16|uint32(c[order[i+1]])<<8|uint32(c[order[i+2]]), 4)
+	}
+	if len(c) == sha256.Size {
+		cryptEncode(&buf, uint32(c[31])<<8|uint32(c[30]), 3)
+	} else {
+		cryptEncode(&buf, uint32(c[63]), 2)
+	}
+	return buf.String()
+}
+
+// shaCryptRepeat returns n bytes of b, repeated as necessary.
+func shaCryptRepeat(b []byte, n int) []byte {
+	r := make([]byte, n)
+	for i := 0; i < n; i += len(b) {
+		copy(r[i:], b)
+	}
+	return r
+}
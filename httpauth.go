@@ -5,7 +5,22 @@
 // Package httpauth provides a wrapper for http.Handler implementing basic HTTP authentication.
 package httpauth
 
-import "net/http"
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Reasons for failed authentication, as passed to OnFailure hooks.
+var (
+	ErrNoCredentials      = errors.New("httpauth: no credentials")
+	ErrInvalidCredentials = errors.New("httpauth: invalid credentials")
+	ErrInvalidCertificate = errors.New("httpauth: invalid client certificate")
+)
 
 // Checker defines the Check method which provides username-password checking.
 type Checker interface {
@@ -24,10 +39,18 @@ type creds struct {
 	m map[string]string
 }
 
-// Check implements Checker.
+// Check implements Checker.  A comparison is made even for unknown usernames so that
+// response timing does not reveal which usernames are valid.
 func (c creds) Check(username, password string) bool {
 	p, ok := c.m[username]
-	return ok && p == password
+	return equalPasswords(p, password) && ok
+}
+
+// equalPasswords compares the SHA-256 digests of a and b in constant time, so that the
+// time taken reveals neither the contents nor the length of either.
+func equalPasswords(a, b string) bool {
+	ha, hb := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(ha[:], hb[:]) == 1
 }
 
 // Skip is an implementation of Checker in which Check always returns true.
@@ -41,67 +64,342 @@ func (n skip) Check(username, password string) bool { return true }
 // HandlerFunc returns an http.HandlerFunc which checks basic HTTP authentication header
 // values using Checker and passes requests to the given http.HandlerFunc when Check returns
 // true (responds with http.StatusUnauthorized if the call to Check returns false).
-func HandlerFunc(c Checker, f http.HandlerFunc) http.HandlerFunc {
-	h := NewHandler(c, f)
+func HandlerFunc(c Checker, f http.HandlerFunc, opts ...Option) http.HandlerFunc {
+	h := NewHandler(c, f, opts...)
 	return http.HandlerFunc(h.ServeHTTP)
 }
 
 type handler struct {
 	http.Handler
-	c Checker
+	c     Checker
+	proxy bool
+	cc    CertChecker
+	s     *Sessions
+
+	exempt    []string
+	preflight bool
+	methods   map[string]bool
+	anonymous bool
+
+	metrics     *Metrics
+	metricsName string
+	tracer      Tracer
+
+	onSuccess func(r *http.Request, username string)
+	onFailure func(r *http.Request, username string, reason error)
+
+	tarpit  *tarpit
+	limiter RateLimiter
+	ip      *IPResolver
+
+	quotaStore  CounterStore
+	quotaLimits []QuotaLimit
+
+	failStatus     int
+	noChallenge    bool
+	apiNoChallenge bool
+	realm          string
+
+	requireHTTPS  bool
+	redirectHTTPS bool
 }
 
 // NewHandler returns an http.Handler which checks basic HTTP authentication header values
 // using the Checker and passes requests to the given http.Handler when Check returns true
-// (responds with http.StatusUnauthorized if the call to Check returns false).
-func NewHandler(c Checker, h http.Handler) http.Handler {
-	return &handler{
+// (responds with http.StatusUnauthorized if the call to Check returns false).  The
+// authenticated username is added to the request context, see UserFromContext.
+func NewHandler(c Checker, h http.Handler, opts ...Option) http.Handler {
+	hh := &handler{
 		Handler: h,
 		c:       c,
 	}
+	for _, o := range opts {
+		o(hh)
+	}
+	return hh
+}
+
+// Middleware returns a function which wraps an http.Handler using NewHandler with the
+// Checker and Options, for use with middleware chains.
+func Middleware(c Checker, opts ...Option) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return NewHandler(c, h, opts...)
+	}
 }
 
 // ServeHTTP implements http.Handler.
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	username, password, _ := r.BasicAuth()
+	if h.exempted(r) {
+		h.Handler.ServeHTTP(w, r)
+		return
+	}
+
+	if h.requireHTTPS && !h.ip.IsHTTPS(r) {
+		h.insecure(w, r)
+		return
+	}
+
+	if h.s != nil && !h.proxy {
+		if username, ok := h.s.User(r); ok {
+			h.serve(w, r, username)
+			return
+		}
+	}
+
+	if h.anonymous && !h.hasCredentials(r) {
+		h.Handler.ServeHTTP(w, withAnonymous(r))
+		return
+	}
+
+	if h.limiter != nil {
+		if d := h.limiter.Delay(h.clientIP(r)); d > 0 {
+			tooManyRequests(w, r, d)
+			return
+		}
+	}
+
+	username, err := h.authenticate(r)
+	if err != nil {
+		if h.limiter != nil {
+			h.limiter.Take(h.clientIP(r))
+		}
+		h.fail(w, r)
+		return
+	}
+	if h.proxy {
+		// Proxy-Authorization is hop-by-hop, so must not be passed on.
+		r.Header.Del("Proxy-Authorization")
+	} else if h.s != nil {
+		// The request is authenticated regardless, so a failure here only means
+		// that the client will have to send credentials again.
+		h.s.Issue(w, r, username)
+	}
+	h.serve(w, r, username)
+}
+
+// serve passes the request, authenticated as username, to the wrapped handler.
+func (h *handler) serve(w http.ResponseWriter, r *http.Request, username string) {
+	if h.quotaStore != nil {
+		if d := h.overQuota(username); d > 0 {
+			tooManyRequests(w, r, d)
+			return
+		}
+	}
+	if h.metrics != nil {
+		ww, sw := wrapWriter(w)
+		h.Handler.ServeHTTP(ww, withUser(r, username))
+		h.metrics.observeResponse(h.metricsName, sw.Status())
+		return
+	}
+	h.Handler.ServeHTTP(w, withUser(r, username))
+}
+
+// exempted returns true if r does not require authentication.
+func (h *handler) exempted(r *http.Request) bool {
+	if h.preflight && isPreflight(r) {
+		return true
+	}
+	if h.methods != nil && !h.methods[r.Method] {
+		return true
+	}
+	return matchPath(h.exempt, r.URL.Path)
+}
+
+// authenticate checks the credentials of r (see check), recording the outcome with the
+// configured metrics, tracer and hooks.
+func (h *handler) authenticate(r *http.Request) (string, error) {
+	start, end := time.Now(), h.startSpan(r)
+	username, err := h.check(r)
+	end(err == nil)
+	if h.metrics != nil {
+		h.metrics.observe(h.metricsName, err == nil, time.Since(start))
+	}
+
+	if err != nil {
+		if h.onFailure != nil {
+			h.onFailure(r, username, err)
+		}
+		if h.tarpit != nil {
+			wait(r, h.tarpit.fail(tarpitKeys(h.clientIP(r), username)))
+		}
+		return username, err
+	}
+
+	if h.onSuccess != nil {
+		h.onSuccess(r, username)
+	}
+	if h.tarpit != nil {
+		h.tarpit.reset(tarpitKeys(h.clientIP(r), username))
+	}
+	return username, nil
+}
+
+// check authenticates r, either by client certificate (if enabled) or basic HTTP
+// authentication, returning the username (the subject common name for certificates)
+// and an error describing the reason for any failure.
+func (h *handler) check(r *http.Request) (string, error) {
+	if h.cc != nil {
+		if cert := peerCert(r); cert != nil {
+			if !checkPeerCert(h.cc, r, cert) {
+				return cert.Subject.CommonName, ErrInvalidCertificate
+			}
+			return cert.Subject.CommonName, nil
+		}
+		if h.c == nil {
+			return "", ErrNoCredentials
+		}
+	}
+	username, password, ok := h.credentials(r)
 	if !h.c.Check(username, password) {
-		w.Header().Add("WWW-Authenticate", "Basic")
-		w.WriteHeader(http.StatusUnauthorized)
-		w.Write([]byte(http.StatusText(http.StatusUnauthorized)))
+		if !ok {
+			return "", ErrNoCredentials
+		}
+		return username, ErrInvalidCredentials
+	}
+	return username, nil
+}
+
+// hasCredentials returns true if r carries credentials of any kind accepted by the
+// handler, whether valid or not.
+func (h *handler) hasCredentials(r *http.Request) bool {
+	if h.cc != nil && peerCert(r) != nil {
+		return true
+	}
+	header := "Authorization"
+	if h.proxy {
+		header = "Proxy-Authorization"
+	}
+	return r.Header.Get(header) != ""
+}
+
+// credentials returns the basic HTTP authentication credentials from r.
+func (h *handler) credentials(r *http.Request) (username, password string, ok bool) {
+	if h.proxy {
+		return parseBasicAuth(r.Header.Get("Proxy-Authorization"))
+	}
+	return r.BasicAuth()
+}
+
+// fail responds to a request which failed authentication.
+func (h *handler) fail(w http.ResponseWriter, r *http.Request) {
+	status, header := http.StatusUnauthorized, "WWW-Authenticate"
+	if h.proxy {
+		status, header = http.StatusProxyAuthRequired, "Proxy-Authenticate"
+	}
+	if h.failStatus != 0 {
+		status = h.failStatus
+	}
+	if !h.noChallenge && !(h.apiNoChallenge && isAPIRequest(r)) {
+		challenge := "Basic"
+		if h.realm != "" {
+			challenge += " realm=" + quote(h.realm)
+		}
+		w.Header().Add(header, challenge)
+	}
+	writeError(w, r, status)
+}
+
+// parseBasicAuth parses the value of a basic HTTP authentication header.
+func parseBasicAuth(auth string) (username, password string, ok bool) {
+	scheme, params := splitScheme(auth)
+	if scheme != "basic" {
 		return
 	}
-	h.Handler.ServeHTTP(w, r)
+	b, err := base64.StdEncoding.DecodeString(params)
+	if err != nil {
+		return
+	}
+	i := strings.IndexByte(string(b), ':')
+	if i < 0 {
+		return
+	}
+	return string(b[:i]), string(b[i+1:]), true
+}
+
+// unauthorized responds to r with http.StatusUnauthorized and the given WWW-Authenticate
+// challenge (no challenge is sent if empty).
+func unauthorized(w http.ResponseWriter, r *http.Request, challenge string) {
+	if challenge != "" {
+		w.Header().Add("WWW-Authenticate", challenge)
+	}
+	writeError(w, r, http.StatusUnauthorized)
 }
 
 // Handle is a convenience function which calls http.Handle with the pattern and wrapped
 // http.Handler (see NewHandler).
-func Handle(c Checker, pattern string, h http.Handler) {
-	http.Handle(pattern, NewHandler(c, h))
+func Handle(c Checker, pattern string, h http.Handler, opts ...Option) {
+	http.Handle(pattern, NewHandler(c, h, opts...))
 }
 
 // HandleFunc is a convenience function which calls http.HandleFunc with the pattern and
 // wrapped http.HandlerFunc (see HandlerFunc).
-func HandleFunc(c Checker, pattern string, h http.HandlerFunc) {
-	http.HandleFunc(pattern, HandlerFunc(c, h))
+func HandleFunc(c Checker, pattern string, h http.HandlerFunc, opts ...Option) {
+	http.HandleFunc(pattern, HandlerFunc(c, h, opts...))
 }
 
 // ServeMux is a convenience type which wraps Handle and HandleFunc calls on an http.ServeMux
-// for the same Checker.
+// for the same Checker.  ServeMux is itself an http.Handler, and patterns are passed
+// unchanged to the http.ServeMux, so method and wildcard patterns (e.g. "GET /items/{id}")
+// can be used.
 type ServeMux struct {
 	Checker
 	*http.ServeMux
+
+	opts []Option
 }
 
 // NewServeMux creates a new http.ServeMux which wraps calls to Handle and Handler for the
-// same Checker.
-func NewServeMux(c Checker, m *http.ServeMux) ServeMux {
-	return ServeMux{c, m}
+// same Checker and Options.  If m is nil then a new http.ServeMux is created.
+func NewServeMux(c Checker, m *http.ServeMux, opts ...Option) ServeMux {
+	if m == nil {
+		m = http.NewServeMux()
+	}
+	return ServeMux{c, m, opts}
+}
+
+// ServeHTTP implements http.Handler by dispatching the request to the http.ServeMux.
+func (m ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.ServeMux.ServeHTTP(w, r)
+}
+
+// Handler returns the handler to use for the request and its registered pattern (see
+// http.ServeMux.Handler).
+func (m ServeMux) Handler(r *http.Request) (h http.Handler, pattern string) {
+	return m.ServeMux.Handler(r)
 }
 
 func (m ServeMux) Handle(pattern string, h http.Handler) {
-	m.ServeMux.Handle(pattern, NewHandler(m.Checker, h))
+	m.ServeMux.Handle(pattern, NewHandler(m.Checker, h, m.opts...))
 }
 
 func (m ServeMux) HandleFunc(pattern string, h http.HandlerFunc) {
-	m.ServeMux.Handle(pattern, HandlerFunc(m.Checker, h))
+	m.ServeMux.Handle(pattern, HandlerFunc(m.Checker, h, m.opts...))
+}
+
+// HandleWith registers the handler for the pattern, using the Checker c instead of the
+// ServeMux Checker.  The ServeMux Options still apply, followed by any opts given here.
+// If c is nil then the handler is registered without authentication.
+func (m ServeMux) HandleWith(pattern string, c Checker, h http.Handler, opts ...Option) {
+	if c == nil {
+		m.ServeMux.Handle(pattern, h)
+		return
+	}
+	o := make([]Option, 0, len(m.opts)+len(opts))
+	o = append(o, m.opts...)
+	o = append(o, opts...)
+	m.ServeMux.Handle(pattern, NewHandler(c, h, o...))
+}
+
+// HandleFuncWith registers the handler function for the pattern, using the Checker c
+// instead of the ServeMux Checker (see HandleWith).
+func (m ServeMux) HandleFuncWith(pattern string, c Checker, h http.HandlerFunc, opts ...Option) {
+	m.HandleWith(pattern, c, h, opts...)
+}
+
+// HandleRealm registers the handler for the pattern using the ServeMux Checker, with
+// failure responses challenging for the given realm (see Realm).  This allows different
+// parts of the same ServeMux (e.g. "admin" and "api") to be presented as distinct
+// protection spaces.
+func (m ServeMux) HandleRealm(pattern, realm string, h http.Handler) {
+	m.HandleWith(pattern, m.Checker, h, Realm(realm))
 }
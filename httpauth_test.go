@@ -2,12 +2,27 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+// Use the Go 1.22 ServeMux pattern semantics regardless of the module Go version.
+//go:debug httpmuxgo121=0
+
 package httpauth_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	. "github.com/dhowden/httpauth"
 )
@@ -188,3 +203,986 @@ func TestServeMux(t *testing.T) {
 	w.Handle("/h", http.HandlerFunc(handlerFuncOK))
 	testHandlerOK(t, "/h", m)
 }
+
+func TestKeys(t *testing.T) {
+	k := Keys("abc123")
+	if !k.CheckKey("abc123") {
+		t.Errorf("k.CheckKey(%q) = false, expected true", "abc123")
+	}
+	if k.CheckKey("abc") {
+		t.Errorf("k.CheckKey(%q) = true, expected false", "abc")
+	}
+
+	k = HashedKeys(HashKey("abc123"))
+	if !k.CheckKey("abc123") {
+		t.Errorf("k.CheckKey(%q) = false, expected true", "abc123")
+	}
+	if k.CheckKey("") {
+		t.Errorf("k.CheckKey(\"\") = true, expected false")
+	}
+}
+
+func TestAPIKeyHandler(t *testing.T) {
+	h := NewAPIKeyHandler(Keys("abc123"), "X-API-Key", "api_key", http.HandlerFunc(handlerFuncOK))
+
+	tests := []struct {
+		url, header string
+		code        int
+	}{
+		{"/", "", http.StatusUnauthorized},
+		{"/", "wrong", http.StatusUnauthorized},
+		{"/", "abc123", http.StatusOK},
+		{"/?api_key=abc123", "", http.StatusOK},
+		{"/?api_key=wrong", "", http.StatusUnauthorized},
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest("GET", tt.url, nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		if tt.header != "" {
+			r.Header.Set("X-API-Key", tt.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("[%d] w.Code = %d, expected: %d", ii, w.Code, tt.code)
+		}
+	}
+}
+
+func TestAPIKeySigner(t *testing.T) {
+	h := NewAPIKeyHandler(Keys("abc123"), "X-Custom-Key", "key", http.HandlerFunc(handlerFuncOK))
+
+	tests := []struct {
+		s    APIKeySigner
+		code int
+	}{
+		{APIKeySigner{Key: "abc123"}, http.StatusUnauthorized},
+		{APIKeySigner{Key: "abc123", Header: "X-Custom-Key"}, http.StatusOK},
+		{APIKeySigner{Key: "abc123", Param: "key"}, http.StatusOK},
+		{APIKeySigner{Key: "wrong", Param: "key"}, http.StatusUnauthorized},
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest("GET", "/?x=1", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		if err := tt.s.Sign(r); err != nil {
+			t.Fatalf("[%d] Sign() returned unexpected error: %v", ii, err)
+		}
+		if r.URL.Query().Get("x") != "1" {
+			t.Errorf("[%d] query = %q, expected x=1 to be kept", ii, r.URL.RawQuery)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("[%d] w.Code = %d, expected: %d", ii, w.Code, tt.code)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	h := NewHandler(Creds(map[string]string{"alice": "shhhh"}), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "" {
+			t.Errorf("Proxy-Authorization header passed to handler")
+		}
+		handlerFuncOK(w, r)
+	}), Proxy())
+
+	r, err := http.NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+
+	// Authorization is ignored in proxy mode.
+	r.SetBasicAuth("alice", "shhhh")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusProxyAuthRequired {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusProxyAuthRequired)
+	}
+	if w.Header().Get("Proxy-Authenticate") != "Basic" {
+		t.Errorf("w.Header().Get(\"Proxy-Authenticate\") = %s, expected: %s", w.Header().Get("Proxy-Authenticate"), "Basic")
+	}
+
+	r.Header.Set("Proxy-Authorization", r.Header.Get("Authorization"))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusOK)
+	}
+}
+
+func testCert(t *testing.T, cn string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn + ".example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("unexpected error parsing certificate: %v", err)
+	}
+	return cert
+}
+
+func TestClientCert(t *testing.T) {
+	alice := testCert(t, "alice")
+	bob := testCert(t, "bob")
+
+	tests := []struct {
+		cc    CertChecker
+		c     Checker
+		cert  *x509.Certificate
+		basic bool
+		code  int
+	}{
+		{CertNames("alice"), nil, alice, false, http.StatusOK},
+		{CertNames("bob.example.com"), nil, bob, false, http.StatusOK},
+		{CertNames("alice"), nil, bob, false, http.StatusUnauthorized},
+		{CertFingerprints(CertFingerprint(bob)), nil, bob, false, http.StatusOK},
+		{CertFingerprints(CertFingerprint(bob)), nil, alice, false, http.StatusUnauthorized},
+
+		// No certificate, no fallback
+		{CertNames("alice"), nil, nil, true, http.StatusUnauthorized},
+
+		// No certificate, fallback to basic
+		{CertNames("alice"), Creds(map[string]string{"alice": "shhhh"}), nil, true, http.StatusOK},
+
+		// Invalid certificate does not fall back to basic
+		{CertNames("alice"), Creds(map[string]string{"alice": "shhhh"}), bob, true, http.StatusUnauthorized},
+	}
+
+	for ii, tt := range tests {
+		h := NewHandler(tt.c, http.HandlerFunc(handlerFuncOK), ClientCert(tt.cc))
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		if tt.cert != nil {
+			r.TLS = &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{tt.cert},
+				VerifiedChains:   [][]*x509.Certificate{{tt.cert}},
+			}
+		}
+		if tt.basic {
+			r.SetBasicAuth("alice", "shhhh")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("[%d] w.Code = %d, expected: %d", ii, w.Code, tt.code)
+		}
+	}
+
+	// Names are not trusted from unverified certificates, but fingerprints are.
+	for _, tt := range []struct {
+		cc   CertChecker
+		code int
+	}{
+		{CertNames("alice"), http.StatusUnauthorized},
+		{CertFingerprints(CertFingerprint(alice)), http.StatusOK},
+	} {
+		h := NewHandler(nil, http.HandlerFunc(handlerFuncOK), ClientCert(tt.cc))
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{alice}}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("unverified %T: w.Code = %d, expected: %d", tt.cc, w.Code, tt.code)
+		}
+	}
+}
+
+func TestExempt(t *testing.T) {
+	c := fixedChecker(false)
+	h := NewHandler(c, http.HandlerFunc(handlerFuncOK), Exempt("/healthz", "/public/*", "/*.ico"))
+
+	testHandlerOK(t, "/healthz", h)
+	testHandlerOK(t, "/public/css/main.css", h)
+	testHandlerOK(t, "/favicon.ico", h)
+	testHandlerUnauthorised(t, "/healthz/x", h)
+	testHandlerUnauthorised(t, "/publicity", h)
+	testHandlerUnauthorised(t, "/", h)
+	testHandlerOK(t, "/public/", h)
+	testHandlerUnauthorised(t, "/public/../secret", h)
+	testHandlerUnauthorised(t, "/public/%2e%2e/secret", h)
+	testHandlerUnauthorised(t, "/public/./../secret", h)
+	testHandlerUnauthorised(t, "/public//x", h)
+
+	m := http.NewServeMux()
+	w := NewServeMux(c, m, Exempt("/metrics"))
+	w.HandleFunc("/", handlerFuncOK)
+	testHandlerOK(t, "/metrics", m)
+	testHandlerUnauthorised(t, "/other", m)
+}
+
+func TestAllowPreflight(t *testing.T) {
+	h := NewHandler(fixedChecker(false), http.HandlerFunc(handlerFuncOK), AllowPreflight())
+
+	// Plain OPTIONS requests still require authentication.
+	r, err := http.NewRequest("OPTIONS", "/", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRequireMethods(t *testing.T) {
+	h := NewHandler(fixedChecker(false), http.HandlerFunc(handlerFuncOK), RequireMethods("POST", "delete"))
+
+	tests := []struct {
+		method string
+		code   int
+	}{
+		{"GET", http.StatusOK},
+		{"HEAD", http.StatusOK},
+		{"POST", http.StatusUnauthorized},
+		{"DELETE", http.StatusUnauthorized},
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest(tt.method, "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("[%d] w.Code = %d, expected: %d", ii, w.Code, tt.code)
+		}
+	}
+
+	// No methods still requires authentication for all requests.
+	h = NewHandler(fixedChecker(false), http.HandlerFunc(handlerFuncOK), RequireMethods())
+	testHandlerUnauthorised(t, "/", h)
+}
+
+func TestServeMuxHandleWith(t *testing.T) {
+	m := http.NewServeMux()
+	w := NewServeMux(fixedChecker(false), m)
+	w.HandleFunc("/default", handlerFuncOK)
+	w.HandleWith("/override", fixedChecker(true), http.HandlerFunc(handlerFuncOK))
+	w.HandleFuncWith("/public", nil, handlerFuncOK)
+
+	testHandlerUnauthorised(t, "/default", m)
+	testHandlerOK(t, "/override", m)
+	testHandlerOK(t, "/public", m)
+}
+
+func TestServeMuxRealm(t *testing.T) {
+	w := NewServeMux(fixedChecker(false), nil)
+	w.HandleRealm("/admin/", "admin", http.HandlerFunc(handlerFuncOK))
+	w.HandleWith("/api/", w.Checker, http.HandlerFunc(handlerFuncOK), Realm(`api "v2"`))
+	w.HandleFunc("/other", handlerFuncOK)
+
+	tests := []struct {
+		path, challenge string
+	}{
+		{"/admin/users", `Basic realm="admin"`},
+		{"/api/items", `Basic realm="api \"v2\""`},
+		{"/other", "Basic"},
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest("GET", tt.path, nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		rec := httptest.NewRecorder()
+		w.ServeHTTP(rec, r)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("[%d] rec.Code = %d, expected: %d", ii, rec.Code, http.StatusUnauthorized)
+		}
+		if got := rec.Header().Get("WWW-Authenticate"); got != tt.challenge {
+			t.Errorf("[%d] WWW-Authenticate = %s, expected: %s", ii, got, tt.challenge)
+		}
+	}
+}
+
+func TestServeMuxPatterns(t *testing.T) {
+	w := NewServeMux(fixedChecker(true), nil)
+	w.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "42" {
+			t.Errorf("r.PathValue(\"id\") = %q, expected %q", r.PathValue("id"), "42")
+		}
+		handlerFuncOK(w, r)
+	})
+	testHandlerOK(t, "/items/42", w)
+
+	r, err := http.NewRequest("POST", "/items/42", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, r)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("rec.Code = %d, expected: %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+
+	if _, pattern := w.Handler(r); pattern != "" {
+		t.Errorf("w.Handler() pattern = %q, expected %q", pattern, "")
+	}
+	r.Method = "GET"
+	if _, pattern := w.Handler(r); pattern != "GET /items/{id}" {
+		t.Errorf("w.Handler() pattern = %q, expected %q", pattern, "GET /items/{id}")
+	}
+
+	w = NewServeMux(fixedChecker(false), nil)
+	w.HandleFunc("GET /items/{id}", handlerFuncOK)
+	testHandlerUnauthorised(t, "/items/42", w)
+}
+
+func TestMiddleware(t *testing.T) {
+	mw := Middleware(fixedChecker(false))
+	testHandlerUnauthorised(t, "/", mw(http.HandlerFunc(handlerFuncOK)))
+
+	mw = Middleware(fixedChecker(true))
+	testHandlerOK(t, "/", mw(http.HandlerFunc(handlerFuncOK)))
+}
+
+func TestForwardAuthHandler(t *testing.T) {
+	h := NewForwardAuthHandler(Creds(map[string]string{"alice": "shhhh"}))
+
+	r, err := http.NewRequest("GET", "/auth", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+
+	r.SetBasicAuth("alice", "shhhh")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusOK)
+	}
+	if u := w.Header().Get("X-Forwarded-User"); u != "alice" {
+		t.Errorf("X-Forwarded-User = %q, expected %q", u, "alice")
+	}
+}
+
+func TestTarpit(t *testing.T) {
+	const base = 20 * time.Millisecond
+	h := NewHandler(Creds(map[string]string{"alice": "shhhh"}), http.HandlerFunc(handlerFuncOK), Tarpit(base, 2*base))
+
+	serve := func(pass string) time.Duration {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.SetBasicAuth("alice", pass)
+		start := time.Now()
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		return time.Since(start)
+	}
+
+	if d := serve("wrong"); d < base {
+		t.Errorf("first failure took %v, expected at least %v", d, base)
+	}
+	if d := serve("wrong"); d < 2*base {
+		t.Errorf("second failure took %v, expected at least %v", d, 2*base)
+	}
+	if d := serve("shhhh"); d >= base {
+		t.Errorf("success took %v, expected less than %v", d, base)
+	}
+
+	// Success resets the delay.
+	if d := serve("wrong"); d < base || d >= 2*base {
+		t.Errorf("failure after success took %v, expected between %v and %v", d, base, 2*base)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	h := NewHandler(Creds(map[string]string{"alice": "shhhh"}), http.HandlerFunc(handlerFuncOK), RateLimit(NewMemoryRateLimiter(0.1, 2)))
+
+	serve := func(addr, pass string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.RemoteAddr = addr
+		r.SetBasicAuth("alice", pass)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		addr, pass string
+		code       int
+	}{
+		{"192.0.2.1:1", "shhhh", http.StatusOK},
+		{"192.0.2.1:1", "wrong", http.StatusUnauthorized},
+		{"192.0.2.1:2", "wrong", http.StatusUnauthorized},
+		{"192.0.2.1:3", "shhhh", http.StatusTooManyRequests},
+		{"192.0.2.2:1", "shhhh", http.StatusOK},
+	}
+
+	for ii, tt := range tests {
+		w := serve(tt.addr, tt.pass)
+		if w.Code != tt.code {
+			t.Errorf("[%d] w.Code = %d, expected: %d", ii, w.Code, tt.code)
+		}
+		if tt.code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "10" {
+			t.Errorf("[%d] Retry-After = %q, expected %q", ii, w.Header().Get("Retry-After"), "10")
+		}
+	}
+}
+
+func TestFailureStatus(t *testing.T) {
+	m := http.NewServeMux()
+	w := NewServeMux(fixedChecker(false), m)
+	w.HandleFunc("/default", handlerFuncOK)
+	w.HandleFuncWith("/hidden", fixedChecker(false), handlerFuncOK, FailureStatus(http.StatusNotFound), NoChallenge())
+	testHandlerUnauthorised(t, "/default", m)
+
+	r, err := http.NewRequest("GET", "/hidden", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("rec.Code = %d, expected: %d", rec.Code, http.StatusNotFound)
+	}
+	if _, ok := rec.Header()["Www-Authenticate"]; ok {
+		t.Errorf("unexpected WWW-Authenticate header: %v", rec.Header().Get("WWW-Authenticate"))
+	}
+	if rec.Body.String() != http.StatusText(http.StatusNotFound) {
+		t.Errorf("rec.Body = %q, expected: %q", rec.Body.String(), http.StatusText(http.StatusNotFound))
+	}
+}
+
+func TestFailureContentNegotiation(t *testing.T) {
+	h := NewHandler(fixedChecker(false), http.HandlerFunc(handlerFuncOK))
+
+	tests := []struct {
+		accept, contentType, body string
+	}{
+		{"", "text/plain; charset=utf-8", "Unauthorized"},
+		{"*/*", "text/plain; charset=utf-8", "Unauthorized"},
+		{"application/json", "application/json", `{"error":"unauthorized"}`},
+		{"application/problem+json", "application/json", `{"error":"unauthorized"}`},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html; charset=utf-8", ""},
+		{"text/html;q=0.5, application/json", "application/json", `{"error":"unauthorized"}`},
+		{"text/plain, application/json;q=0.1", "text/plain; charset=utf-8", "Unauthorized"},
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("[%d] rec.Code = %d, expected: %d", ii, rec.Code, http.StatusUnauthorized)
+		}
+		if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("[%d] Content-Type = %q, expected: %q", ii, got, tt.contentType)
+		}
+		if tt.body != "" && rec.Body.String() != tt.body {
+			t.Errorf("[%d] rec.Body = %q, expected: %q", ii, rec.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestNoChallengeForAPI(t *testing.T) {
+	h := NewHandler(fixedChecker(false), http.HandlerFunc(handlerFuncOK), NoChallengeForAPI())
+
+	tests := []struct {
+		header    http.Header
+		challenge bool
+	}{
+		{http.Header{}, true},
+		{http.Header{"Accept": {"text/html"}, "Sec-Fetch-Mode": {"navigate"}}, true},
+		{http.Header{"X-Requested-With": {"XMLHttpRequest"}}, false},
+		{http.Header{"Sec-Fetch-Mode": {"cors"}}, false},
+		{http.Header{"Accept": {"application/json"}}, false},
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.Header = tt.header
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("[%d] w.Code = %d, expected: %d", ii, w.Code, http.StatusUnauthorized)
+		}
+		if got := w.Header().Get("WWW-Authenticate") != ""; got != tt.challenge {
+			t.Errorf("[%d] challenge sent = %v, expected: %v", ii, got, tt.challenge)
+		}
+	}
+}
+
+func TestAllowAnonymous(t *testing.T) {
+	var anonymous bool
+	var user string
+	h := NewHandler(Creds(map[string]string{"alice": "shhhh"}), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		anonymous = IsAnonymous(r.Context())
+		user, _ = UserFromContext(r.Context())
+		handlerFuncOK(w, r)
+	}), AllowAnonymous())
+
+	tests := []struct {
+		user, pass string
+		code       int
+		anonymous  bool
+	}{
+		{"", "", http.StatusOK, true},
+		{"alice", "shhhh", http.StatusOK, false},
+		{"alice", "wrong", http.StatusUnauthorized, false},
+	}
+
+	for ii, tt := range tests {
+		anonymous, user = false, ""
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		if tt.user != "" {
+			r.SetBasicAuth(tt.user, tt.pass)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tt.code {
+			t.Errorf("[%d] rec.Code = %d, expected: %d", ii, rec.Code, tt.code)
+		}
+		if anonymous != tt.anonymous {
+			t.Errorf("[%d] IsAnonymous() = %v, expected %v", ii, anonymous, tt.anonymous)
+		}
+		if tt.code == http.StatusOK && !tt.anonymous && user != tt.user {
+			t.Errorf("[%d] UserFromContext() = %q, expected %q", ii, user, tt.user)
+		}
+	}
+}
+
+func TestRotatingCreds(t *testing.T) {
+	c := NewRotatingCreds(map[string]string{"alice": "old", "bob": "bobpass"})
+
+	c.Rotate("alice", "new", time.Hour)
+	c.Rotate("bob", "bobnew", -time.Second)
+	c.Rotate("carol", "carolpass", time.Hour)
+
+	tests := []struct {
+		user, pass string
+		ok         bool
+	}{
+		{"alice", "new", true},
+		{"alice", "old", true},
+		{"alice", "other", false},
+		{"bob", "bobnew", true},
+		{"bob", "bobpass", false}, // grace period has ended
+		{"carol", "carolpass", true},
+		{"dave", "", false},
+	}
+	for ii, tt := range tests {
+		if got := c.Check(tt.user, tt.pass); got != tt.ok {
+			t.Errorf("[%d] c.Check(%q, %q) = %v, expected %v", ii, tt.user, tt.pass, got, tt.ok)
+		}
+	}
+
+	c.Set("alice", "newer")
+	if c.Check("alice", "new") {
+		t.Errorf("c.Check() accepted password replaced by Set")
+	}
+	c.Delete("alice")
+	if c.Check("alice", "newer") {
+		t.Errorf("c.Check() accepted deleted user")
+	}
+
+	// Empty previous passwords are accepted during the grace period.
+	c.Set("erin", "")
+	c.Rotate("erin", "erinpass", time.Hour)
+	if !c.Check("erin", "") || !c.Check("erin", "erinpass") {
+		t.Errorf("c.Check() rejected password during grace period")
+	}
+
+	// Hashed passwords.
+	hash := func(password string) string {
+		h, err := HashPassword(password, HashAPR1)
+		if err != nil {
+			t.Fatalf("HashPassword() returned unexpected error: %v", err)
+		}
+		return h
+	}
+	hc := NewRotatingHashedCreds(map[string]string{"alice": hash("old")})
+	hc.Rotate("alice", hash("new"), time.Hour)
+	for ii, tt := range []struct {
+		user, pass string
+		ok         bool
+	}{
+		{"alice", "new", true},
+		{"alice", "old", true},
+		{"alice", "other", false},
+		{"alice", hash("new"), false},
+		{"dave", "", false},
+	} {
+		if got := hc.Check(tt.user, tt.pass); got != tt.ok {
+			t.Errorf("[%d] hashed c.Check(%q, %q) = %v, expected %v", ii, tt.user, tt.pass, got, tt.ok)
+		}
+	}
+}
+
+func TestExpiring(t *testing.T) {
+	var expired []string
+	c := Expiring(Creds(map[string]string{"alice": "shhhh", "bob": "bobpass", "carol": "carolpass"}), map[string]time.Time{
+		"alice": time.Now().Add(time.Hour),
+		"bob":   time.Now().Add(-time.Hour),
+	}, func(username string) {
+		expired = append(expired, username)
+	})
+
+	tests := []struct {
+		user, pass string
+		ok         bool
+	}{
+		{"alice", "shhhh", true},
+		{"bob", "bobpass", false},
+		{"bob", "wrong", false},
+		{"carol", "carolpass", true},
+	}
+	for ii, tt := range tests {
+		if got := c.Check(tt.user, tt.pass); got != tt.ok {
+			t.Errorf("[%d] c.Check(%q, %q) = %v, expected %v", ii, tt.user, tt.pass, got, tt.ok)
+		}
+	}
+
+	// Only the attempt with the correct (but expired) password is reported.
+	if len(expired) != 1 || expired[0] != "bob" {
+		t.Errorf("expired = %v, expected [bob]", expired)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	c := Creds(map[string]string{"alice": "shhhh", "bob": "bobpass"})
+	h := NewHandler(c, http.HandlerFunc(handlerFuncOK), Quota(NewMemoryCounterStore(),
+		QuotaLimit{Requests: 2, Per: time.Hour},
+		QuotaLimit{Requests: 100, Per: 24 * time.Hour},
+	))
+
+	tests := []struct {
+		user, pass string
+		code       int
+	}{
+		{"alice", "shhhh", http.StatusOK},
+		{"alice", "shhhh", http.StatusOK},
+		{"alice", "shhhh", http.StatusTooManyRequests},
+		{"bob", "bobpass", http.StatusOK},
+		{"bob", "wrong", http.StatusUnauthorized}, // failures do not count
+		{"bob", "bobpass", http.StatusOK},
+		{"bob", "bobpass", http.StatusTooManyRequests},
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.SetBasicAuth(tt.user, tt.pass)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tt.code {
+			t.Errorf("[%d] rec.Code = %d, expected: %d", ii, rec.Code, tt.code)
+		}
+		if tt.code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Errorf("[%d] expected Retry-After header", ii)
+		}
+	}
+}
+
+func TestHostMux(t *testing.T) {
+	m := NewHostMux(http.HandlerFunc(handlerFuncOK))
+	m.Handle("a.example.com", Creds(map[string]string{"alice": "shhhh"}), "a")
+	m.Handle("*.example.com", Creds(map[string]string{"bob": "shhhh"}), "")
+	m.Handle("*.b.example.com", Creds(map[string]string{"carol": "shhhh"}), "b")
+	m.Handle("public.example.org", nil, "")
+
+	tests := []struct {
+		host      string
+		user      string
+		code      int
+		challenge string
+	}{
+		{"a.example.com", "alice", http.StatusOK, ""},
+		{"A.Example.com:8080", "alice", http.StatusOK, ""},
+		{"a.example.com", "bob", http.StatusUnauthorized, `Basic realm="a"`},
+		{"c.example.com", "bob", http.StatusOK, ""},
+		{"x.y.example.com", "bob", http.StatusOK, ""},
+		{"c.example.com", "alice", http.StatusUnauthorized, "Basic"},
+		{"x.b.example.com", "carol", http.StatusOK, ""},
+		{"x.b.example.com", "bob", http.StatusUnauthorized, `Basic realm="b"`},
+		{"example.com", "bob", http.StatusNotFound, ""},
+		{"public.example.org", "", http.StatusOK, ""},
+		{"other.org", "", http.StatusNotFound, ""},
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.Host = tt.host
+		if tt.user != "" {
+			r.SetBasicAuth(tt.user, "shhhh")
+		}
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("[%d] w.Code = %d, expected: %d", ii, w.Code, tt.code)
+		}
+		if got := w.Header().Get("WWW-Authenticate"); got != tt.challenge {
+			t.Errorf("[%d] WWW-Authenticate = %q, expected: %q", ii, got, tt.challenge)
+		}
+	}
+
+	m.Handle("*", nil, "")
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Host = "other.org"
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	tests := []struct {
+		format HashFormat
+		prefix string
+		length int
+	}{
+		{HashBcrypt, "$2y$10$", 60},
+		{HashAPR1, "$apr1$", 37},
+		{HashSHA, "{SHA}", 33},
+	}
+
+	for ii, tt := range tests {
+		h, err := HashPassword("password", tt.format)
+		if err != nil || !strings.HasPrefix(h, tt.prefix) || len(h) != tt.length {
+			t.Errorf("[%d] HashPassword() = %q, %v, expected %d characters with prefix %q", ii, h, err, tt.length, tt.prefix)
+		}
+	}
+	if h := mustHash(t, HashSHA); h != "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=" {
+		t.Errorf("HashPassword(HashSHA) = %q", h)
+	}
+	if h1, h2 := mustHash(t, HashAPR1), mustHash(t, HashAPR1); h1 == h2 {
+		t.Errorf("HashPassword(HashAPR1) returned %q twice, expected random salts", h1)
+	}
+	if _, err := HashPassword("password", HashFormat(-1)); err == nil {
+		t.Errorf("HashPassword() expected error for unknown format")
+	}
+}
+
+func TestBcryptHash(t *testing.T) {
+	// Published test vectors, from crypt_blowfish.
+	c := HashedCreds(map[string]string{
+		"U*U":   "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW",
+		"empty": "$2a$06$DCq7YPn5Rq63x1Lad4cll.TV4S6ytwfsfvkgY8jIucDrjc8deX1s.",
+	})
+	if !c.Check("U*U", "U*U") || c.Check("U*U", "U*V") || !c.Check("empty", "") {
+		t.Errorf("Check() failed for published bcrypt vectors")
+	}
+
+	h, err := BcryptHash("password", 4)
+	if err != nil || !strings.HasPrefix(h, "$2y$04$") || len(h) != 60 {
+		t.Fatalf("BcryptHash() = %q, %v", h, err)
+	}
+	if c := HashedCreds(map[string]string{"alice": h}); !c.Check("alice", "password") || c.Check("alice", "passwore") {
+		t.Errorf("HashedCreds did not verify BcryptHash() = %q", h)
+	}
+
+	long := strings.Repeat("x", 72)
+	h, _ = BcryptHash(long, 4)
+	if c := HashedCreds(map[string]string{"alice": h}); !c.Check("alice", long+"ignored") {
+		t.Errorf("bcrypt did not ignore bytes after 72")
+	}
+	for _, cost := range []int{3, 32} {
+		if _, err := BcryptHash("password", cost); err == nil {
+			t.Errorf("BcryptHash(%d) expected error", cost)
+		}
+	}
+}
+
+func mustHash(t *testing.T, f HashFormat) string {
+	h, err := HashPassword("password", f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return h
+}
+
+func TestSetHtpasswd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".htpasswd")
+	for _, e := range [][2]string{{"alice", "one"}, {"bob", "two"}, {"alice", "three"}} {
+		if err := SetHtpasswd(path, e[0], e[1]); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	b, _ := ioutil.ReadFile(path)
+	if got, expected := string(b), "alice:three\nbob:two\n"; got != expected {
+		t.Errorf("file = %q, expected: %q", got, expected)
+	}
+
+	os.WriteFile(path, []byte("# users\nbob:two"), 0644)
+	os.Chmod(path, 0644)
+	if err := SetHtpasswd(path, "carol", "four"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, _ = ioutil.ReadFile(path)
+	if got, expected := string(b), "# users\nbob:two\ncarol:four\n"; got != expected {
+		t.Errorf("file = %q, expected: %q", got, expected)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0644 {
+		t.Errorf("file mode = %v, %v, expected: %v", fi.Mode(), err, os.FileMode(0644))
+	}
+
+	for _, e := range [][2]string{{"", "x"}, {"a:b", "x"}, {"a\nb", "x"}, {"a", "x\ny"}} {
+		if err := SetHtpasswd(path, e[0], e[1]); err != ErrInvalidHtpasswdEntry {
+			t.Errorf("SetHtpasswd(%q, %q) = %v, expected: %v", e[0], e[1], err, ErrInvalidHtpasswdEntry)
+		}
+	}
+}
+
+func TestHashedCreds(t *testing.T) {
+	m := map[string]string{
+		"apr1":   "$apr1$r31....$gnsoqlxyxQQ0Ot5JCwiei.",
+		"apr1s":  "$apr1$abc$PZF73YJz5hJ9yyI.7OP.R.",
+		"md5":    "$1$xy$SoH7aQ37.uvNLAlzHd7OC/",
+		"bcrypt": "$2b$05$CCCCCCCCCCCCCCCCCCCCC.Xn7FSvv79c6bu/kgV/.kBlx/ChE9.FW",
+		"sha":    "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=",
+		"sha256": "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5",
+		"sha512": "$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+		"long5":  "$5$rounds=10000$saltstringsaltst$gvY72qBEBFNYX0qCiTj4gvVzpRTtel5YtJ3D5pBhfD4",
+		"long6":  "$6$saltstring$NR4jYXbyrMczRbWRGzvOTe4TmijBsNK4A3GSrUKfsmLRZdIq7CH..cd5Zif7zGxv007/zu17UhexqrLxAJL.n1",
+		"nosalt": "$6$$qVM5YO2OAq5dAN8UGZg61YCZCI6pGkhe7/QiIZLXp6X2v/ukH.8R68jrd0LvfUdPf.q1ZKpFRqp3ZOt6yx3Lg1",
+		"badsha": "$5$rounds=x$salt$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5",
+		"plain":  "secret",
+		"broken": "$apr1$nosalt",
+	}
+	tests := []struct {
+		user, pass string
+		expected   bool
+	}{
+		{"apr1", "secret", true},
+		{"apr1", "Secret", false},
+		{"apr1s", "secret", true},
+		{"md5", "a much longer password of more than sixteen bytes", true},
+		{"md5", "a much longer password of more than sixteen bytes!", false},
+		{"bcrypt", "x", true},
+		{"bcrypt", "y", false},
+		{"sha", "password", true},
+		{"sha", "passwore", false},
+		{"sha256", "Hello world!", true},
+		{"sha256", "Hello world?", false},
+		{"sha512", "Hello world!", true},
+		{"sha512", "Hello world?", false},
+		{"long5", "Hello world! This is a longer password than the digest.", true},
+		{"long6", "Hello world! This is a longer password than the digest.", true},
+		{"nosalt", "Hello world! This is a longer password than the digest.", true},
+		{"badsha", "Hello world!", false},
+		{"plain", "secret", false},
+		{"broken", "", false},
+		{"unknown", "password", false},
+	}
+
+	c := HashedCreds(m)
+	for ii, tt := range tests {
+		if got := c.Check(tt.user, tt.pass); got != tt.expected {
+			t.Errorf("[%d] Check(%q, %q) = %v, expected: %v", ii, tt.user, tt.pass, got, tt.expected)
+		}
+	}
+	for _, f := range []HashFormat{HashBcrypt, HashAPR1, HashSHA} {
+		if c := HashedCreds(map[string]string{"alice": mustHash(t, f)}); !c.Check("alice", "password") || c.Check("alice", "passwore") {
+			t.Errorf("HashedCreds did not verify HashPassword(%v)", f)
+		}
+	}
+}
+
+func TestHashedCredsUnknownUserTiming(t *testing.T) {
+	c := HashedCreds(map[string]string{
+		"apr1":   "$apr1$r31....$gnsoqlxyxQQ0Ot5JCwiei.",
+		"bcrypt": "$2b$08$CCCCCCCCCCCCCCCCCCCCC.6HCsLaleEcDL9OPNKQ9MJBSrXoOnj2C",
+	})
+	if !c.Check("bcrypt", "password") {
+		t.Fatalf("Check() = false for valid bcrypt user")
+	}
+	fastest := func(user string) time.Duration {
+		var d time.Duration
+		for i := 0; i < 3; i++ {
+			start := time.Now()
+			c.Check(user, "wrong")
+			if e := time.Since(start); i == 0 || e < d {
+				d = e
+			}
+		}
+		return d
+	}
+	known, unknown := fastest("bcrypt"), fastest("unknown")
+	t.Logf("bcrypt user: %v, unknown user: %v", known, unknown)
+	if unknown < known/2 {
+		t.Errorf("unknown user took %v, expected about as long as bcrypt user (%v)", unknown, known)
+	}
+}
+
+func TestHtpasswdFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".htpasswd")
+	os.WriteFile(path, []byte("# comment\n\nalice:$apr1$r31....$gnsoqlxyxQQ0Ot5JCwiei.\nbogus\n"), 0600)
+	c, err := HtpasswdFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !c.Check("alice", "secret") || c.Check("bob", "password") {
+		t.Errorf("Check() did not use the file entries")
+	}
+
+	if err := SetHtpasswd(path, "bob", mustHash(t, HashAPR1)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !c.Check("bob", "password") || !c.Check("alice", "secret") {
+		t.Errorf("Check() did not use the updated file entries")
+	}
+
+	os.Remove(path)
+	if !c.Check("bob", "password") {
+		t.Errorf("Check() did not keep the previous entries")
+	}
+	if _, err := HtpasswdFile(path); err == nil {
+		t.Errorf("HtpasswdFile() expected error for missing file")
+	}
+}
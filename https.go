@@ -0,0 +1,64 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RequireHTTPS configures the handler to refuse to authenticate requests made over
+// plaintext HTTP, so that credentials are never sent in the clear.  If redirect is true
+// then such requests are redirected to the same URL using https, otherwise they are
+// rejected with http.StatusUpgradeRequired.  Requests received from a trusted proxy (see
+// TrustedProxies) are considered secure if the proxy set X-Forwarded-Proto (or the proto
+// parameter of Forwarded) to https.  Exempt requests are not affected.
+func RequireHTTPS(redirect bool) Option {
+	return func(h *handler) {
+		h.requireHTTPS = true
+		h.redirectHTTPS = redirect
+	}
+}
+
+// insecure responds to a request which was made over plaintext HTTP.
+func (h *handler) insecure(w http.ResponseWriter, r *http.Request) {
+	if h.redirectHTTPS {
+		u := *r.URL
+		u.Scheme, u.Host = "https", r.Host
+		http.Redirect(w, r, u.String(), http.StatusPermanentRedirect)
+		return
+	}
+	w.Header().Set("Upgrade", "TLS/1.2, HTTP/1.1")
+	w.Header().Set("Connection", "Upgrade")
+	writeError(w, r, http.StatusUpgradeRequired)
+}
+
+// IsHTTPS returns true if r was made over HTTPS, either directly or (if r was received
+// from a trusted proxy) as reported by the X-Forwarded-Proto or Forwarded headers.
+func (res *IPResolver) IsHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if res == nil || !res.isTrusted(remoteIP(r)) {
+		return false
+	}
+	if v := r.Header.Values("X-Forwarded-Proto"); len(v) > 0 {
+		// The value added by the nearest proxy is last.
+		protos := strings.Split(v[len(v)-1], ",")
+		return strings.EqualFold(strings.TrimSpace(protos[len(protos)-1]), "https")
+	}
+	proto := ""
+	for _, v := range r.Header.Values("Forwarded") {
+		for _, elem := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				pair = strings.TrimSpace(pair)
+				if len(pair) > 6 && strings.EqualFold(pair[:6], "proto=") {
+					proto = strings.Trim(pair[6:], `"`)
+				}
+			}
+		}
+	}
+	return strings.EqualFold(proto, "https")
+}
@@ -0,0 +1,145 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTokenInactive is returned by Introspection when the authorization server reports
+// that a token is not active (e.g. it has expired or been revoked).
+var ErrTokenInactive = errors.New("httpauth: token is not active")
+
+// Introspection is a TokenChecker which validates opaque tokens using an OAuth 2.0 token
+// introspection endpoint (RFC 7662), for authorization servers which do not issue JWTs.
+// The introspection response members (e.g. sub, scope and exp) are returned as the token
+// Claims.
+type Introspection struct {
+	// URL is the introspection endpoint.
+	URL string
+
+	// ClientID and ClientSecret are sent as basic HTTP authentication credentials
+	// when calling the introspection endpoint.
+	ClientID, ClientSecret string
+
+	// Client is used to call the introspection endpoint.  If nil, http.DefaultClient
+	// is used.
+	Client *http.Client
+
+	// CacheTTL, if non-zero, is how long active tokens are cached before being checked
+	// again (never beyond their exp).  Inactive tokens are never cached.
+	CacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]introspectionEntry
+	swept time.Time
+}
+
+type introspectionEntry struct {
+	claims  Claims
+	expires time.Time
+}
+
+// CheckToken implements TokenChecker.
+func (i *Introspection) CheckToken(token string) (Claims, error) {
+	key := HashKey(token)
+	if claims, ok := i.cached(key); ok {
+		return claims, nil
+	}
+
+	claims, err := i.introspect(token)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	exp, hasExp := claims.time("exp")
+	if hasExp && !now.Before(exp) {
+		return nil, ErrTokenExpired
+	}
+
+	if i.CacheTTL > 0 {
+		expires := now.Add(i.CacheTTL)
+		if hasExp && exp.Before(expires) {
+			expires = exp
+		}
+		i.store(key, claims, expires)
+	}
+	return claims, nil
+}
+
+// cached returns the cached claims for the token digest key.
+func (i *Introspection) cached(key string) (Claims, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	e, ok := i.cache[key]
+	if !ok || !time.Now().Before(e.expires) {
+		return nil, false
+	}
+	return e.claims, true
+}
+
+// store caches the claims for the token digest key until expires.
+func (i *Introspection) store(key string, claims Claims, expires time.Time) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	now := time.Now()
+	if i.cache == nil {
+		i.cache = make(map[string]introspectionEntry)
+	}
+	if now.Sub(i.swept) > time.Minute {
+		for k, e := range i.cache {
+			if !now.Before(e.expires) {
+				delete(i.cache, k)
+			}
+		}
+		i.swept = now
+	}
+	i.cache[key] = introspectionEntry{claims: claims, expires: expires}
+}
+
+// introspect calls the introspection endpoint for the token.
+func (i *Introspection) introspect(token string) (Claims, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequest("POST", i.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if i.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(i.ClientID), url.QueryEscape(i.ClientSecret))
+	}
+
+	client := i.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("httpauth: introspecting token: unexpected status %v", resp.Status)
+	}
+
+	var claims Claims
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("httpauth: decoding introspection response: %v", err)
+	}
+	if active, _ := claims["active"].(bool); !active {
+		return nil, ErrTokenInactive
+	}
+	return claims, nil
+}
@@ -0,0 +1,267 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// jwksMinRefresh is the minimum time between fetches triggered by tokens with unknown
+// key IDs.
+const jwksMinRefresh = 30 * time.Second
+
+// jwksTimeout is the timeout of the http.Client used by NewJWKS if none is given.
+const jwksTimeout = 10 * time.Second
+
+// JWKS is a KeySource which fetches keys from a JSON Web Key Set URL.  Keys are cached
+// and refreshed in the background, and a token signed with an unknown key ID triggers
+// an immediate (rate-limited) refresh so that rotated keys are picked up.
+type JWKS struct {
+	url    string
+	client *http.Client
+
+	fetchMu   sync.Mutex // serialises fetches, and guards attempted
+	attempted time.Time  // time of the last fetch, successful or not
+
+	mu   sync.RWMutex
+	keys []jwk
+
+	done chan struct{}
+	once sync.Once
+}
+
+type jwk struct {
+	kid, alg string
+	key      interface{}
+}
+
+// NewJWKS creates a JWKS which fetches keys from url using the http.Client (if nil, a
+// client with a 10 second timeout is used) and refreshes them every interval (no
+// background refresh if interval is zero).  An error is returned if the initial fetch
+// fails.  Call Close to stop background refreshes.
+func NewJWKS(url string, client *http.Client, interval time.Duration) (*JWKS, error) {
+	if client == nil {
+		client = &http.Client{Timeout: jwksTimeout}
+	}
+	k := &JWKS{
+		url:    url,
+		client: client,
+		done:   make(chan struct{}),
+	}
+	if err := k.Refresh(); err != nil {
+		return nil, err
+	}
+	if interval > 0 {
+		go k.refreshLoop(interval)
+	}
+	return k, nil
+}
+
+func (k *JWKS) refreshLoop(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			// On failure keep the existing keys and try again next time.
+			k.Refresh()
+		case <-k.done:
+			return
+		}
+	}
+}
+
+// Close stops background refreshes.
+func (k *JWKS) Close() {
+	k.once.Do(func() { close(k.done) })
+}
+
+// Refresh fetches the key set, replacing the cached keys.
+func (k *JWKS) Refresh() error {
+	k.fetchMu.Lock()
+	defer k.fetchMu.Unlock()
+	return k.fetch()
+}
+
+// fetch fetches the key set, replacing the cached keys.  k.fetchMu must be held.
+func (k *JWKS) fetch() error {
+	k.attempted = time.Now()
+	resp, err := k.client.Get(k.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("httpauth: fetching JWKS from %v: unexpected status %v", k.url, resp.Status)
+	}
+
+	keys, err := parseJWKS(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+// Key implements KeySource.
+func (k *JWKS) Key(alg, kid string) (interface{}, error) {
+	if key, ok := k.lookup(alg, kid); ok {
+		return key, nil
+	}
+
+	// Fetch at most once per jwksMinRefresh (including failed fetches), however many
+	// requests are waiting: they all use the result.
+	k.fetchMu.Lock()
+	var err error
+	if time.Since(k.attempted) >= jwksMinRefresh {
+		err = k.fetch()
+	}
+	k.fetchMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := k.lookup(alg, kid); ok {
+		return key, nil
+	}
+	return nil, ErrTokenUnknownKey
+}
+
+// lookup finds the cached key for alg and kid.  If kid is empty then a key is only
+// returned if exactly one cached key is suitable for alg.
+func (k *JWKS) lookup(alg, kid string) (interface{}, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	var found interface{}
+	n := 0
+	for _, x := range k.keys {
+		if x.alg != "" && x.alg != alg {
+			continue
+		}
+		if !keyMatchesAlg(x.key, alg) {
+			continue
+		}
+		if kid != "" {
+			if x.kid == kid {
+				return x.key, true
+			}
+			continue
+		}
+		found = x.key
+		n++
+	}
+	return found, n == 1
+}
+
+// keyMatchesAlg returns true if key is of the type required by alg.
+func keyMatchesAlg(key interface{}, alg string) bool {
+	switch key.(type) {
+	case []byte:
+		return alg == "HS256"
+	case *rsa.PublicKey:
+		return alg == "RS256"
+	case *ecdsa.PublicKey:
+		return alg == "ES256"
+	}
+	return false
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Elliptic curve
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+
+	// Symmetric
+	K string `json:"k,omitempty"`
+}
+
+// parseJWKS decodes a JSON Web Key Set, ignoring keys which are not signing keys or
+// are of an unsupported type.
+func parseJWKS(r io.Reader) ([]jwk, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(r).Decode(&set); err != nil {
+		return nil, fmt.Errorf("httpauth: decoding JWKS: %v", err)
+	}
+
+	keys := make([]jwk, 0, len(set.Keys))
+	for _, x := range set.Keys {
+		if x.Use != "" && x.Use != "sig" {
+			continue
+		}
+		key, err := x.publicKey()
+		if err != nil {
+			continue
+		}
+		keys = append(keys, jwk{kid: x.Kid, alg: x.Alg, key: key})
+	}
+	return keys, nil
+}
+
+// publicKey returns the key used for signature verification.
+func (x jsonWebKey) publicKey() (interface{}, error) {
+	switch x.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(x.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(x.E)
+		if err != nil {
+			return nil, err
+		}
+		ev := new(big.Int).SetBytes(e)
+		if ev.BitLen() > 31 {
+			return nil, fmt.Errorf("httpauth: invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(ev.Int64())}, nil
+
+	case "EC":
+		if x.Crv != "P-256" {
+			return nil, fmt.Errorf("httpauth: unsupported curve %q", x.Crv)
+		}
+		xb, err := base64.RawURLEncoding.DecodeString(x.X)
+		if err != nil {
+			return nil, err
+		}
+		yb, err := base64.RawURLEncoding.DecodeString(x.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(xb), Y: new(big.Int).SetBytes(yb)}
+		if len(xb) != 32 || len(yb) != 32 || !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("httpauth: invalid EC public key")
+		}
+		return pub, nil
+
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(x.K)
+	}
+	return nil, fmt.Errorf("httpauth: unsupported key type %q", x.Kty)
+}
@@ -0,0 +1,307 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Errors returned when validating JSON Web Tokens.
+var (
+	ErrTokenMalformed      = errors.New("httpauth: malformed token")
+	ErrTokenUnsupportedAlg = errors.New("httpauth: unsupported token signing algorithm")
+	ErrTokenSignature      = errors.New("httpauth: invalid token signature")
+	ErrTokenUnknownKey     = errors.New("httpauth: unknown token signing key")
+	ErrTokenExpired        = errors.New("httpauth: token has expired")
+	ErrTokenNotYetValid    = errors.New("httpauth: token is not yet valid")
+	ErrTokenIssuer         = errors.New("httpauth: invalid token issuer")
+	ErrTokenAudience       = errors.New("httpauth: invalid token audience")
+	ErrTokenInvalid        = errors.New("httpauth: invalid token")
+)
+
+// Claims is the set of claims decoded from a JWT payload.
+type Claims map[string]interface{}
+
+// Subject returns the "sub" claim, or the empty string if it is not set.
+func (c Claims) Subject() string {
+	s, _ := c["sub"].(string)
+	return s
+}
+
+// Issuer returns the "iss" claim, or the empty string if it is not set.
+func (c Claims) Issuer() string {
+	s, _ := c["iss"].(string)
+	return s
+}
+
+// Audience returns the "aud" claim, which may be either a single string or an array
+// of strings.
+func (c Claims) Audience() []string {
+	switch v := c["aud"].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		aud := make([]string, 0, len(v))
+		for _, x := range v {
+			if s, ok := x.(string); ok {
+				aud = append(aud, s)
+			}
+		}
+		return aud
+	}
+	return nil
+}
+
+// Scopes returns the scopes granted by the "scope" claim (a space-separated string, RFC
+// 8693), or if that is not set, the "scp" claim (a string or array of strings).
+func (c Claims) Scopes() []string {
+	if s, ok := c["scope"].(string); ok {
+		return strings.Fields(s)
+	}
+	switch v := c["scp"].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		scopes := make([]string, 0, len(v))
+		for _, x := range v {
+			if s, ok := x.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+		return scopes
+	}
+	return nil
+}
+
+// time returns the NumericDate claim with the given name.
+func (c Claims) time(name string) (time.Time, bool) {
+	v, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(v), 0), true
+}
+
+// KeySource defines the Key method which provides keys for verifying JWT signatures.
+type KeySource interface {
+	// Key returns the key for verifying signatures made using the algorithm alg, where
+	// kid is the key ID from the token header (empty if not set).  HS256 keys must be
+	// []byte, RS256 keys must be *rsa.PublicKey and ES256 keys must be *ecdsa.PublicKey.
+	Key(alg, kid string) (interface{}, error)
+}
+
+// HMACKey is a KeySource which provides a shared secret for HS256 tokens.
+type HMACKey []byte
+
+// Key implements KeySource.
+func (k HMACKey) Key(alg, kid string) (interface{}, error) {
+	if alg != "HS256" {
+		return nil, ErrTokenUnsupportedAlg
+	}
+	return []byte(k), nil
+}
+
+// RSAKey creates a KeySource which provides the public key for RS256 tokens.
+func RSAKey(pub *rsa.PublicKey) KeySource {
+	return rsaKey{pub}
+}
+
+type rsaKey struct {
+	pub *rsa.PublicKey
+}
+
+// Key implements KeySource.
+func (k rsaKey) Key(alg, kid string) (interface{}, error) {
+	if alg != "RS256" {
+		return nil, ErrTokenUnsupportedAlg
+	}
+	return k.pub, nil
+}
+
+// JWT is a TokenChecker which validates JSON Web Tokens signed using HS256, RS256 or
+// ES256, checking the signature and the exp, nbf, iss and aud claims.
+type JWT struct {
+	// Keys provides the keys used to verify token signatures.
+	Keys KeySource
+
+	// Issuer, if non-empty, is the required value of the iss claim.
+	Issuer string
+
+	// Audience, if non-empty, must be one of the values of the aud claim.
+	Audience string
+
+	// Leeway is the allowance for clock skew when checking exp and nbf.
+	Leeway time.Duration
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// CheckToken implements TokenChecker.
+func (j *JWT) CheckToken(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+
+	var hdr jwtHeader
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	key, err := j.Keys.Key(hdr.Alg, hdr.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(hdr.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if exp, ok := claims.time("exp"); ok && !now.Before(exp.Add(j.Leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if nbf, ok := claims.time("nbf"); ok && now.Add(j.Leeway).Before(nbf) {
+		return nil, ErrTokenNotYetValid
+	}
+	if j.Issuer != "" && claims.Issuer() != j.Issuer {
+		return nil, ErrTokenIssuer
+	}
+	if j.Audience != "" && !containsString(claims.Audience(), j.Audience) {
+		return nil, ErrTokenAudience
+	}
+	return claims, nil
+}
+
+func containsString(l []string, s string) bool {
+	for _, x := range l {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes the base64url-encoded JSON token segment s into v.
+func decodeSegment(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return ErrTokenMalformed
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return ErrTokenMalformed
+	}
+	return nil
+}
+
+// verifySignature checks that sig is a valid signature of signed using the algorithm
+// alg and key.
+func verifySignature(alg string, key interface{}, signed string, sig []byte) error {
+	switch alg {
+	case "HS256":
+		k, ok := key.([]byte)
+		if !ok {
+			return ErrTokenUnsupportedAlg
+		}
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrTokenSignature
+		}
+		return nil
+
+	case "RS256":
+		k, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrTokenUnsupportedAlg
+		}
+		h := sha256.Sum256([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], sig); err != nil {
+			return ErrTokenSignature
+		}
+		return nil
+
+	case "ES256":
+		k, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrTokenUnsupportedAlg
+		}
+		// JWS ECDSA signatures are the concatenated r and s values (RFC 7518 section 3.4).
+		if len(sig) != 64 {
+			return ErrTokenSignature
+		}
+		h := sha256.Sum256([]byte(signed))
+		if !ecdsa.Verify(k, h[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			return ErrTokenSignature
+		}
+		return nil
+	}
+	return ErrTokenUnsupportedAlg
+}
+
+// signJWT encodes the claims as a JWT signed using key, which must be []byte (HS256)
+// or *rsa.PrivateKey (RS256).  The kid header is set if non-empty.
+func signJWT(key interface{}, kid string, claims Claims) (string, error) {
+	hdr := map[string]string{"typ": "JWT"}
+	if kid != "" {
+		hdr["kid"] = kid
+	}
+
+	var sign func(signed []byte) ([]byte, error)
+	switch k := key.(type) {
+	case []byte:
+		hdr["alg"] = "HS256"
+		sign = func(signed []byte) ([]byte, error) {
+			mac := hmac.New(sha256.New, k)
+			mac.Write(signed)
+			return mac.Sum(nil), nil
+		}
+	case *rsa.PrivateKey:
+		hdr["alg"] = "RS256"
+		sign = func(signed []byte) ([]byte, error) {
+			h := sha256.Sum256(signed)
+			return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, h[:])
+		}
+	default:
+		return "", ErrTokenUnsupportedAlg
+	}
+
+	h, err := json.Marshal(hdr)
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	sig, err := sign([]byte(signed))
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
@@ -0,0 +1,627 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth_test
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/dhowden/httpauth"
+)
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("unexpected error encoding token segment: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signHS256(t *testing.T, key []byte, hdr, claims map[string]interface{}) string {
+	signed := encodeSegment(t, hdr) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, hdr, claims map[string]interface{}) string {
+	signed := encodeSegment(t, hdr) + "." + encodeSegment(t, claims)
+	h := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	if err != nil {
+		t.Fatalf("unexpected error signing token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTHS256(t *testing.T) {
+	key := []byte("secret")
+	hdr := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	now := time.Now().Unix()
+
+	tests := []struct {
+		token string
+		err   error
+	}{
+		// Valid, no expiry
+		{
+			signHS256(t, key, hdr, map[string]interface{}{"sub": "alice"}),
+			nil,
+		},
+
+		// Valid, not expired
+		{
+			signHS256(t, key, hdr, map[string]interface{}{"sub": "alice", "exp": now + 60, "nbf": now - 60}),
+			nil,
+		},
+
+		// Expired
+		{
+			signHS256(t, key, hdr, map[string]interface{}{"sub": "alice", "exp": now - 60}),
+			ErrTokenExpired,
+		},
+
+		// Not yet valid
+		{
+			signHS256(t, key, hdr, map[string]interface{}{"sub": "alice", "nbf": now + 60}),
+			ErrTokenNotYetValid,
+		},
+
+		// Wrong key
+		{
+			signHS256(t, []byte("wrong"), hdr, map[string]interface{}{"sub": "alice"}),
+			ErrTokenSignature,
+		},
+
+		// Unsupported algorithm
+		{
+			signHS256(t, key, map[string]interface{}{"alg": "none"}, map[string]interface{}{"sub": "alice"}),
+			ErrTokenUnsupportedAlg,
+		},
+
+		// Malformed
+		{
+			"not.a-token",
+			ErrTokenMalformed,
+		},
+	}
+
+	j := &JWT{Keys: HMACKey(key)}
+	for ii, tt := range tests {
+		claims, err := j.CheckToken(tt.token)
+		if err != tt.err {
+			t.Errorf("[%d] j.CheckToken() error = %v, expected %v", ii, err, tt.err)
+			continue
+		}
+		if err == nil && claims.Subject() != "alice" {
+			t.Errorf("[%d] claims.Subject() = %q, expected %q", ii, claims.Subject(), "alice")
+		}
+	}
+}
+
+func TestJWTRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	hdr := map[string]interface{}{"alg": "RS256"}
+	token := signRS256(t, key, hdr, map[string]interface{}{"sub": "bob"})
+
+	j := &JWT{Keys: RSAKey(&key.PublicKey)}
+	claims, err := j.CheckToken(token)
+	if err != nil {
+		t.Fatalf("j.CheckToken() returned unexpected error: %v", err)
+	}
+	if claims.Subject() != "bob" {
+		t.Errorf("claims.Subject() = %q, expected %q", claims.Subject(), "bob")
+	}
+
+	// An HS256 token must not be accepted by an RS256 key source.
+	token = signHS256(t, []byte("secret"), map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "bob"})
+	if _, err := j.CheckToken(token); err != ErrTokenUnsupportedAlg {
+		t.Errorf("j.CheckToken() error = %v, expected %v", err, ErrTokenUnsupportedAlg)
+	}
+}
+
+func TestBearerHandler(t *testing.T) {
+	key := []byte("secret")
+	token := signHS256(t, key, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "alice"})
+
+	var got Claims
+	h := NewBearerHandler(&JWT{Keys: HMACKey(key)}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = ClaimsFromContext(r.Context())
+		handlerFuncOK(w, r)
+	}))
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+	if w.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("w.Header().Get(\"WWW-Authenticate\") = %s, expected: %s", w.Header().Get("WWW-Authenticate"), "Bearer")
+	}
+
+	r.Header.Set("Authorization", "Bearer "+signHS256(t, key, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"exp": 1}))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got, expected := w.Header().Get("WWW-Authenticate"), `Bearer error="invalid_token", error_description="token has expired"`; got != expected {
+		t.Errorf("w.Header().Get(\"WWW-Authenticate\") = %s, expected: %s", got, expected)
+	}
+
+	r.Header.Set("Authorization", "Bearer not.a-token")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if got, expected := w.Header().Get("WWW-Authenticate"), `Bearer error="invalid_token", error_description="malformed token"`; got != expected {
+		t.Errorf("w.Header().Get(\"WWW-Authenticate\") = %s, expected: %s", got, expected)
+	}
+
+	r.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusOK)
+	}
+	if got.Subject() != "alice" {
+		t.Errorf("claims.Subject() = %q, expected %q", got.Subject(), "alice")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+
+	var fetches int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]interface{}{
+				{
+					"kty": "RSA",
+					"kid": "one",
+					"use": "sig",
+					"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+				},
+				{
+					"kty": "oct",
+					"kid": "two",
+					"k":   base64.RawURLEncoding.EncodeToString([]byte("secret")),
+				},
+			},
+		})
+	}))
+	defer s.Close()
+
+	keys, err := NewJWKS(s.URL, nil, time.Hour)
+	if err != nil {
+		t.Fatalf("NewJWKS() returned unexpected error: %v", err)
+	}
+	defer keys.Close()
+
+	j := &JWT{Keys: keys}
+	tests := []struct {
+		token string
+		err   error
+	}{
+		{
+			signRS256(t, key, map[string]interface{}{"alg": "RS256", "kid": "one"}, map[string]interface{}{}),
+			nil,
+		},
+		{
+			signHS256(t, []byte("secret"), map[string]interface{}{"alg": "HS256", "kid": "two"}, map[string]interface{}{}),
+			nil,
+		},
+
+		// Key ID refers to a key of the wrong type
+		{
+			signHS256(t, []byte("secret"), map[string]interface{}{"alg": "HS256", "kid": "one"}, map[string]interface{}{}),
+			ErrTokenUnknownKey,
+		},
+
+		// Unknown key ID
+		{
+			signRS256(t, key, map[string]interface{}{"alg": "RS256", "kid": "three"}, map[string]interface{}{}),
+			ErrTokenUnknownKey,
+		},
+	}
+
+	for ii, tt := range tests {
+		if _, err := j.CheckToken(tt.token); err != tt.err {
+			t.Errorf("[%d] j.CheckToken() error = %v, expected %v", ii, err, tt.err)
+		}
+	}
+
+	// A burst of tokens with unknown key IDs does not trigger a fetch each.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keys.Key("RS256", fmt.Sprintf("unknown-%d", i))
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("key set fetched %d times, expected: 1", n)
+	}
+}
+
+func TestOIDC(t *testing.T) {
+	key := []byte("secret")
+
+	var issuer string
+	m := http.NewServeMux()
+	m.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":   issuer,
+			"jwks_uri": issuer + "/keys",
+		})
+	})
+	m.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]interface{}{
+				{"kty": "oct", "k": base64.RawURLEncoding.EncodeToString(key)},
+			},
+		})
+	})
+	s := httptest.NewServer(m)
+	defer s.Close()
+	issuer = s.URL
+
+	j, err := NewOIDC(issuer, "api", nil)
+	if err != nil {
+		t.Fatalf("NewOIDC() returned unexpected error: %v", err)
+	}
+	defer j.Keys.(*JWKS).Close()
+
+	hdr := map[string]interface{}{"alg": "HS256"}
+	tests := []struct {
+		claims map[string]interface{}
+		err    error
+	}{
+		{
+			map[string]interface{}{"iss": issuer, "aud": "api"},
+			nil,
+		},
+		{
+			map[string]interface{}{"iss": issuer, "aud": []string{"other", "api"}},
+			nil,
+		},
+		{
+			map[string]interface{}{"iss": "https://example.com", "aud": "api"},
+			ErrTokenIssuer,
+		},
+		{
+			map[string]interface{}{"iss": issuer, "aud": "other"},
+			ErrTokenAudience,
+		},
+	}
+
+	for ii, tt := range tests {
+		if _, err := j.CheckToken(signHS256(t, key, hdr, tt.claims)); err != tt.err {
+			t.Errorf("[%d] j.CheckToken() error = %v, expected %v", ii, err, tt.err)
+		}
+	}
+}
+
+func TestTokenHandler(t *testing.T) {
+	key := []byte("secret")
+	i := &TokenIssuer{
+		Key:      key,
+		Issuer:   "https://auth.example.com",
+		Audience: "api",
+		TTL:      time.Minute,
+		Claims: func(username string) Claims {
+			return Claims{"role": "admin", "sub": "ignored"}
+		},
+	}
+	h := NewTokenHandler(Creds(map[string]string{"alice": "shhhh"}), i)
+
+	tests := []struct {
+		method, user, pass string
+		code               int
+	}{
+		{"GET", "alice", "shhhh", http.StatusMethodNotAllowed},
+		{"POST", "", "", http.StatusUnauthorized},
+		{"POST", "alice", "wrong", http.StatusUnauthorized},
+		{"POST", "alice", "shhhh", http.StatusOK},
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest(tt.method, "/token", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		if tt.user != "" {
+			r.SetBasicAuth(tt.user, tt.pass)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("[%d] w.Code = %d, expected: %d", ii, w.Code, tt.code)
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+
+		var resp struct {
+			AccessToken string `json:"access_token"`
+			TokenType   string `json:"token_type"`
+			ExpiresIn   int64  `json:"expires_in"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("[%d] unexpected error decoding response: %v", ii, err)
+		}
+		if resp.TokenType != "Bearer" || resp.ExpiresIn != 60 {
+			t.Errorf("[%d] token_type = %q, expires_in = %d, expected %q, %d", ii, resp.TokenType, resp.ExpiresIn, "Bearer", 60)
+		}
+		claims, err := (&JWT{Keys: HMACKey(key), Issuer: i.Issuer, Audience: "api"}).CheckToken(resp.AccessToken)
+		if err != nil {
+			t.Fatalf("[%d] CheckToken() returned unexpected error: %v", ii, err)
+		}
+		if claims.Subject() != "alice" || claims["role"] != "admin" {
+			t.Errorf("[%d] claims = %v, expected sub alice and role admin", ii, claims)
+		}
+	}
+}
+
+func TestTokenIssuerRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	token, err := (&TokenIssuer{Key: key, KeyID: "one"}).Issue("bob")
+	if err != nil {
+		t.Fatalf("Issue() returned unexpected error: %v", err)
+	}
+	claims, err := (&JWT{Keys: RSAKey(&key.PublicKey)}).CheckToken(token)
+	if err != nil {
+		t.Fatalf("CheckToken() returned unexpected error: %v", err)
+	}
+	if claims.Subject() != "bob" {
+		t.Errorf("claims.Subject() = %q, expected %q", claims.Subject(), "bob")
+	}
+}
+
+func TestRefreshHandler(t *testing.T) {
+	i := &TokenIssuer{Key: []byte("secret"), Refresh: NewMemoryTokenStore()}
+	login := NewTokenHandler(Creds(map[string]string{"alice": "shhhh"}), i)
+	refresh := NewRefreshHandler(i)
+
+	type tokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	do := func(h http.Handler, r *http.Request) (int, tokens) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		var resp tokens
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("unexpected error decoding response: %v", err)
+			}
+		}
+		return w.Code, resp
+	}
+	refreshWith := func(token string) (int, tokens) {
+		r, err := http.NewRequest("POST", "/token/refresh", strings.NewReader(url.Values{"refresh_token": {token}}.Encode()))
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return do(refresh, r)
+	}
+
+	r, err := http.NewRequest("POST", "/token", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	r.SetBasicAuth("alice", "shhhh")
+	code, first := do(login, r)
+	if code != http.StatusOK || first.RefreshToken == "" {
+		t.Fatalf("login: code = %d, refresh_token = %q", code, first.RefreshToken)
+	}
+
+	code, second := refreshWith(first.RefreshToken)
+	if code != http.StatusOK || second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh: code = %d, refresh_token = %q", code, second.RefreshToken)
+	}
+	if _, err := (&JWT{Keys: HMACKey("secret")}).CheckToken(second.AccessToken); err != nil {
+		t.Errorf("CheckToken() returned unexpected error: %v", err)
+	}
+
+	// Refresh tokens are single use.
+	if code, _ := refreshWith(first.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("reused refresh: code = %d, expected: %d", code, http.StatusUnauthorized)
+	}
+
+	if err := i.RevokeUser("alice"); err != nil {
+		t.Fatalf("RevokeUser() returned unexpected error: %v", err)
+	}
+	if code, _ := refreshWith(second.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("revoked refresh: code = %d, expected: %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestKeyRing(t *testing.T) {
+	one, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	two, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+
+	ring, err := NewKeyRing("one", one)
+	if err != nil {
+		t.Fatalf("NewKeyRing() returned unexpected error: %v", err)
+	}
+	i := &TokenIssuer{KeyRing: ring}
+	old, err := i.Issue("alice")
+	if err != nil {
+		t.Fatalf("Issue() returned unexpected error: %v", err)
+	}
+
+	if err := ring.Rotate("two", two); err != nil {
+		t.Fatalf("Rotate() returned unexpected error: %v", err)
+	}
+	if err := ring.Rotate("two", two); err != ErrKeyExists {
+		t.Errorf("Rotate() error = %v, expected %v", err, ErrKeyExists)
+	}
+	current, err := i.Issue("alice")
+	if err != nil {
+		t.Fatalf("Issue() returned unexpected error: %v", err)
+	}
+
+	// Verify using the published key set, as another service would.
+	s := httptest.NewServer(ring)
+	defer s.Close()
+	keys, err := NewJWKS(s.URL, nil, 0)
+	if err != nil {
+		t.Fatalf("NewJWKS() returned unexpected error: %v", err)
+	}
+	for _, j := range []*JWT{{Keys: ring}, {Keys: keys}} {
+		for _, token := range []string{old, current} {
+			if _, err := j.CheckToken(token); err != nil {
+				t.Errorf("CheckToken() returned unexpected error: %v", err)
+			}
+		}
+	}
+
+	if err := ring.Retire("two"); err != ErrKeyCurrent {
+		t.Errorf("Retire() error = %v, expected %v", err, ErrKeyCurrent)
+	}
+	if err := ring.Retire("one"); err != nil {
+		t.Fatalf("Retire() returned unexpected error: %v", err)
+	}
+	j := &JWT{Keys: ring}
+	if _, err := j.CheckToken(old); err != ErrTokenUnknownKey {
+		t.Errorf("CheckToken() error = %v, expected %v", err, ErrTokenUnknownKey)
+	}
+	if _, err := j.CheckToken(current); err != nil {
+		t.Errorf("CheckToken() returned unexpected error: %v", err)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	key := []byte("secret")
+	hdr := map[string]interface{}{"alg": "HS256"}
+	h := NewBearerHandler(&JWT{Keys: HMACKey(key)}, RequireScope("read:users", "write:users")(http.HandlerFunc(handlerFuncOK)))
+
+	tests := []struct {
+		claims map[string]interface{}
+		code   int
+	}{
+		{map[string]interface{}{"scope": "read:users write:users admin"}, http.StatusOK},
+		{map[string]interface{}{"scp": []string{"read:users", "write:users"}}, http.StatusOK},
+		{map[string]interface{}{"scope": "read:users"}, http.StatusForbidden},
+		{map[string]interface{}{}, http.StatusForbidden},
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.Header.Set("Authorization", "Bearer "+signHS256(t, key, hdr, tt.claims))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("[%d] w.Code = %d, expected: %d", ii, w.Code, tt.code)
+		}
+		if tt.code == http.StatusForbidden {
+			expected := `Bearer error="insufficient_scope", scope="read:users write:users"`
+			if got := w.Header().Get("WWW-Authenticate"); got != expected {
+				t.Errorf("[%d] WWW-Authenticate = %s, expected: %s", ii, got, expected)
+			}
+		}
+	}
+
+	// Without a bearer handler in front there are no claims.
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	RequireScope("read:users")(http.HandlerFunc(handlerFuncOK)).ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestIntrospection(t *testing.T) {
+	calls := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if id, secret, ok := r.BasicAuth(); !ok || id != "api" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.PostFormValue("token") {
+		case "good":
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "sub": "alice", "scope": "read", "exp": time.Now().Add(time.Hour).Unix()})
+		case "expired":
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": true, "sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"active": false})
+		}
+	}))
+	defer s.Close()
+
+	i := &Introspection{URL: s.URL, ClientID: "api", ClientSecret: "s3cret", CacheTTL: time.Minute}
+
+	tests := []struct {
+		token string
+		err   error
+	}{
+		{"good", nil},
+		{"good", nil},
+		{"expired", ErrTokenExpired},
+		{"revoked", ErrTokenInactive},
+		{"revoked", ErrTokenInactive},
+	}
+	for ii, tt := range tests {
+		claims, err := i.CheckToken(tt.token)
+		if err != tt.err {
+			t.Errorf("[%d] i.CheckToken() error = %v, expected %v", ii, err, tt.err)
+			continue
+		}
+		if err == nil && claims.Subject() != "alice" {
+			t.Errorf("[%d] claims.Subject() = %q, expected %q", ii, claims.Subject(), "alice")
+		}
+	}
+	// The second check of "good" is served from the cache.
+	if calls != 4 {
+		t.Errorf("introspection endpoint called %d times, expected 4", calls)
+	}
+
+	i = &Introspection{URL: s.URL, ClientID: "api", ClientSecret: "wrong"}
+	if _, err := i.CheckToken("good"); err == nil {
+		t.Errorf("i.CheckToken() with invalid client credentials expected error")
+	}
+}
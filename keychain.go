@@ -0,0 +1,144 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Errors returned by Keychain.
+var (
+	ErrKeychainNotFound    = errors.New("httpauth: secret not found in keychain")
+	ErrKeychainUnsupported = errors.New("httpauth: keychain not supported on this platform")
+	ErrKeychainSecretSize  = errors.New("httpauth: secret is too large for the keychain")
+)
+
+// maxSecurityCommand is the longest command line read by security in interactive mode.
+const maxSecurityCommand = 4096
+
+// Keychain stores secrets (e.g. tokens for CLI clients) in the OS keychain rather than
+// in plaintext configuration files.  It uses the security command on macOS (the login
+// Keychain) and secret-tool on other Unix systems (the Secret Service, e.g. GNOME
+// Keyring or KWallet), which must be installed.  Other platforms, including Windows,
+// are not supported and return ErrKeychainUnsupported.
+type Keychain struct {
+	// Service identifies the application which owns the secrets, e.g. "example-cli".
+	Service string
+}
+
+// Get returns the secret stored for the account, or ErrKeychainNotFound if there is
+// none.
+func (k Keychain) Get(account string) (string, error) {
+	cmd, err := keychainCommand(
+		[]string{"find-generic-password", "-s", k.Service, "-a", account, "-w"},
+		[]string{"lookup", "service", k.Service, "account", account},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return "", ErrKeychainNotFound
+		}
+		return "", fmt.Errorf("httpauth: reading keychain: %v", err)
+	}
+	secret := strings.TrimSuffix(stdout.String(), "\n")
+	if secret == "" {
+		return "", ErrKeychainNotFound
+	}
+	return secret, nil
+}
+
+// Set stores the secret for the account, replacing any existing secret.  On macOS it
+// returns ErrKeychainSecretSize if the secret is longer than about 2KB.
+func (k Keychain) Set(account, secret string) error {
+	// The secret is never passed as an argument, where other local users could read it
+	// (e.g. using ps).  secret-tool reads it from stdin, and security reads the whole
+	// command from stdin in interactive mode, with the secret hex-encoded (-X) so that it
+	// need not be quoted.
+	cmd, err := keychainCommand(
+		[]string{"-i"},
+		[]string{"store", "--label=" + k.Service + " (" + account + ")", "service", k.Service, "account", account},
+	)
+	if err != nil {
+		return err
+	}
+	stdin := secret
+	if runtime.GOOS == "darwin" {
+		stdin = "add-generic-password -U -s " + securityQuote(k.Service) + " -a " + securityQuote(account) + " -X " + hex.EncodeToString([]byte(secret)) + "\n"
+		if len(stdin) > maxSecurityCommand {
+			return ErrKeychainSecretSize
+		}
+	}
+	cmd.Stdin = strings.NewReader(stdin)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("httpauth: writing keychain: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// Delete removes the secret stored for the account.
+func (k Keychain) Delete(account string) error {
+	cmd, err := keychainCommand(
+		[]string{"delete-generic-password", "-s", k.Service, "-a", account},
+		[]string{"clear", "service", k.Service, "account", account},
+	)
+	if err != nil {
+		return err
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("httpauth: deleting from keychain: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// securityQuote quotes s as an argument of a command read by security in interactive
+// mode, which splits arguments as a shell does.
+func securityQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
+
+// keychainCommand returns the command to run on this platform: security with the
+// arguments darwin on macOS, secret-tool with the arguments secretTool on other Unix
+// systems.
+func keychainCommand(darwin, secretTool []string) (*exec.Cmd, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("security", darwin...), nil
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly", "solaris", "illumos":
+		return exec.Command("secret-tool", secretTool...), nil
+	}
+	return nil, ErrKeychainUnsupported
+}
+
+// TokenSource returns a TokenSource which reads the access token for the account from
+// the keychain.  The token is read on each call, so use with TokenSourceSigner (which
+// reuses tokens) or ReuseTokenSource.
+func (k Keychain) TokenSource(account string) TokenSource {
+	return keychainTokenSource{k, account}
+}
+
+type keychainTokenSource struct {
+	k       Keychain
+	account string
+}
+
+// Token implements TokenSource.
+func (s keychainTokenSource) Token() (*Token, error) {
+	secret, err := s.k.Get(s.account)
+	if err != nil {
+		return nil, err
+	}
+	return &Token{AccessToken: secret}, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http"
+	"sync"
+)
+
+// Errors returned by KeyRing.
+var (
+	ErrKeyExists  = errors.New("httpauth: key ID already in use")
+	ErrKeyCurrent = errors.New("httpauth: cannot retire the current signing key")
+)
+
+// KeyRing holds the keys used to sign and verify JWTs, allowing the signing key to be
+// rotated at runtime: tokens are signed with the current key, while tokens signed with
+// earlier keys still verify until those keys are retired.  A KeyRing is a KeySource (for
+// JWT) and an http.Handler which serves the public RSA keys as a JSON Web Key Set, so
+// that other services can verify tokens using NewJWKS.  Keys are []byte (HS256) or
+// *rsa.PrivateKey (RS256).  HS256 keys are secret so are never served.
+type KeyRing struct {
+	mu      sync.RWMutex
+	current string
+	ids     []string
+	keys    map[string]interface{}
+}
+
+// NewKeyRing creates a KeyRing whose current signing key is key, with key ID kid.
+func NewKeyRing(kid string, key interface{}) (*KeyRing, error) {
+	k := &KeyRing{
+		keys: make(map[string]interface{}),
+	}
+	if err := k.Rotate(kid, key); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Rotate adds key with key ID kid and makes it the current signing key.  The previous
+// signing key remains available for verification until it is retired.
+func (k *KeyRing) Rotate(kid string, key interface{}) error {
+	switch key.(type) {
+	case []byte, *rsa.PrivateKey:
+	default:
+		return ErrTokenUnsupportedAlg
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[kid]; ok {
+		return ErrKeyExists
+	}
+	k.keys[kid] = key
+	k.ids = append(k.ids, kid)
+	k.current = kid
+	return nil
+}
+
+// Retire removes the key with key ID kid, so that tokens signed with it no longer
+// verify.  The current signing key cannot be retired.
+func (k *KeyRing) Retire(kid string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if kid == k.current {
+		return ErrKeyCurrent
+	}
+	delete(k.keys, kid)
+	for i, id := range k.ids {
+		if id == kid {
+			k.ids = append(k.ids[:i], k.ids[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// signingKey returns the current signing key and its key ID.
+func (k *KeyRing) signingKey() (string, interface{}) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.current, k.keys[k.current]
+}
+
+// Key implements KeySource.  If kid is empty then the current signing key is used.
+func (k *KeyRing) Key(alg, kid string) (interface{}, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if kid == "" {
+		kid = k.current
+	}
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrTokenUnknownKey
+	}
+	switch key := key.(type) {
+	case []byte:
+		if alg == "HS256" {
+			return key, nil
+		}
+	case *rsa.PrivateKey:
+		if alg == "RS256" {
+			return &key.PublicKey, nil
+		}
+	}
+	return nil, ErrTokenUnknownKey
+}
+
+// ServeHTTP implements http.Handler, writing the public RSA keys as a JSON Web Key Set.
+func (k *KeyRing) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k.mu.RLock()
+	keys := make([]jsonWebKey, 0, len(k.ids))
+	for _, kid := range k.ids {
+		if key, ok := k.keys[kid].(*rsa.PrivateKey); ok {
+			keys = append(keys, jsonWebKey{
+				Kty: "RSA",
+				Use: "sig",
+				Kid: kid,
+				Alg: "RS256",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+	}
+	k.mu.RUnlock()
+
+	writeJSON(w, struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{keys})
+}
@@ -0,0 +1,113 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NewLoginHandler returns an http.Handler which accepts POSTed login forms (with
+// "username" and "password" fields), checks the credentials using the Checker and on
+// success issues a session cookie using Sessions and redirects to the local path given
+// by the "next" field, or redirect if it is not set.  Failed logins receive
+// http.StatusUnauthorized (without a WWW-Authenticate challenge, so browsers do not show
+// their login dialog).
+func NewLoginHandler(c Checker, s *Sessions, redirect string) http.Handler {
+	return &loginHandler{
+		c:        c,
+		s:        s,
+		redirect: redirect,
+	}
+}
+
+type loginHandler struct {
+	c        Checker
+	s        *Sessions
+	redirect string
+}
+
+// ServeHTTP implements http.Handler.
+func (h *loginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := r.PostFormValue("username")
+	if !h.c.Check(username, r.PostFormValue("password")) {
+		unauthorized(w, r, "")
+		return
+	}
+	if err := h.s.Issue(w, r, username); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	next := r.PostFormValue("next")
+	if !isLocalPath(next) {
+		next = h.redirect
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// isLocalPath returns true if p is an absolute path on the same host, so is safe to
+// redirect to.  Paths containing whitespace or control characters are rejected, as
+// browsers remove some of them (e.g. "/\t/evil.com" is followed as "//evil.com").
+func isLocalPath(p string) bool {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return false
+	}
+	for i := 0; i < len(p); i++ {
+		if p[i] <= ' ' || p[i] == 0x7f {
+			return false
+		}
+	}
+	u, err := url.Parse(p)
+	return err == nil && u.Scheme == "" && u.Host == ""
+}
+
+// NewLogoutHandler returns an http.Handler which ends the session of POST requests (see
+// Sessions.Clear) and redirects to redirect.  Other methods receive
+// http.StatusMethodNotAllowed, so that cross-site links cannot log users out.
+func NewLogoutHandler(s *Sessions, redirect string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if err := s.Clear(w, r); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+	})
+}
+
+// RequireSession returns an http.Handler which passes requests with a valid session
+// cookie (see Sessions) to the given http.Handler, with the username in the request
+// context (see UserFromContext), and redirects other requests to loginURL with the
+// original path in the "next" query parameter.
+func RequireSession(s *Sessions, loginURL string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, ok := s.User(r); ok {
+			h.ServeHTTP(w, withUser(r, username))
+			return
+		}
+
+		u, err := url.Parse(loginURL)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		q := u.Query()
+		q.Set("next", r.URL.RequestURI())
+		u.RawQuery = q.Encode()
+		http.Redirect(w, r, u.String(), http.StatusFound)
+	})
+}
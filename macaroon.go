@@ -0,0 +1,401 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Errors returned when verifying macaroons.
+var (
+	ErrMacaroonInvalid = errors.New("httpauth: invalid macaroon")
+	ErrMacaroonCaveat  = errors.New("httpauth: macaroon caveat not satisfied")
+)
+
+// maxMacaroonDepth is the maximum depth of third-party caveats (discharges of
+// discharges) which will be verified.
+const maxMacaroonDepth = 8
+
+// Macaroon is a bearer credential whose authority can be attenuated by adding caveats
+// (see "Macaroons: Cookies with Contextual Caveats for Decentralized Authorization in
+// the Cloud").  Signatures are computed as in libmacaroons, but the verification IDs of
+// third-party caveats are encrypted using AES-GCM (so third-party caveats are not
+// interoperable with other implementations).
+type Macaroon struct {
+	Location  string
+	ID        string
+	Caveats   []Caveat
+	Signature []byte
+}
+
+// Caveat is a macaroon caveat.  First-party caveats have only an ID (the condition),
+// third-party caveats also have a verification ID and the location of the third party
+// which issues discharge macaroons.
+type Caveat struct {
+	ID             string
+	VerificationID []byte
+	Location       string
+}
+
+// NewMacaroon creates a Macaroon with the root key, ID and (optional) location.
+func NewMacaroon(rootKey []byte, id, location string) *Macaroon {
+	return &Macaroon{
+		Location:  location,
+		ID:        id,
+		Signature: macaroonHMAC(deriveMacaroonKey(rootKey), []byte(id)),
+	}
+}
+
+// AddFirstPartyCaveat adds a caveat with the condition, checked by the target service
+// (see MacaroonVerifier).
+func (m *Macaroon) AddFirstPartyCaveat(condition string) {
+	m.Caveats = append(m.Caveats, Caveat{ID: condition})
+	m.Signature = macaroonHMAC(m.Signature, []byte(condition))
+}
+
+// AddThirdPartyCaveat adds a caveat which must be discharged by the third party at the
+// location.  The third party must be able to recover the caveat key and the condition
+// from the caveat ID, and then discharges the caveat by issuing a macaroon created with
+// NewMacaroon(key, id, ...).
+func (m *Macaroon) AddThirdPartyCaveat(key []byte, id, location string) error {
+	block, err := aes.NewCipher(m.Signature)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	vid := gcm.Seal(nonce, nonce, deriveMacaroonKey(key), nil)
+
+	m.Caveats = append(m.Caveats, Caveat{ID: id, VerificationID: vid, Location: location})
+	m.Signature = macaroonHash2(m.Signature, vid, []byte(id))
+	return nil
+}
+
+// bindFor returns a copy of the discharge macaroon m bound to the root macaroon, so
+// that it can only be used in requests with the root macaroon.
+func (m *Macaroon) bindFor(root *Macaroon) *Macaroon {
+	mm := *m
+	mm.Signature = macaroonBind(root.Signature, m.Signature)
+	return &mm
+}
+
+// ExpiryCaveat returns a first-party caveat condition which is satisfied before t.
+func ExpiryCaveat(t time.Time) string {
+	return "time-before " + t.UTC().Format(time.RFC3339)
+}
+
+// PathCaveat returns a first-party caveat condition which is satisfied by requests for
+// the path or paths beneath it.
+func PathCaveat(path string) string {
+	return "path " + path
+}
+
+// MethodCaveat returns a first-party caveat condition which is satisfied by requests
+// using one of the methods.
+func MethodCaveat(methods ...string) string {
+	return "method " + strings.Join(methods, " ")
+}
+
+type macaroonJSON struct {
+	V   int          `json:"v"`
+	L   string       `json:"l,omitempty"`
+	I   string       `json:"i"`
+	C   []caveatJSON `json:"c,omitempty"`
+	S64 string       `json:"s64"`
+}
+
+type caveatJSON struct {
+	I   string `json:"i"`
+	V64 string `json:"v64,omitempty"`
+	L   string `json:"l,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler, using the libmacaroons version 2 JSON format.
+func (m *Macaroon) MarshalJSON() ([]byte, error) {
+	j := macaroonJSON{
+		V:   2,
+		L:   m.Location,
+		I:   m.ID,
+		S64: base64.RawURLEncoding.EncodeToString(m.Signature),
+	}
+	for _, c := range m.Caveats {
+		j.C = append(j.C, caveatJSON{I: c.ID, V64: base64.RawURLEncoding.EncodeToString(c.VerificationID), L: c.Location})
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (m *Macaroon) UnmarshalJSON(b []byte) error {
+	var j macaroonJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	if j.V != 2 {
+		return ErrMacaroonInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(j.S64, "="))
+	if err != nil || len(sig) != sha256.Size {
+		return ErrMacaroonInvalid
+	}
+	*m = Macaroon{Location: j.L, ID: j.I, Signature: sig}
+	for _, c := range j.C {
+		var vid []byte
+		if c.V64 != "" {
+			if vid, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(c.V64, "=")); err != nil {
+				return ErrMacaroonInvalid
+			}
+		}
+		m.Caveats = append(m.Caveats, Caveat{ID: c.I, VerificationID: vid, Location: c.L})
+	}
+	return nil
+}
+
+// EncodeMacaroons returns the base64url-encoded JSON array of the macaroons, as sent by
+// MacaroonSigner.
+func EncodeMacaroons(ms ...*Macaroon) (string, error) {
+	b, err := json.Marshal(ms)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// DecodeMacaroons decodes macaroons encoded by EncodeMacaroons.  It returns
+// ErrMacaroonInvalid if there are no macaroons, or any is null.
+func DecodeMacaroons(s string) ([]*Macaroon, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, ErrMacaroonInvalid
+	}
+	var ms []*Macaroon
+	if err := json.Unmarshal(b, &ms); err != nil || len(ms) == 0 {
+		return nil, ErrMacaroonInvalid
+	}
+	for _, m := range ms {
+		if m == nil {
+			return nil, ErrMacaroonInvalid
+		}
+	}
+	return ms, nil
+}
+
+// MacaroonSigner is a Signer which sends the Macaroon, along with discharge macaroons
+// for its third-party caveats, in the Authorization header:
+//
+//	Authorization: Macaroon <encoded macaroons>
+//
+// where the macaroons are encoded as by EncodeMacaroons.  The Discharges are bound to
+// the Macaroon when signing, so must not already be bound.
+type MacaroonSigner struct {
+	Macaroon   *Macaroon
+	Discharges []*Macaroon
+}
+
+// Sign implements Signer.
+func (s MacaroonSigner) Sign(r *http.Request) error {
+	ms := []*Macaroon{s.Macaroon}
+	for _, d := range s.Discharges {
+		ms = append(ms, d.bindFor(s.Macaroon))
+	}
+	token, err := EncodeMacaroons(ms...)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", "Macaroon "+token)
+	return nil
+}
+
+// MacaroonVerifier verifies macaroons sent by MacaroonSigner.  The ExpiryCaveat,
+// PathCaveat and MethodCaveat conditions are checked against the request, and
+// third-party caveats must be discharged by macaroons in the request.
+type MacaroonVerifier struct {
+	// RootKeys provides the root keys by macaroon ID.
+	RootKeys SecretSource
+
+	// Check, if non-nil, checks first-party caveats with other conditions, returning
+	// true if the condition is satisfied by the request.  Otherwise, caveats with
+	// unknown conditions are not satisfied.
+	Check func(r *http.Request, condition string) bool
+}
+
+type macaroonKey struct{}
+
+// MacaroonFromContext returns the (root) Macaroon stored in ctx by a macaroon handler,
+// if any.
+func MacaroonFromContext(ctx context.Context) (*Macaroon, bool) {
+	m, ok := ctx.Value(macaroonKey{}).(*Macaroon)
+	return m, ok
+}
+
+// MacaroonScheme creates a Scheme which authenticates requests with macaroons using
+// the MacaroonVerifier, adding the macaroon to the request context (see
+// MacaroonFromContext).
+func MacaroonScheme(v *MacaroonVerifier) Scheme {
+	return macaroonScheme{v}
+}
+
+// NewMacaroonHandler returns an http.Handler which passes requests with valid
+// macaroons (see MacaroonScheme) to the given http.Handler (responds with
+// http.StatusUnauthorized otherwise).
+func NewMacaroonHandler(v *MacaroonVerifier, h http.Handler) http.Handler {
+	return NewMultiHandler(h, MacaroonScheme(v))
+}
+
+type macaroonScheme struct {
+	v *MacaroonVerifier
+}
+
+// Authenticate implements Scheme.
+func (s macaroonScheme) Authenticate(r *http.Request) (*http.Request, bool) {
+	scheme, token := splitScheme(r.Header.Get("Authorization"))
+	if scheme != "macaroon" {
+		return r, false
+	}
+	ms, err := DecodeMacaroons(token)
+	if err != nil || s.v.Verify(r, ms) != nil {
+		return r, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), macaroonKey{}, ms[0])), true
+}
+
+// Challenge implements Scheme.
+func (s macaroonScheme) Challenge() string { return "Macaroon" }
+
+// Verify verifies the (root) macaroon ms[0] for the request r, using the remaining
+// macaroons to discharge third-party caveats.  It returns ErrMacaroonCaveat if a caveat
+// is not satisfied, and ErrMacaroonInvalid if the macaroons are otherwise invalid.
+func (v *MacaroonVerifier) Verify(r *http.Request, ms []*Macaroon) error {
+	if len(ms) == 0 {
+		return ErrMacaroonInvalid
+	}
+	root := ms[0]
+	key, ok := v.RootKeys.Secret(root.ID)
+	if !ok {
+		return ErrMacaroonInvalid
+	}
+	used := make([]bool, len(ms))
+	return v.verify(r, root, root, deriveMacaroonKey(key), ms[1:], used[1:], 0)
+}
+
+// verify verifies the macaroon m (which is root, or a discharge bound to root) using
+// the key.
+func (v *MacaroonVerifier) verify(r *http.Request, root, m *Macaroon, key []byte, discharges []*Macaroon, used []bool, depth int) error {
+	if depth > maxMacaroonDepth {
+		return ErrMacaroonInvalid
+	}
+	sig := macaroonHMAC(key, []byte(m.ID))
+	for _, c := range m.Caveats {
+		if c.VerificationID == nil {
+			if !v.check(r, c.ID) {
+				return ErrMacaroonCaveat
+			}
+			sig = macaroonHMAC(sig, []byte(c.ID))
+			continue
+		}
+
+		caveatKey, err := macaroonDecrypt(sig, c.VerificationID)
+		if err != nil {
+			return ErrMacaroonInvalid
+		}
+		var d *Macaroon
+		for i, dd := range discharges {
+			if !used[i] && dd.ID == c.ID {
+				d, used[i] = dd, true
+				break
+			}
+		}
+		if d == nil {
+			return ErrMacaroonCaveat
+		}
+		if err := v.verify(r, root, d, caveatKey, discharges, used, depth+1); err != nil {
+			return err
+		}
+		sig = macaroonHash2(sig, c.VerificationID, []byte(c.ID))
+	}
+
+	if m != root {
+		sig = macaroonBind(root.Signature, sig)
+	}
+	if !hmac.Equal(sig, m.Signature) {
+		return ErrMacaroonInvalid
+	}
+	return nil
+}
+
+// check returns true if the first-party caveat condition is satisfied by r.
+func (v *MacaroonVerifier) check(r *http.Request, condition string) bool {
+	i := strings.IndexByte(condition, ' ')
+	if i < 0 {
+		return v.Check != nil && v.Check(r, condition)
+	}
+	switch arg := condition[i+1:]; condition[:i] {
+	case "time-before":
+		t, err := time.Parse(time.RFC3339, arg)
+		return err == nil && time.Now().Before(t)
+
+	case "path":
+		p := r.URL.Path
+		return p == arg || strings.HasPrefix(p, strings.TrimSuffix(arg, "/")+"/")
+
+	case "method":
+		return containsString(strings.Fields(arg), r.Method)
+	}
+	return v.Check != nil && v.Check(r, condition)
+}
+
+// deriveMacaroonKey derives the signing key from a root (or caveat) key as in libmacaroons.
+func deriveMacaroonKey(key []byte) []byte {
+	return macaroonHMAC([]byte("macaroons-key-generator"), key)
+}
+
+func macaroonHMAC(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func macaroonHash2(key, a, b []byte) []byte {
+	return macaroonHMAC(key, append(macaroonHMAC(key, a), macaroonHMAC(key, b)...))
+}
+
+// macaroonBind returns the signature of a discharge macaroon bound to the root
+// macaroon signature.
+func macaroonBind(root, discharge []byte) []byte {
+	return macaroonHash2(make([]byte, sha256.Size), root, discharge)
+}
+
+// macaroonDecrypt decrypts the caveat key from a third-party caveat verification ID.
+func macaroonDecrypt(sig, vid []byte) ([]byte, error) {
+	block, err := aes.NewCipher(sig)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(vid) < gcm.NonceSize() {
+		return nil, ErrMacaroonInvalid
+	}
+	return gcm.Open(nil, vid[:gcm.NonceSize()], vid[gcm.NonceSize():], nil)
+}
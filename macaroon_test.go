@@ -0,0 +1,122 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth_test
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/dhowden/httpauth"
+)
+
+func TestMacaroon(t *testing.T) {
+	rootKey := []byte("root key")
+	v := &MacaroonVerifier{
+		RootKeys: Secrets(map[string][]byte{"m1": rootKey}),
+		Check: func(r *http.Request, condition string) bool {
+			return condition == "account alice"
+		},
+	}
+	var id string
+	h := NewMacaroonHandler(v, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m, _ := MacaroonFromContext(r.Context())
+		id = m.ID
+		handlerFuncOK(w, r)
+	}))
+
+	newMacaroon := func(caveats ...string) *Macaroon {
+		m := NewMacaroon(rootKey, "m1", "https://example.com")
+		for _, c := range caveats {
+			m.AddFirstPartyCaveat(c)
+		}
+		return m
+	}
+	thirdParty := newMacaroon("account alice")
+	if err := thirdParty.AddThirdPartyCaveat([]byte("caveat key"), "is-admin", "https://auth.example.com"); err != nil {
+		t.Fatalf("AddThirdPartyCaveat() returned unexpected error: %v", err)
+	}
+	discharge := NewMacaroon([]byte("caveat key"), "is-admin", "https://auth.example.com")
+	discharge.AddFirstPartyCaveat(ExpiryCaveat(time.Now().Add(time.Minute)))
+	otherDischarge := NewMacaroon([]byte("other key"), "is-admin", "")
+
+	tampered := newMacaroon(PathCaveat("/docs"))
+	tampered.Caveats = nil
+
+	tests := []struct {
+		name   string
+		s      Signer
+		method string
+		path   string
+		code   int
+	}{
+		{"no caveats", MacaroonSigner{Macaroon: newMacaroon()}, "GET", "/", http.StatusOK},
+		{"path", MacaroonSigner{Macaroon: newMacaroon(PathCaveat("/docs"))}, "GET", "/docs/a", http.StatusOK},
+		{"path exact", MacaroonSigner{Macaroon: newMacaroon(PathCaveat("/docs"))}, "GET", "/docs", http.StatusOK},
+		{"wrong path", MacaroonSigner{Macaroon: newMacaroon(PathCaveat("/docs"))}, "GET", "/docsx", http.StatusUnauthorized},
+		{"method", MacaroonSigner{Macaroon: newMacaroon(MethodCaveat("GET", "HEAD"))}, "HEAD", "/", http.StatusOK},
+		{"wrong method", MacaroonSigner{Macaroon: newMacaroon(MethodCaveat("GET", "HEAD"))}, "POST", "/", http.StatusUnauthorized},
+		{"expiry", MacaroonSigner{Macaroon: newMacaroon(ExpiryCaveat(time.Now().Add(time.Minute)))}, "GET", "/", http.StatusOK},
+		{"expired", MacaroonSigner{Macaroon: newMacaroon(ExpiryCaveat(time.Now().Add(-time.Minute)))}, "GET", "/", http.StatusUnauthorized},
+		{"custom", MacaroonSigner{Macaroon: newMacaroon("account alice")}, "GET", "/", http.StatusOK},
+		{"unknown", MacaroonSigner{Macaroon: newMacaroon("account bob")}, "GET", "/", http.StatusUnauthorized},
+		{"tampered", MacaroonSigner{Macaroon: tampered}, "GET", "/", http.StatusUnauthorized},
+		{"wrong key", MacaroonSigner{Macaroon: NewMacaroon([]byte("wrong"), "m1", "")}, "GET", "/", http.StatusUnauthorized},
+		{"discharged", MacaroonSigner{Macaroon: thirdParty, Discharges: []*Macaroon{discharge}}, "GET", "/", http.StatusOK},
+		{"undischarged", MacaroonSigner{Macaroon: thirdParty}, "GET", "/", http.StatusUnauthorized},
+		{"wrong discharge", MacaroonSigner{Macaroon: thirdParty, Discharges: []*Macaroon{otherDischarge}}, "GET", "/", http.StatusUnauthorized},
+		{"unbound discharge", SignerFunc(func(r *http.Request) error {
+			token, _ := EncodeMacaroons(thirdParty, discharge)
+			r.Header.Set("Authorization", "Macaroon "+token)
+			return nil
+		}), "GET", "/", http.StatusUnauthorized},
+		{"null", SignerFunc(func(r *http.Request) error {
+			r.Header.Set("Authorization", "Macaroon "+base64.RawURLEncoding.EncodeToString([]byte("[null]")))
+			return nil
+		}), "GET", "/", http.StatusUnauthorized},
+		{"null discharge", SignerFunc(func(r *http.Request) error {
+			token, _ := EncodeMacaroons(thirdParty, nil)
+			r.Header.Set("Authorization", "Macaroon "+token)
+			return nil
+		}), "GET", "/", http.StatusUnauthorized},
+		{"empty", SignerFunc(func(r *http.Request) error {
+			r.Header.Set("Authorization", "Macaroon "+base64.RawURLEncoding.EncodeToString([]byte("[]")))
+			return nil
+		}), "GET", "/", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		id = ""
+		r, _ := http.NewRequest(tt.method, tt.path, nil)
+		if err := tt.s.Sign(r); err != nil {
+			t.Fatalf("%s: Sign() returned unexpected error: %v", tt.name, err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s: w.Code = %d, expected: %d", tt.name, w.Code, tt.code)
+		}
+		if tt.code == http.StatusOK && id != "m1" {
+			t.Errorf("%s: macaroon ID = %q, expected: %q", tt.name, id, "m1")
+		}
+	}
+
+	// Attenuated macaroons survive encoding.
+	m := newMacaroon(PathCaveat("/docs"))
+	token, err := EncodeMacaroons(m, discharge)
+	if err != nil {
+		t.Fatalf("EncodeMacaroons() returned unexpected error: %v", err)
+	}
+	ms, err := DecodeMacaroons(token)
+	if err != nil {
+		t.Fatalf("DecodeMacaroons() returned unexpected error: %v", err)
+	}
+	if len(ms) != 2 || ms[0].ID != "m1" || len(ms[0].Caveats) != 1 || !hmac.Equal(ms[0].Signature, m.Signature) {
+		t.Errorf("DecodeMacaroons() = %v, expected: %v", ms, []*Macaroon{m, discharge})
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultMagicLinkTTL is the default lifetime of a magic link token.
+const DefaultMagicLinkTTL = 15 * time.Minute
+
+// TokenStore defines methods for storing single-use tokens.  Tokens are passed to the
+// store as digests (see HashKey), so the tokens themselves are never stored.
+type TokenStore interface {
+	// Add records the token digest for the username until expires.
+	Add(digest, username string, expires time.Time) error
+
+	// Redeem removes the token digest, returning the username it was added for if it
+	// existed and had not expired.
+	Redeem(digest string) (string, bool)
+
+	// DeleteUser removes all tokens for the username.
+	DeleteUser(username string) error
+}
+
+// NewMemoryTokenStore creates a TokenStore which keeps tokens in memory.
+func NewMemoryTokenStore() TokenStore {
+	return &memoryTokenStore{
+		m: make(map[string]memoryToken),
+	}
+}
+
+type memoryToken struct {
+	username string
+	expires  time.Time
+}
+
+type memoryTokenStore struct {
+	mu    sync.Mutex
+	m     map[string]memoryToken
+	swept time.Time
+}
+
+// Add implements TokenStore.
+func (s *memoryTokenStore) Add(digest, username string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.swept) > time.Minute {
+		for k, t := range s.m {
+			if !now.Before(t.expires) {
+				delete(s.m, k)
+			}
+		}
+		s.swept = now
+	}
+	s.m[digest] = memoryToken{username: username, expires: expires}
+	return nil
+}
+
+// Redeem implements TokenStore.
+func (s *memoryTokenStore) Redeem(digest string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.m[digest]
+	delete(s.m, digest)
+	if !ok || !time.Now().Before(t.expires) {
+		return "", false
+	}
+	return t.username, true
+}
+
+// DeleteUser implements TokenStore.
+func (s *memoryTokenStore) DeleteUser(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, t := range s.m {
+		if t.username == username {
+			delete(s.m, k)
+		}
+	}
+	return nil
+}
+
+// MagicLinks issues single-use, time-limited tokens to be delivered to users out of band
+// (e.g. in an emailed link), which are exchanged for a session cookie by the handler
+// returned by NewMagicLinkHandler.
+type MagicLinks struct {
+	// Store records issued tokens until they are redeemed or expire.
+	Store TokenStore
+
+	// Sessions issues session cookies when tokens are redeemed.
+	Sessions *Sessions
+
+	// TTL is the lifetime of a token.  Defaults to DefaultMagicLinkTTL.
+	TTL time.Duration
+}
+
+func (m *MagicLinks) ttl() time.Duration {
+	if m.TTL == 0 {
+		return DefaultMagicLinkTTL
+	}
+	return m.TTL
+}
+
+// Issue creates a new token for the username.  It is the caller's responsibility to
+// deliver it to the user, e.g. as the "token" query parameter of a link to the handler
+// returned by NewMagicLinkHandler.
+func (m *MagicLinks) Issue(username string) (string, error) {
+	token, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	if err := m.Store.Add(HashKey(token), username, time.Now().Add(m.ttl())); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// NewMagicLinkHandler returns an http.Handler which redeems the token in the "token"
+// form value (see MagicLinks.Issue), issues a session cookie for its user and redirects
+// to the local path given by the "next" form value, or redirect if it is not set.
+// Invalid, expired and already-redeemed tokens receive http.StatusUnauthorized.
+func NewMagicLinkHandler(m *MagicLinks, redirect string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.FormValue("token")
+		if token == "" {
+			unauthorized(w, r, "")
+			return
+		}
+		username, ok := m.Store.Redeem(HashKey(token))
+		if !ok {
+			unauthorized(w, r, "")
+			return
+		}
+		if err := m.Sessions.Issue(w, r, username); err != nil {
+			writeError(w, r, http.StatusInternalServerError)
+			return
+		}
+
+		next := r.FormValue("next")
+		if !isLocalPath(next) {
+			next = redirect
+		}
+		http.Redirect(w, r, next, http.StatusSeeOther)
+	})
+}
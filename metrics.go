@@ -0,0 +1,140 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsBuckets are the upper bounds (in seconds) of the check latency histogram.
+var metricsBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// Metrics records authentication attempts, successes, failures and check latency for
+// handlers configured with Instrument, along with the status codes of responses to
+// authenticated requests, and serves them in the Prometheus text exposition format.
+type Metrics struct {
+	mu sync.Mutex
+	m  map[string]*handlerMetrics
+}
+
+type handlerMetrics struct {
+	successes, failures uint64
+	buckets             []uint64
+	sum                 float64
+	responses           map[int]uint64
+}
+
+// NewMetrics creates a new Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		m: make(map[string]*handlerMetrics),
+	}
+}
+
+// handler returns the metrics for the named handler, creating them if necessary.  The
+// caller must hold m.mu.
+func (m *Metrics) handler(name string) *handlerMetrics {
+	hm, found := m.m[name]
+	if !found {
+		hm = &handlerMetrics{
+			buckets:   make([]uint64, len(metricsBuckets)),
+			responses: make(map[int]uint64),
+		}
+		m.m[name] = hm
+	}
+	return hm
+}
+
+// observe records the result of an authentication attempt for the named handler.
+func (m *Metrics) observe(name string, ok bool, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hm := m.handler(name)
+	if ok {
+		hm.successes++
+	} else {
+		hm.failures++
+	}
+	s := d.Seconds()
+	hm.sum += s
+	for i, b := range metricsBuckets {
+		if s <= b {
+			hm.buckets[i]++
+		}
+	}
+}
+
+// observeResponse records the status code of a response to an authenticated request for
+// the named handler.
+func (m *Metrics) observeResponse(name string, code int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.handler(name).responses[code]++
+}
+
+// ServeHTTP implements http.Handler, writing the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.m))
+	for name := range m.m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	counter := func(metric, help string, value func(*handlerMetrics) uint64) {
+		fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v counter\n", metric, help, metric)
+		for _, name := range names {
+			fmt.Fprintf(w, "%v{handler=%v} %d\n", metric, labelValue(name), value(m.m[name]))
+		}
+	}
+	counter("httpauth_attempts_total", "Total authentication attempts.", func(hm *handlerMetrics) uint64 { return hm.successes + hm.failures })
+	counter("httpauth_successes_total", "Total successful authentication attempts.", func(hm *handlerMetrics) uint64 { return hm.successes })
+	counter("httpauth_failures_total", "Total failed authentication attempts.", func(hm *handlerMetrics) uint64 { return hm.failures })
+
+	const hist = "httpauth_check_duration_seconds"
+	fmt.Fprintf(w, "# HELP %v Time taken to check credentials.\n# TYPE %v histogram\n", hist, hist)
+	for _, name := range names {
+		hm := m.m[name]
+		l := labelValue(name)
+		for i, b := range metricsBuckets {
+			fmt.Fprintf(w, "%v_bucket{handler=%v,le=\"%v\"} %d\n", hist, l, strconv.FormatFloat(b, 'g', -1, 64), hm.buckets[i])
+		}
+		fmt.Fprintf(w, "%v_bucket{handler=%v,le=\"+Inf\"} %d\n", hist, l, hm.successes+hm.failures)
+		fmt.Fprintf(w, "%v_sum{handler=%v} %v\n", hist, l, strconv.FormatFloat(hm.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%v_count{handler=%v} %d\n", hist, l, hm.successes+hm.failures)
+	}
+
+	const responses = "httpauth_responses_total"
+	fmt.Fprintf(w, "# HELP %v Total responses to authenticated requests by status code.\n# TYPE %v counter\n", responses, responses)
+	for _, name := range names {
+		hm := m.m[name]
+		codes := make([]int, 0, len(hm.responses))
+		for code := range hm.responses {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "%v{handler=%v,code=\"%d\"} %d\n", responses, labelValue(name), code, hm.responses[code])
+		}
+	}
+}
+
+// labelValue returns s as a quoted Prometheus label value.
+func labelValue(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,213 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/dhowden/httpauth"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	h := NewHandler(Creds(map[string]string{"alice": "shhhh"}), http.HandlerFunc(handlerFuncOK), Instrument(m, "api"))
+
+	for _, pass := range []string{"shhhh", "wrong", "wrong"} {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.SetBasicAuth("alice", pass)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	r, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, r)
+
+	body := w.Body.String()
+	for _, l := range []string{
+		`httpauth_attempts_total{handler="api"} 3`,
+		`httpauth_successes_total{handler="api"} 1`,
+		`httpauth_failures_total{handler="api"} 2`,
+		`httpauth_check_duration_seconds_bucket{handler="api",le="+Inf"} 3`,
+		`httpauth_check_duration_seconds_count{handler="api"} 3`,
+		`httpauth_responses_total{handler="api",code="200"} 1`,
+	} {
+		if !strings.Contains(body, l+"\n") {
+			t.Errorf("metrics output missing %q:\n%v", l, body)
+		}
+	}
+}
+
+func TestMetricsResponseWriter(t *testing.T) {
+	m := NewMetrics()
+	var flusher, hijacker bool
+	h := NewHandler(fixedChecker(true), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flusher = w.(http.Flusher)
+		_, hijacker = w.(http.Hijacker)
+		w.WriteHeader(http.StatusTeapot)
+	}), Instrument(m, "api"))
+
+	// httptest.ResponseRecorder implements http.Flusher but not http.Hijacker.
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if !flusher || hijacker {
+		t.Errorf("wrapped recorder: http.Flusher = %v, http.Hijacker = %v, expected true, false", flusher, hijacker)
+	}
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+	resp, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatalf("unexpected error making request: %v", err)
+	}
+	resp.Body.Close()
+	if !flusher || !hijacker {
+		t.Errorf("wrapped server writer: http.Flusher = %v, http.Hijacker = %v, expected true, true", flusher, hijacker)
+	}
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, r)
+	if l := `httpauth_responses_total{handler="api",code="418"} 2`; !strings.Contains(w.Body.String(), l+"\n") {
+		t.Errorf("metrics output missing %q:\n%v", l, w.Body.String())
+	}
+}
+
+type testSpan struct {
+	name  string
+	attrs map[string]interface{}
+	ended bool
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *testSpan) End()                                       { s.ended = true }
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) Span {
+	s := &testSpan{name: name, attrs: make(map[string]interface{})}
+	t.spans = append(t.spans, s)
+	return s
+}
+
+func TestTrace(t *testing.T) {
+	tr := &testTracer{}
+	h := NewHandler(Creds(map[string]string{"alice": "shhhh"}), http.HandlerFunc(handlerFuncOK), Trace(tr))
+
+	for _, pass := range []string{"shhhh", "wrong"} {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.SetBasicAuth("alice", pass)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if len(tr.spans) != 2 {
+		t.Fatalf("got %d spans, expected 2", len(tr.spans))
+	}
+	for ii, outcome := range []string{"success", "failure"} {
+		s := tr.spans[ii]
+		if s.name != "httpauth.check" || !s.ended {
+			t.Errorf("[%d] span %q ended = %v, expected %q ended", ii, s.name, s.ended, "httpauth.check")
+		}
+		if s.attrs[TraceAttrOutcome] != outcome {
+			t.Errorf("[%d] outcome = %v, expected %v", ii, s.attrs[TraceAttrOutcome], outcome)
+		}
+		if s.attrs[TraceAttrScheme] != "basic" {
+			t.Errorf("[%d] scheme = %v, expected %v", ii, s.attrs[TraceAttrScheme], "basic")
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	var successes []string
+	var failures []error
+	h := NewHandler(Creds(map[string]string{"alice": "shhhh"}), http.HandlerFunc(handlerFuncOK),
+		OnSuccess(func(r *http.Request, username string) { successes = append(successes, username) }),
+		OnFailure(func(r *http.Request, username string, reason error) { failures = append(failures, reason) }),
+	)
+
+	for _, pass := range []string{"shhhh", "wrong", ""} {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		if pass != "" {
+			r.SetBasicAuth("alice", pass)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if len(successes) != 1 || successes[0] != "alice" {
+		t.Errorf("successes = %v, expected [alice]", successes)
+	}
+	if len(failures) != 2 || failures[0] != ErrInvalidCredentials || failures[1] != ErrNoCredentials {
+		t.Errorf("failures = %v, expected [%v %v]", failures, ErrInvalidCredentials, ErrNoCredentials)
+	}
+}
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, nil))
+	h := NewHandler(Creds(map[string]string{"alice": "shhhh"}), http.HandlerFunc(handlerFuncOK), Log(l))
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	r.SetBasicAuth("alice", "wrong")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if out := buf.String(); !strings.Contains(out, "authentication failed") || !strings.Contains(out, "username=alice") {
+		t.Errorf("unexpected log output: %q", out)
+	}
+}
+
+func TestLogWithHooks(t *testing.T) {
+	for _, logFirst := range []bool{true, false} {
+		var buf bytes.Buffer
+		var successes, failures int
+		opts := []Option{
+			OnSuccess(func(*http.Request, string) { successes++ }),
+			OnFailure(func(*http.Request, string, error) { failures++ }),
+		}
+		if logFirst {
+			opts = append([]Option{Log(slog.New(slog.NewTextHandler(&buf, nil)))}, opts...)
+		} else {
+			opts = append(opts, Log(slog.New(slog.NewTextHandler(&buf, nil))))
+		}
+		h := NewHandler(Creds(map[string]string{"alice": "shhhh"}), http.HandlerFunc(handlerFuncOK), opts...)
+
+		for _, pass := range []string{"shhhh", "wrong"} {
+			r, err := http.NewRequest("GET", "/", nil)
+			if err != nil {
+				t.Fatalf("unexpected error creating request: %v", err)
+			}
+			r.SetBasicAuth("alice", pass)
+			h.ServeHTTP(httptest.NewRecorder(), r)
+		}
+
+		out := buf.String()
+		if successes != 1 || failures != 1 || !strings.Contains(out, "authentication succeeded") || !strings.Contains(out, "authentication failed") {
+			t.Errorf("log first %v: successes = %d, failures = %d, log output: %q", logFirst, successes, failures, out)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// RoundTripFunc is a function which sends an HTTP request and returns its response.
+type RoundTripFunc func(r *http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper.
+func (f RoundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// ClientMiddleware wraps a RoundTripFunc, e.g. to sign, retry or log requests.
+type ClientMiddleware func(next RoundTripFunc) RoundTripFunc
+
+// Chain returns an http.RoundTripper which sends requests through the middleware (the
+// first outermost) and then base (http.DefaultTransport if nil).  For example
+//
+//	Chain(nil, LogMiddleware(l), RetryMiddleware(p), SignMiddleware(s))
+//
+// logs each request once, and signs each retry afresh.
+func Chain(base http.RoundTripper, mw ...ClientMiddleware) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return chain(base.RoundTrip, mw)
+}
+
+// chain wraps send in the middleware, the first outermost.
+func chain(send RoundTripFunc, mw []ClientMiddleware) RoundTripFunc {
+	for i := len(mw) - 1; i >= 0; i-- {
+		send = mw[i](send)
+	}
+	return send
+}
+
+// SignMiddleware returns ClientMiddleware which signs a copy of each request using s
+// (or the Signer set by WithSigner), retrying challenged requests once as NewTransport
+// does.
+func SignMiddleware(s Signer) ClientMiddleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(r *http.Request) (*http.Response, error) {
+			return signAndSend(requestSigner(r, s), next, r.Clone(r.Context()))
+		}
+	}
+}
+
+// RetryMiddleware returns ClientMiddleware which retries requests with transient
+// failures using the RetryPolicy, as for Client.Retry.
+func RetryMiddleware(p *RetryPolicy) ClientMiddleware {
+	c := &Client{Retry: p}
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(r *http.Request) (*http.Response, error) {
+			return c.doRetries(r, next)
+		}
+	}
+}
+
+// LogMiddleware returns ClientMiddleware which logs each request to l: responses at
+// slog.LevelInfo and errors at slog.LevelWarn.  Query strings are not logged, as they
+// may carry credentials.
+func LogMiddleware(l *slog.Logger) ClientMiddleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(r *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next(r)
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("host", r.URL.Host),
+				slog.String("path", r.URL.Path),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if err != nil {
+				l.LogAttrs(r.Context(), slog.LevelWarn, "request failed", append(attrs, slog.String("error", err.Error()))...)
+				return resp, err
+			}
+			l.LogAttrs(r.Context(), slog.LevelInfo, "request sent", append(attrs, slog.Int("status", resp.StatusCode))...)
+			return resp, nil
+		}
+	}
+}
@@ -0,0 +1,488 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureKeySource defines the SignatureKey method which provides keys for verifying
+// HTTP message signatures.
+type SignatureKeySource interface {
+	// SignatureKey returns the key with the key ID, and false if there is no such key.
+	// Keys must be ed25519.PublicKey, *rsa.PublicKey, *ecdsa.PublicKey (P-256) or
+	// []byte (HMAC secrets).
+	SignatureKey(keyID string) (interface{}, bool)
+}
+
+// SignatureKeys creates a SignatureKeySource which uses the map of key ID-key pairs.
+func SignatureKeys(m map[string]interface{}) SignatureKeySource {
+	return signatureKeys{
+		m: m,
+	}
+}
+
+type signatureKeys struct {
+	m map[string]interface{}
+}
+
+// SignatureKey implements SignatureKeySource.
+func (s signatureKeys) SignatureKey(keyID string) (interface{}, bool) {
+	k, ok := s.m[keyID]
+	return k, ok
+}
+
+// MessageSignatureVerifier verifies HTTP Message Signatures (RFC 9421) in the
+// Signature-Input and Signature request headers.  The algorithms ed25519,
+// rsa-pss-sha512, rsa-v1_5-sha256, ecdsa-p256-sha256 and hmac-sha256 are supported; if
+// a signature has no alg parameter then the algorithm is chosen by the type of key
+// (rsa-pss-sha512 for RSA keys).  If content-digest is covered by the signature, the
+// Content-Digest header (RFC 9530) is checked against the request body.
+type MessageSignatureVerifier struct {
+	// Keys provides the verification keys by key ID.
+	Keys SignatureKeySource
+
+	// Required lists the components which a signature must cover.  Defaults to
+	// "@method", "@authority" and "@path".
+	Required []string
+
+	// MaxAge is the maximum age of a signature, according to its created parameter.
+	// Defaults to 5 minutes.  If negative then the created parameter is not required.
+	MaxAge time.Duration
+
+	// Nonces, if non-nil, records the nonce parameter of each signature so that
+	// requests cannot be replayed, and signatures without a nonce are rejected.  Nonces
+	// are kept for MaxAge, or until the signature's expires parameter if later.  If
+	// MaxAge is negative they are kept for 5 minutes (or until expires), so a signature
+	// with neither created nor expires parameter can be replayed after that.
+	Nonces NonceStore
+
+	// MaxBody is the maximum size of request body which will be read to check the
+	// Content-Digest header.  Defaults to 10MB.
+	MaxBody int64
+}
+
+// defaultSignatureMaxAge is the default MessageSignatureVerifier.MaxAge.
+const defaultSignatureMaxAge = 5 * time.Minute
+
+// NewMessageSignatureHandler returns an http.Handler which verifies HTTP message
+// signatures using the MessageSignatureVerifier and passes requests to the given
+// http.Handler when a signature is valid (responds with http.StatusUnauthorized
+// otherwise).
+func NewMessageSignatureHandler(v *MessageSignatureVerifier, h http.Handler) http.Handler {
+	vv := *v
+	v = &vv
+	if v.Required == nil {
+		v.Required = []string{"@method", "@authority", "@path"}
+	}
+	if v.MaxAge == 0 {
+		v.MaxAge = defaultSignatureMaxAge
+	}
+	if v.MaxBody == 0 {
+		v.MaxBody = maxSignedBody
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !v.verify(r) {
+			unauthorized(w, r, "")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// verify returns true if any of the signatures of r is valid.
+func (v *MessageSignatureVerifier) verify(r *http.Request) bool {
+	inputs, err := parseSFDictionary(strings.Join(r.Header.Values("Signature-Input"), ", "))
+	if err != nil || len(inputs) == 0 {
+		return false
+	}
+	sigs, err := parseSFDictionary(strings.Join(r.Header.Values("Signature"), ", "))
+	if err != nil {
+		return false
+	}
+	for _, in := range inputs {
+		for _, sig := range sigs {
+			if sig.key != in.key || sig.inner || len(sig.items) != 1 {
+				continue
+			}
+			if b, ok := sig.items[0].([]byte); ok && v.verifySignature(r, in, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// verifySignature returns true if sig is a valid signature of r with the signature
+// input in.
+func (v *MessageSignatureVerifier) verifySignature(r *http.Request, in sfMember, sig []byte) bool {
+	if !in.inner {
+		return false
+	}
+	components := make([]string, 0, len(in.items))
+	for _, x := range in.items {
+		c, ok := x.(string)
+		if !ok {
+			return false
+		}
+		components = append(components, c)
+	}
+	for _, c := range v.Required {
+		if !containsString(components, c) {
+			return false
+		}
+	}
+
+	now := time.Now()
+	created, ok := in.params["created"].(int64)
+	if v.MaxAge > 0 {
+		if !ok {
+			return false
+		}
+		if age := now.Sub(time.Unix(created, 0)); age > v.MaxAge || age < -v.MaxAge {
+			return false
+		}
+	}
+	expires, hasExpires := in.params["expires"].(int64)
+	if hasExpires && !now.Before(time.Unix(expires, 0)) {
+		return false
+	}
+
+	keyID, _ := in.params["keyid"].(string)
+	key, ok := v.Keys.SignatureKey(keyID)
+	if !ok {
+		return false
+	}
+	alg, _ := in.params["alg"].(string)
+	if alg == "" {
+		alg = defaultSignatureAlg(key)
+	}
+
+	base, ok := signatureBase(r, components, in.raw)
+	if !ok || !verifyMessageSignature(alg, key, []byte(base), sig) {
+		return false
+	}
+	if containsString(components, "content-digest") && !v.checkContentDigest(r) {
+		return false
+	}
+	if v.Nonces != nil {
+		nonce, _ := in.params["nonce"].(string)
+		retain := v.MaxAge
+		if retain <= 0 {
+			retain = defaultSignatureMaxAge
+		}
+		until := now.Add(retain)
+		if hasExpires && time.Unix(expires, 0).After(until) {
+			until = time.Unix(expires, 0)
+		}
+		if nonce == "" || v.Nonces.Seen(keyID+":"+nonce, until) {
+			return false
+		}
+	}
+	return true
+}
+
+// signatureBase returns the signature base (RFC 9421 section 2.5) for the components of
+// r, where params is the serialized signature parameters.
+func signatureBase(r *http.Request, components []string, params string) (string, bool) {
+	var b strings.Builder
+	for _, c := range components {
+		value, ok := componentValue(r, c)
+		if !ok {
+			return "", false
+		}
+		b.WriteString(`"` + c + `": ` + value + "\n")
+	}
+	b.WriteString(`"@signature-params": ` + params)
+	return b.String(), true
+}
+
+// componentValue returns the value of the named component of r.  The scheme is https
+// for requests received over TLS or (when signing) sent to https URLs.
+func componentValue(r *http.Request, name string) (string, bool) {
+	scheme := "http"
+	if r.TLS != nil || r.URL.Scheme == "https" {
+		scheme = "https"
+	}
+	switch name {
+	case "@method":
+		return r.Method, true
+	case "@target-uri":
+		return scheme + "://" + strings.ToLower(r.Host) + r.URL.RequestURI(), true
+	case "@authority":
+		return strings.ToLower(r.Host), true
+	case "@scheme":
+		return scheme, true
+	case "@request-target":
+		return r.URL.RequestURI(), true
+	case "@path":
+		if p := r.URL.EscapedPath(); p != "" {
+			return p, true
+		}
+		return "/", true
+	case "@query":
+		return "?" + r.URL.RawQuery, true
+	}
+	if strings.HasPrefix(name, "@") || name != strings.ToLower(name) {
+		return "", false
+	}
+	values := r.Header.Values(name)
+	if len(values) == 0 {
+		return "", false
+	}
+	trimmed := make([]string, len(values)) // values is the request's own header slice
+	for i, v := range values {
+		trimmed[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(trimmed, ", "), true
+}
+
+// defaultSignatureAlg returns the algorithm used for key if none is specified.
+func defaultSignatureAlg(key interface{}) string {
+	switch key.(type) {
+	case ed25519.PublicKey, ed25519.PrivateKey:
+		return "ed25519"
+	case *rsa.PublicKey, *rsa.PrivateKey:
+		return "rsa-pss-sha512"
+	case *ecdsa.PublicKey, *ecdsa.PrivateKey:
+		return "ecdsa-p256-sha256"
+	case []byte:
+		return "hmac-sha256"
+	}
+	return ""
+}
+
+// verifyMessageSignature returns true if sig is a valid signature of base using the
+// algorithm alg and key.
+func verifyMessageSignature(alg string, key interface{}, base, sig []byte) bool {
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return alg == "ed25519" && len(k) == ed25519.PublicKeySize && ed25519.Verify(k, base, sig)
+
+	case *rsa.PublicKey:
+		switch alg {
+		case "rsa-pss-sha512":
+			h := sha512.Sum512(base)
+			return rsa.VerifyPSS(k, crypto.SHA512, h[:], sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		case "rsa-v1_5-sha256":
+			h := sha256.Sum256(base)
+			return rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], sig) == nil
+		}
+
+	case *ecdsa.PublicKey:
+		if alg != "ecdsa-p256-sha256" || len(sig) != 64 {
+			return false
+		}
+		h := sha256.Sum256(base)
+		return ecdsa.Verify(k, h[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+
+	case []byte:
+		if alg != "hmac-sha256" {
+			return false
+		}
+		mac := hmac.New(sha256.New, k)
+		mac.Write(base)
+		return hmac.Equal(sig, mac.Sum(nil))
+	}
+	return false
+}
+
+// checkContentDigest returns true if the Content-Digest header of r contains at least
+// one sha-256 or sha-512 digest, and all such digests match the body.
+func (v *MessageSignatureVerifier) checkContentDigest(r *http.Request) bool {
+	digests, err := parseSFDictionary(strings.Join(r.Header.Values("Content-Digest"), ", "))
+	if err != nil {
+		return false
+	}
+	body, ok := readBody(r, v.MaxBody)
+	if !ok {
+		return false
+	}
+
+	checked := false
+	for _, d := range digests {
+		var sum []byte
+		switch d.key {
+		case "sha-256":
+			h := sha256.Sum256(body)
+			sum = h[:]
+		case "sha-512":
+			h := sha512.Sum512(body)
+			sum = h[:]
+		default:
+			continue
+		}
+		if d.inner || len(d.items) != 1 {
+			return false
+		}
+		if b, ok := d.items[0].([]byte); !ok || subtle.ConstantTimeCompare(b, sum) != 1 {
+			return false
+		}
+		checked = true
+	}
+	return checked
+}
+
+// MessageSignatureSigner is a Signer which adds HTTP Message Signatures (RFC 9421) to
+// requests, in the Signature-Input and Signature headers, for verification by
+// MessageSignatureVerifier (or other implementations).  If content-digest is covered
+// then the Content-Digest header (RFC 9530) is set to the sha-256 digest of the body.
+type MessageSignatureSigner struct {
+	KeyID string
+
+	// Key is the signing key, which must be ed25519.PrivateKey, *rsa.PrivateKey,
+	// *ecdsa.PrivateKey (P-256) or []byte (HMAC secret).
+	Key interface{}
+
+	// Alg is the signature algorithm, as for MessageSignatureVerifier.  Defaults to the
+	// algorithm for the type of Key (rsa-pss-sha512 for RSA keys).
+	Alg string
+
+	// Components lists the covered components.  Defaults to "@method", "@authority"
+	// and "@path", and also "content-digest" for requests with a body.
+	Components []string
+
+	// Label is the signature label.  Defaults to "sig1".
+	Label string
+
+	// Expires, if non-zero, is the lifetime of signatures, sent in the expires
+	// parameter.
+	Expires time.Duration
+
+	// Nonce adds a random nonce parameter to signatures, as required by verifiers
+	// which reject replayed requests.
+	Nonce bool
+}
+
+// Sign implements Signer.
+func (s MessageSignatureSigner) Sign(r *http.Request) error {
+	components := s.Components
+	if components == nil {
+		components = []string{"@method", "@authority", "@path"}
+		if r.Body != nil && r.Body != http.NoBody {
+			components = append(components, "content-digest")
+		}
+	}
+	if containsString(components, "content-digest") {
+		if err := setContentDigest(r); err != nil {
+			return err
+		}
+	}
+
+	alg := s.Alg
+	if alg == "" {
+		alg = defaultSignatureAlg(s.Key)
+	}
+	quoted := make([]string, len(components))
+	for i, c := range components {
+		quoted[i] = quote(c)
+	}
+	now := time.Now()
+	params := "(" + strings.Join(quoted, " ") + ");created=" + strconv.FormatInt(now.Unix(), 10)
+	if s.Expires != 0 {
+		params += ";expires=" + strconv.FormatInt(now.Add(s.Expires).Unix(), 10)
+	}
+	if s.Nonce {
+		nonce, err := randomString(16)
+		if err != nil {
+			return err
+		}
+		params += ";nonce=" + quote(nonce)
+	}
+	params += ";keyid=" + quote(s.KeyID) + ";alg=" + quote(alg)
+
+	base, ok := signatureBase(r, components, params)
+	if !ok {
+		return errSignatureComponent
+	}
+	sig, err := signMessageSignature(alg, s.Key, []byte(base))
+	if err != nil {
+		return err
+	}
+
+	label := s.Label
+	if label == "" {
+		label = "sig1"
+	}
+	r.Header.Set("Signature-Input", label+"="+params)
+	r.Header.Set("Signature", label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+// Errors returned by MessageSignatureSigner.
+var (
+	errSignatureComponent = errors.New("httpauth: covered signature component is missing from request")
+	errSignatureKey       = errors.New("httpauth: unsupported signature algorithm or key")
+)
+
+// setContentDigest sets the Content-Digest header of r to the sha-256 digest of its
+// body, buffering the body if necessary (see bodyDigest).
+func setContentDigest(r *http.Request) error {
+	digest, err := bodyDigest(r)
+	if err != nil {
+		return err
+	}
+	sum, _ := hex.DecodeString(digest)
+	r.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum)+":")
+	return nil
+}
+
+// signMessageSignature returns the signature of base using the algorithm alg and key.
+func signMessageSignature(alg string, key interface{}, base []byte) ([]byte, error) {
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		if alg == "ed25519" {
+			return ed25519.Sign(k, base), nil
+		}
+
+	case *rsa.PrivateKey:
+		switch alg {
+		case "rsa-pss-sha512":
+			h := sha512.Sum512(base)
+			return rsa.SignPSS(rand.Reader, k, crypto.SHA512, h[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		case "rsa-v1_5-sha256":
+			h := sha256.Sum256(base)
+			return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, h[:])
+		}
+
+	case *ecdsa.PrivateKey:
+		if alg == "ecdsa-p256-sha256" && k.Curve == elliptic.P256() {
+			h := sha256.Sum256(base)
+			r, s, err := ecdsa.Sign(rand.Reader, k, h[:])
+			if err != nil {
+				return nil, err
+			}
+			sig := make([]byte, 64)
+			r.FillBytes(sig[:32])
+			s.FillBytes(sig[32:])
+			return sig, nil
+		}
+
+	case []byte:
+		if alg == "hmac-sha256" {
+			mac := hmac.New(sha256.New, k)
+			mac.Write(base)
+			return mac.Sum(nil), nil
+		}
+	}
+	return nil, errSignatureKey
+}
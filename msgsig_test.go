@@ -0,0 +1,244 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/dhowden/httpauth"
+)
+
+// signMessage adds Signature-Input and Signature headers to r covering the components,
+// using sign to compute the signature of the signature base.
+func signMessage(r *http.Request, components []string, params string, sign func([]byte) []byte) {
+	var b strings.Builder
+	quoted := make([]string, len(components))
+	for i, c := range components {
+		var v string
+		switch c {
+		case "@method":
+			v = r.Method
+		case "@authority":
+			v = r.Host
+		case "@path":
+			v = r.URL.Path
+		default:
+			v = r.Header.Get(c)
+		}
+		fmt.Fprintf(&b, "%q: %s\n", c, v)
+		quoted[i] = `"` + c + `"`
+	}
+	input := "(" + strings.Join(quoted, " ") + ")" + params
+	b.WriteString(`"@signature-params": ` + input)
+
+	r.Header.Set("Signature-Input", "sig1="+input)
+	r.Header.Set("Signature", "sig1=:"+base64.StdEncoding.EncodeToString(sign([]byte(b.String())))+":")
+}
+
+func TestMessageSignatures(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	secret := []byte("shhhh")
+	h := NewMessageSignatureHandler(&MessageSignatureVerifier{
+		Keys: SignatureKeys(map[string]interface{}{
+			"ed": pub,
+			"hm": secret,
+		}),
+		Nonces: NewMemoryNonceStore(),
+	}, http.HandlerFunc(handlerFuncOK))
+
+	edSign := func(b []byte) []byte { return ed25519.Sign(priv, b) }
+	hmacSign := func(b []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(b)
+		return mac.Sum(nil)
+	}
+	now := time.Now().Unix()
+	params := func(keyID string, created int64, nonce string) string {
+		return fmt.Sprintf(`;created=%d;keyid="%s";nonce="%s"`, created, keyID, nonce)
+	}
+	digest := func(body string) string {
+		sum := sha256.Sum256([]byte(body))
+		return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	}
+	all := []string{"@method", "@authority", "@path", "content-digest"}
+
+	tests := []struct {
+		name       string
+		body       string
+		digest     string
+		components []string
+		params     string
+		sign       func([]byte) []byte
+		code       int
+	}{
+		{"ed25519", "hello", digest("hello"), all, params("ed", now, "1"), edSign, http.StatusOK},
+		{"hmac", "hello", digest("hello"), all, params("hm", now, "2") + `;alg="hmac-sha256"`, hmacSign, http.StatusOK},
+		{"replay", "hello", digest("hello"), all, params("ed", now, "1"), edSign, http.StatusUnauthorized},
+		{"no nonce", "hello", digest("hello"), all, fmt.Sprintf(`;created=%d;keyid="ed"`, now), edSign, http.StatusUnauthorized},
+		{"wrong key", "hello", digest("hello"), all, params("hm", now, "3"), edSign, http.StatusUnauthorized},
+		{"wrong alg", "hello", digest("hello"), all, params("ed", now, "4") + `;alg="hmac-sha256"`, edSign, http.StatusUnauthorized},
+		{"unknown key", "hello", digest("hello"), all, params("xx", now, "5"), edSign, http.StatusUnauthorized},
+		{"tampered body", "goodbye", digest("hello"), all, params("ed", now, "6"), edSign, http.StatusUnauthorized},
+		{"missing component", "hello", "", []string{"@method", "@path"}, params("ed", now, "7"), edSign, http.StatusUnauthorized},
+		{"expired", "hello", digest("hello"), all, params("ed", now-3600, "8"), edSign, http.StatusUnauthorized},
+		{"expires", "hello", digest("hello"), all, params("ed", now, "9") + fmt.Sprintf(";expires=%d", now-1), edSign, http.StatusUnauthorized},
+		{"empty digest list", "hello", "sha-256=()", all, params("ed", now, "11"), edSign, http.StatusUnauthorized},
+		{"digest list", "hello", "sha-256=(" + strings.TrimPrefix(digest("hello"), "sha-256=") + ")", all, params("ed", now, "12"), edSign, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		r, err := http.NewRequest("POST", "http://example.com/foo", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		if tt.digest != "" {
+			r.Header.Set("Content-Digest", tt.digest)
+		}
+		signMessage(r, tt.components, tt.params, tt.sign)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s: w.Code = %d, expected: %d", tt.name, w.Code, tt.code)
+		}
+	}
+
+	// Tampered method
+	r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	signMessage(r, []string{"@method", "@authority", "@path"}, params("ed", now, "10"), edSign)
+	r.Method = "DELETE"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("tampered method: w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// Nonces are remembered when created is not required.
+	h = NewMessageSignatureHandler(&MessageSignatureVerifier{
+		Keys:   SignatureKeys(map[string]interface{}{"ed": pub}),
+		MaxAge: -1,
+		Nonces: NewMemoryNonceStore(),
+	}, http.HandlerFunc(handlerFuncOK))
+	for i, code := range []int{http.StatusOK, http.StatusUnauthorized} {
+		r, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+		signMessage(r, []string{"@method", "@authority", "@path"}, `;keyid="ed";nonce="1"`, edSign)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != code {
+			t.Errorf("MaxAge -1 request %d: w.Code = %d, expected: %d", i, w.Code, code)
+		}
+	}
+}
+
+func TestMessageSignatureSigner(t *testing.T) {
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	secret := []byte("shhhh")
+
+	var body string
+	srv := httptest.NewServer(NewMessageSignatureHandler(&MessageSignatureVerifier{
+		Keys: SignatureKeys(map[string]interface{}{
+			"ed":  edPub,
+			"rsa": &rsaKey.PublicKey,
+			"ec":  &ecKey.PublicKey,
+			"hm":  secret,
+		}),
+		Required: []string{"@method", "@authority", "@path", "content-digest"},
+		Nonces:   NewMemoryNonceStore(),
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		handlerFuncOK(w, r)
+	})))
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		s    MessageSignatureSigner
+		code int
+	}{
+		{"ed25519", MessageSignatureSigner{KeyID: "ed", Key: edPriv, Nonce: true}, http.StatusOK},
+		{"rsa-pss-sha512", MessageSignatureSigner{KeyID: "rsa", Key: rsaKey, Nonce: true, Label: "req"}, http.StatusOK},
+		{"rsa-v1_5-sha256", MessageSignatureSigner{KeyID: "rsa", Key: rsaKey, Alg: "rsa-v1_5-sha256", Nonce: true}, http.StatusOK},
+		{"ecdsa-p256-sha256", MessageSignatureSigner{KeyID: "ec", Key: ecKey, Nonce: true, Expires: time.Minute}, http.StatusOK},
+		{"hmac-sha256", MessageSignatureSigner{KeyID: "hm", Key: secret, Nonce: true}, http.StatusOK},
+		{"components", MessageSignatureSigner{KeyID: "hm", Key: secret, Nonce: true, Components: []string{"@method", "@authority", "@path", "@query", "content-digest", "content-type"}}, http.StatusOK},
+		{"no nonce", MessageSignatureSigner{KeyID: "ed", Key: edPriv}, http.StatusUnauthorized},
+		{"wrong key", MessageSignatureSigner{KeyID: "hm", Key: []byte("wrong"), Nonce: true}, http.StatusUnauthorized},
+		{"missing component", MessageSignatureSigner{KeyID: "ed", Key: edPriv, Nonce: true, Components: []string{"@method", "@path"}}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		body = ""
+		c := &Client{Signer: tt.s}
+		resp, err := c.Post(srv.URL+"/foo?a=1", "text/plain", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatalf("%s: c.Post() returned unexpected error: %v", tt.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.code {
+			t.Errorf("%s: resp.StatusCode = %d, expected: %d", tt.name, resp.StatusCode, tt.code)
+		}
+		if tt.code == http.StatusOK && body != "hello" {
+			t.Errorf("%s: body = %q, expected: %q", tt.name, body, "hello")
+		}
+	}
+
+	r, _ := http.NewRequest("GET", srv.URL, nil)
+	if err := (MessageSignatureSigner{KeyID: "ed", Key: edPriv, Alg: "hmac-sha256"}).Sign(r); err == nil {
+		t.Errorf("Sign() with mismatched alg returned nil error")
+	}
+	if err := (MessageSignatureSigner{KeyID: "ed", Key: edPriv, Components: []string{"x-missing"}}).Sign(r); err == nil {
+		t.Errorf("Sign() with missing component returned nil error")
+	}
+
+	// Signing and verifying must not change the headers covered by the signature.
+	r, _ = http.NewRequest("GET", "http://example.com/foo", nil)
+	r.Header.Add("X-Padded", " a ")
+	r.Header.Add("X-Padded", "b ")
+	if err := (MessageSignatureSigner{KeyID: "ed", Key: edPriv, Components: []string{"@method", "@authority", "@path", "x-padded"}}).Sign(r); err != nil {
+		t.Fatalf("unexpected error signing request: %v", err)
+	}
+	var got []string
+	h := NewMessageSignatureHandler(&MessageSignatureVerifier{
+		Keys:     SignatureKeys(map[string]interface{}{"ed": edPub}),
+		Required: []string{"@method", "x-padded"},
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Values("X-Padded")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if expected := []string{" a ", "b "}; w.Code != http.StatusOK || !reflect.DeepEqual(got, expected) {
+		t.Errorf("w.Code = %d, X-Padded = %q, expected: %d, %q", w.Code, got, http.StatusOK, expected)
+	}
+}
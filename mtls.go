@@ -0,0 +1,52 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// NewMTLSClient creates an http.Client which presents the client certificate and key
+// from the PEM files certFile and keyFile to servers which require TLS client
+// authentication (see CertChecker).  If caFile is not empty then the server certificate
+// must be issued by one of the CA certificates in the PEM file, rather than by the
+// system roots.  If s is not nil then requests are also signed (see NewTransport), for
+// APIs which require both a client certificate and a token.
+func NewMTLSClient(certFile, keyFile, caFile string, s Signer) (*http.Client, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("httpauth: loading client certificate: %v", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if caFile != "" {
+		b, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("httpauth: loading CA certificates: %v", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("httpauth: no CA certificates in %v", caFile)
+		}
+	}
+
+	tr := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if dt, ok := http.DefaultTransport.(*http.Transport); ok {
+		tr = dt.Clone()
+	}
+	tr.TLSClientConfig = cfg
+
+	var rt http.RoundTripper = tr
+	if s != nil {
+		rt = NewTransport(s, tr)
+	}
+	return &http.Client{Transport: rt}, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Scheme is an HTTP authentication scheme which can be combined with others using
+// NewMultiHandler.
+type Scheme interface {
+	// Authenticate returns true if r is authenticated by the scheme, along with the
+	// request to pass on (which may carry additional context).
+	Authenticate(r *http.Request) (*http.Request, bool)
+
+	// Challenge returns the WWW-Authenticate challenge for the scheme.
+	Challenge() string
+}
+
+// BasicScheme creates a Scheme which checks basic HTTP authentication using the Checker.
+func BasicScheme(c Checker) Scheme {
+	return basicScheme{c}
+}
+
+type basicScheme struct {
+	c Checker
+}
+
+// Authenticate implements Scheme.
+func (s basicScheme) Authenticate(r *http.Request) (*http.Request, bool) {
+	username, password, ok := r.BasicAuth()
+	return r, ok && s.c.Check(username, password)
+}
+
+// Challenge implements Scheme.
+func (s basicScheme) Challenge() string { return "Basic" }
+
+// BearerScheme creates a Scheme which validates bearer tokens using the TokenChecker,
+// adding the token claims to the request context (see ClaimsFromContext).  Tokens bound
+// to a DPoP key (with a cnf.jkt claim) are rejected with ErrDPoPBinding, as they must be
+// presented with a proof (see DPoPScheme, RFC 9449 section 7.1).
+func BearerScheme(tc TokenChecker) Scheme {
+	return bearerScheme{tc}
+}
+
+type bearerScheme struct {
+	tc TokenChecker
+}
+
+// Authenticate implements Scheme.
+func (s bearerScheme) Authenticate(r *http.Request) (*http.Request, bool) {
+	rr, err := s.authenticate(r)
+	return rr, err == nil
+}
+
+// authenticate implements detailedScheme.
+func (s bearerScheme) authenticate(r *http.Request) (*http.Request, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return r, ErrNoCredentials
+	}
+	claims, err := s.tc.CheckToken(token)
+	if err != nil {
+		return r, err
+	}
+	if cnf, _ := claims["cnf"].(map[string]interface{}); cnf["jkt"] != nil {
+		return r, ErrDPoPBinding
+	}
+	return r.WithContext(context.WithValue(r.Context(), claimsKey{}, claims)), nil
+}
+
+// Challenge implements Scheme.
+func (s bearerScheme) Challenge() string { return "Bearer" }
+
+// challenge implements detailedScheme, describing why a presented token was rejected
+// as in RFC 6750 section 3.
+func (s bearerScheme) challenge(err error) string {
+	if err == ErrNoCredentials {
+		return "Bearer"
+	}
+	return `Bearer error="invalid_token", error_description=` + quote(tokenErrorDescription(err))
+}
+
+// tokenErrorDescription returns the description of a token validation error for use in
+// a challenge.  Only the errors defined by this package are described, so that others
+// (e.g. from fetching keys) are not exposed to clients.
+func tokenErrorDescription(err error) string {
+	switch err {
+	case ErrTokenMalformed, ErrTokenUnsupportedAlg, ErrTokenSignature, ErrTokenUnknownKey,
+		ErrTokenExpired, ErrTokenNotYetValid, ErrTokenIssuer, ErrTokenAudience, ErrTokenInactive,
+		ErrDPoPProof, ErrDPoPReplay, ErrDPoPBinding:
+	default:
+		err = ErrTokenInvalid
+	}
+	return strings.TrimPrefix(err.Error(), "httpauth: ")
+}
+
+// AuthInfoScheme is implemented by Schemes which send an Authentication-Info header
+// (RFC 7615) in responses to authenticated requests, such as the server signature of
+// SCRAM (see NewSCRAMHandler).  There is no server-side Digest Scheme, so the nextnonce
+// and rspauth parameters of Digest authentication are not sent.
+type AuthInfoScheme interface {
+	Scheme
+
+	// AuthenticationInfo returns the Authentication-Info header value for the
+	// authenticated request r, or the empty string if none should be sent.
+	AuthenticationInfo(r *http.Request) string
+}
+
+// detailedScheme is implemented by Schemes whose challenge depends on the reason that
+// authentication failed.
+type detailedScheme interface {
+	authenticate(r *http.Request) (*http.Request, error)
+	challenge(err error) string
+}
+
+// NewMultiHandler returns an http.Handler which passes requests to the given http.Handler
+// when they are authenticated by any of the schemes (tried in order), and otherwise
+// responds with http.StatusUnauthorized and a WWW-Authenticate challenge for each scheme.
+func NewMultiHandler(h http.Handler, schemes ...Scheme) http.Handler {
+	return &multiHandler{
+		Handler: h,
+		schemes: schemes,
+	}
+}
+
+type multiHandler struct {
+	http.Handler
+	schemes []Scheme
+}
+
+// ServeHTTP implements http.Handler.
+func (h *multiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	challenges := make([]string, len(h.schemes))
+	for i, s := range h.schemes {
+		if ds, ok := s.(detailedScheme); ok {
+			rr, err := ds.authenticate(r)
+			if err == nil {
+				h.serve(w, s, rr)
+				return
+			}
+			challenges[i] = ds.challenge(err)
+			continue
+		}
+		if rr, ok := s.Authenticate(r); ok {
+			h.serve(w, s, rr)
+			return
+		}
+		challenges[i] = s.Challenge()
+	}
+
+	for _, c := range challenges {
+		w.Header().Add("WWW-Authenticate", c)
+	}
+	unauthorized(w, r, "")
+}
+
+// serve passes r, authenticated by the scheme s, to the handler, first setting the
+// Authentication-Info header if s provides one.
+func (h *multiHandler) serve(w http.ResponseWriter, s Scheme, r *http.Request) {
+	if as, ok := s.(AuthInfoScheme); ok {
+		if info := as.AuthenticationInfo(r); info != "" {
+			w.Header().Set("Authentication-Info", info)
+		}
+	}
+	h.Handler.ServeHTTP(w, r)
+}
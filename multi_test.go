@@ -0,0 +1,89 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/dhowden/httpauth"
+)
+
+func TestMultiHandler(t *testing.T) {
+	key := []byte("secret")
+	token := signHS256(t, key, map[string]interface{}{"alg": "HS256"}, map[string]interface{}{"sub": "bob"})
+
+	h := NewMultiHandler(http.HandlerFunc(handlerFuncOK),
+		BasicScheme(Creds(map[string]string{"alice": "shhhh"})),
+		BearerScheme(&JWT{Keys: HMACKey(key)}),
+	)
+
+	tests := []struct {
+		auth   string
+		code   int
+		bearer string
+	}{
+		{"", http.StatusUnauthorized, "Bearer"},
+		{"Basic YWxpY2U6c2hoaGg=", http.StatusOK, ""},
+		{"Basic YWxpY2U6d3Jvbmc=", http.StatusUnauthorized, "Bearer"},
+		{"Bearer " + token, http.StatusOK, ""},
+		{"Bearer " + token + "x", http.StatusUnauthorized, `Bearer error="invalid_token", error_description="invalid token signature"`},
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		if tt.auth != "" {
+			r.Header.Set("Authorization", tt.auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("[%d] w.Code = %d, expected: %d", ii, w.Code, tt.code)
+		}
+		if tt.code == http.StatusUnauthorized {
+			got := w.Header()["Www-Authenticate"]
+			if len(got) != 2 || got[0] != "Basic" || got[1] != tt.bearer {
+				t.Errorf("[%d] WWW-Authenticate = %v, expected [Basic %v]", ii, got, tt.bearer)
+			}
+		}
+	}
+}
+
+// infoScheme is a Scheme which sends an Authentication-Info header.
+type infoScheme struct {
+	Scheme
+}
+
+func (infoScheme) AuthenticationInfo(r *http.Request) string {
+	return `nextnonce="abc"`
+}
+
+func TestMultiHandlerAuthenticationInfo(t *testing.T) {
+	h := NewMultiHandler(http.HandlerFunc(handlerFuncOK),
+		infoScheme{BasicScheme(Creds(map[string]string{"alice": "shhhh"}))},
+	)
+
+	for ii, auth := range []string{"Basic YWxpY2U6c2hoaGg=", "Basic YWxpY2U6d3Jvbmc="} {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.Header.Set("Authorization", auth)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		expected := ""
+		if w.Code == http.StatusOK {
+			expected = `nextnonce="abc"`
+		}
+		if got := w.Header().Get("Authentication-Info"); got != expected {
+			t.Errorf("[%d] Authentication-Info = %q, expected: %q", ii, got, expected)
+		}
+	}
+}
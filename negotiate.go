@@ -0,0 +1,101 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// GSSAPIProvider defines the InitSecContext method which provides SPNEGO tokens (e.g.
+// wrapping Kerberos service tickets) for NegotiateSigner.  Implementations typically
+// wrap a GSSAPI library or a pure Go Kerberos client, using the credentials of the
+// current user (e.g. from the ticket cache or a keytab).
+type GSSAPIProvider interface {
+	// InitSecContext returns the initial SPNEGO token for the service principal
+	// name, given in host-based form (e.g. "HTTP@intranet.example.com").
+	InitSecContext(ctx context.Context, service string) ([]byte, error)
+}
+
+// NegotiateSigner is a ChallengeSigner which adds SPNEGO tokens (RFC 4559) from the
+// Provider to requests, for Kerberos-protected services.  Unless Preemptive is set,
+// requests to a host are sent without a token until the host sends a Negotiate
+// challenge, after which the request is retried (by Client or Do) and later requests
+// to the host carry tokens from the start.  Only single-leg exchanges (as used by
+// Kerberos) are supported, and the server's mutual authentication token is not checked:
+// use TLS to authenticate servers.
+//
+// A NegotiateSigner must not be copied after first use, and is safe for concurrent use.
+type NegotiateSigner struct {
+	Provider GSSAPIProvider
+
+	// Service is the service name of the service principal.  Defaults to "HTTP".  The
+	// principal name is the service name and the request host, e.g.
+	// "HTTP@intranet.example.com".
+	Service string
+
+	// Preemptive sends tokens with the first request to each host.
+	Preemptive bool
+
+	mu    sync.Mutex
+	hosts map[string]bool // hosts which have sent Negotiate challenges
+}
+
+// Sign implements Signer.
+func (n *NegotiateSigner) Sign(r *http.Request) error {
+	return n.SignContext(r.Context(), r)
+}
+
+// SignContext implements ContextSigner, passing ctx to the Provider.
+func (n *NegotiateSigner) SignContext(ctx context.Context, r *http.Request) error {
+	host := strings.ToLower(r.URL.Hostname())
+	n.mu.Lock()
+	challenged := n.hosts[host]
+	n.mu.Unlock()
+	if !challenged && !n.Preemptive {
+		return nil
+	}
+
+	token, err := n.Provider.InitSecContext(ctx, n.service()+"@"+host)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", "Negotiate "+base64.StdEncoding.EncodeToString(token))
+	return nil
+}
+
+// Challenge implements ChallengeSigner.  It returns false if resp has no Negotiate
+// challenge, or if the request already carried a token (which was rejected).
+func (n *NegotiateSigner) Challenge(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusUnauthorized || resp.Request == nil {
+		return false
+	}
+	if strings.HasPrefix(strings.ToLower(resp.Request.Header.Get("Authorization")), "negotiate ") {
+		return false
+	}
+	for _, c := range ParseChallenges(resp.Header, "WWW-Authenticate") {
+		if c.Scheme != "negotiate" {
+			continue
+		}
+		n.mu.Lock()
+		if n.hosts == nil {
+			n.hosts = make(map[string]bool)
+		}
+		n.hosts[strings.ToLower(resp.Request.URL.Hostname())] = true
+		n.mu.Unlock()
+		return true
+	}
+	return false
+}
+
+func (n *NegotiateSigner) service() string {
+	if n.Service == "" {
+		return "HTTP"
+	}
+	return n.Service
+}
@@ -0,0 +1,148 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// NetrcSigner creates a Signer which adds basic HTTP authentication credentials for the
+// request host from a netrc file, as used by curl and git.  If path is empty then the
+// file named by the NETRC environment variable is used, or otherwise .netrc in the
+// user's home directory (_netrc on Windows).  Requests to hosts without a machine entry
+// use the default entry if there is one, and are otherwise left unsigned.
+func NetrcSigner(path string) (Signer, error) {
+	if path == "" {
+		var err error
+		if path, err = netrcPath(); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseNetrc(f)
+}
+
+// netrcPath returns the path of the user's netrc file.
+func netrcPath() (string, error) {
+	if p := os.Getenv("NETRC"); p != "" {
+		return p, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	name := ".netrc"
+	if runtime.GOOS == "windows" {
+		name = "_netrc"
+	}
+	return filepath.Join(home, name), nil
+}
+
+// parseNetrc parses netrc entries from r.
+func parseNetrc(r io.Reader) (Signer, error) {
+	s := &netrcSigner{hosts: make(hostSigner)}
+
+	sc := bufio.NewScanner(r)
+	var machine string
+	var entry *BasicAuthSigner
+	var inMacro bool
+	for sc.Scan() {
+		line := sc.Text()
+		if inMacro {
+			// Macro definitions run until a blank line.
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			switch fields[i] {
+			case "machine", "default":
+				s.add(machine, entry)
+				machine, entry = "", &BasicAuthSigner{}
+				if fields[i] == "machine" && i+1 < len(fields) {
+					i++
+					machine = strings.ToLower(fields[i])
+				}
+			case "login", "password", "account":
+				if i+1 >= len(fields) {
+					continue
+				}
+				i++
+				if entry == nil {
+					continue
+				}
+				switch fields[i-1] {
+				case "login":
+					entry.User = fields[i]
+				case "password":
+					entry.Pass = fields[i]
+				}
+			case "macdef":
+				s.add(machine, entry)
+				machine, entry = "", nil
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	s.add(machine, entry)
+	return s, nil
+}
+
+type netrcSigner struct {
+	hosts hostSigner
+	def   Signer
+}
+
+// add records the entry for the machine, or the default entry if machine is empty.
+// Earlier entries for the same machine take precedence.
+func (s *netrcSigner) add(machine string, entry *BasicAuthSigner) {
+	if entry == nil {
+		return
+	}
+	if machine == "" {
+		if s.def == nil {
+			s.def = *entry
+		}
+		return
+	}
+	if _, ok := s.hosts[machine]; !ok {
+		s.hosts[machine] = *entry
+	}
+}
+
+// Sign implements Signer.
+func (s *netrcSigner) Sign(r *http.Request) error {
+	return s.SignContext(r.Context(), r)
+}
+
+// SignContext implements ContextSigner.
+func (s *netrcSigner) SignContext(ctx context.Context, r *http.Request) error {
+	if ss := s.hosts.signer(r.URL); ss != nil {
+		return signContext(ctx, ss, r)
+	}
+	if s.def != nil {
+		return signContext(ctx, s.def, r)
+	}
+	return nil
+}
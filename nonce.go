@@ -0,0 +1,53 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"sync"
+	"time"
+)
+
+// NonceStore defines the Seen method which provides replay detection for nonces.
+type NonceStore interface {
+	// Seen records the nonce until expiry, returning true if it had already been
+	// recorded (and not yet expired).
+	Seen(nonce string, expiry time.Time) bool
+}
+
+// NewMemoryNonceStore creates a NonceStore which records nonces in memory.  Expired
+// nonces are removed periodically as new nonces are recorded.
+func NewMemoryNonceStore() NonceStore {
+	return &memoryNonceStore{
+		m: make(map[string]time.Time),
+	}
+}
+
+type memoryNonceStore struct {
+	sync.Mutex
+	m     map[string]time.Time
+	swept time.Time
+}
+
+// Seen implements NonceStore.
+func (s *memoryNonceStore) Seen(nonce string, expiry time.Time) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.swept) > time.Minute {
+		for n, exp := range s.m {
+			if now.After(exp) {
+				delete(s.m, n)
+			}
+		}
+		s.swept = now
+	}
+
+	if exp, ok := s.m[nonce]; ok && !now.After(exp) {
+		return true
+	}
+	s.m[nonce] = expiry
+	return false
+}
@@ -0,0 +1,138 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OAuthError is an error response from an OAuth 2.0 token endpoint (RFC 6749
+// section 5.2).
+type OAuthError struct {
+	// Code is the error code, e.g. "invalid_client".
+	Code string `json:"error"`
+
+	// Description is the optional human-readable description of the error.
+	Description string `json:"error_description"`
+}
+
+// Error implements error.
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return "httpauth: token endpoint error: " + e.Code
+	}
+	return "httpauth: token endpoint error: " + e.Code + ": " + e.Description
+}
+
+// requestToken posts the form to the OAuth 2.0 token endpoint tokenURL, authenticating
+// with the client credentials, and returns the token from the response.
+func requestToken(ctx context.Context, client *http.Client, tokenURL, clientID, clientSecret string, form url.Values) (*Token, error) {
+	var tr tokenResponse
+	if err := postForm(ctx, client, tokenURL, clientID, clientSecret, form, &tr); err != nil {
+		return nil, err
+	}
+	if tr.AccessToken == "" {
+		return nil, ErrNoToken
+	}
+	t := &Token{
+		AccessToken:  tr.AccessToken,
+		TokenType:    tr.TokenType,
+		RefreshToken: tr.RefreshToken,
+	}
+	if tr.ExpiresIn > 0 {
+		t.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+	return t, nil
+}
+
+// postForm posts the form to an OAuth 2.0 endpoint, authenticating with the client
+// credentials, and decodes the JSON response into v.  Error responses are returned as
+// *OAuthError where possible.  Public clients (with no secret) send their client_id in
+// the form instead.
+func postForm(ctx context.Context, client *http.Client, endpoint, clientID, clientSecret string, form url.Values, v interface{}) error {
+	if clientSecret == "" && clientID != "" {
+		form.Set("client_id", clientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxJSONBody))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		oe := &OAuthError{}
+		if err := json.Unmarshal(body, oe); err == nil && oe.Code != "" {
+			return oe
+		}
+		return fmt.Errorf("httpauth: calling %v: unexpected status %v", endpoint, resp.Status)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("httpauth: decoding response from %v: %v", endpoint, err)
+	}
+	return nil
+}
+
+// ClientCredentials is a TokenSource which obtains access tokens using the OAuth 2.0
+// client credentials grant (RFC 6749 section 4.4), for service-to-service requests.
+// Use Signer to sign requests with cached tokens which are refreshed before they expire.
+type ClientCredentials struct {
+	// TokenURL is the token endpoint.
+	TokenURL string
+
+	// ClientID and ClientSecret are sent as basic HTTP authentication credentials
+	// when calling the token endpoint.
+	ClientID, ClientSecret string
+
+	// Scopes, if non-empty, are the scopes requested.
+	Scopes []string
+
+	// Client is used to call the token endpoint.  If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Token implements TokenSource by requesting a new token from the token endpoint.
+func (c *ClientCredentials) Token() (*Token, error) {
+	return c.TokenContext(context.Background())
+}
+
+// TokenContext implements ContextTokenSource.
+func (c *ClientCredentials) TokenContext(ctx context.Context) (*Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	return requestToken(ctx, c.Client, c.TokenURL, c.ClientID, c.ClientSecret, form)
+}
+
+// Signer returns a Signer which adds access tokens obtained by c to requests (see
+// TokenSourceSigner).
+func (c *ClientCredentials) Signer() Signer {
+	return TokenSourceSigner(c)
+}
@@ -0,0 +1,75 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package oauth2bridge converts between golang.org/x/oauth2 token sources and those of
+// package httpauth, so that existing oauth2 configurations can be used with
+// httpauth.Client (and httpauth token sources with oauth2.NewClient).  It is a separate
+// package so that httpauth itself does not depend on golang.org/x/oauth2.
+package oauth2bridge
+
+import (
+	"golang.org/x/oauth2"
+
+	"github.com/dhowden/httpauth"
+)
+
+// Signer creates an httpauth.Signer which adds tokens from the oauth2.TokenSource to
+// requests (see httpauth.TokenSourceSigner).
+func Signer(ts oauth2.TokenSource) httpauth.Signer {
+	return httpauth.TokenSourceSigner(TokenSource(ts))
+}
+
+// TokenSource creates an httpauth.TokenSource which provides tokens from the
+// oauth2.TokenSource.
+func TokenSource(ts oauth2.TokenSource) httpauth.TokenSource {
+	if s, ok := ts.(oauth2TokenSource); ok {
+		return s.ts
+	}
+	return tokenSource{ts}
+}
+
+type tokenSource struct {
+	ts oauth2.TokenSource
+}
+
+// Token implements httpauth.TokenSource.
+func (s tokenSource) Token() (*httpauth.Token, error) {
+	t, err := s.ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	return &httpauth.Token{
+		AccessToken:  t.AccessToken,
+		TokenType:    t.Type(),
+		RefreshToken: t.RefreshToken,
+		Expiry:       t.Expiry,
+	}, nil
+}
+
+// OAuth2TokenSource creates an oauth2.TokenSource which provides tokens from the
+// httpauth.TokenSource.
+func OAuth2TokenSource(ts httpauth.TokenSource) oauth2.TokenSource {
+	if s, ok := ts.(tokenSource); ok {
+		return s.ts
+	}
+	return oauth2TokenSource{ts}
+}
+
+type oauth2TokenSource struct {
+	ts httpauth.TokenSource
+}
+
+// Token implements oauth2.TokenSource.
+func (s oauth2TokenSource) Token() (*oauth2.Token, error) {
+	t, err := s.ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Token{
+		AccessToken:  t.AccessToken,
+		TokenType:    t.TokenType,
+		RefreshToken: t.RefreshToken,
+		Expiry:       t.Expiry,
+	}, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package oauth2bridge_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/dhowden/httpauth"
+	. "github.com/dhowden/httpauth/oauth2bridge"
+)
+
+func TestSigner(t *testing.T) {
+	expiry := time.Now().Add(time.Hour)
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "abc", RefreshToken: "r", Expiry: expiry})
+
+	r, _ := http.NewRequest("GET", "http://example.com/", nil)
+	if err := Signer(ts).Sign(r); err != nil {
+		t.Fatalf("Sign() returned unexpected error: %v", err)
+	}
+	if got := r.Header.Get("Authorization"); got != "Bearer abc" {
+		t.Errorf("Authorization = %q, expected: %q", got, "Bearer abc")
+	}
+
+	tok, err := TokenSource(ts).Token()
+	if err != nil {
+		t.Fatalf("Token() returned unexpected error: %v", err)
+	}
+	if tok.AccessToken != "abc" || tok.TokenType != "Bearer" || tok.RefreshToken != "r" || !tok.Expiry.Equal(expiry) {
+		t.Errorf("Token() = %+v, expected token abc", tok)
+	}
+
+	if got := OAuth2TokenSource(TokenSource(ts)); got != ts {
+		t.Errorf("OAuth2TokenSource(TokenSource(ts)) = %v, expected: %v", got, ts)
+	}
+}
+
+func TestOAuth2TokenSource(t *testing.T) {
+	ts := httpauth.StaticTokenSource(&httpauth.Token{AccessToken: "abc", TokenType: "DPoP"})
+	tok, err := OAuth2TokenSource(ts).Token()
+	if err != nil {
+		t.Fatalf("Token() returned unexpected error: %v", err)
+	}
+	if tok.AccessToken != "abc" || tok.Type() != "DPoP" {
+		t.Errorf("Token() = %+v, expected DPoP token abc", tok)
+	}
+	if got := TokenSource(OAuth2TokenSource(ts)); got != ts {
+		t.Errorf("TokenSource(OAuth2TokenSource(ts)) = %v, expected: %v", got, ts)
+	}
+}
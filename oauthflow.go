@@ -0,0 +1,196 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// OAuthConfig describes an OAuth 2.0 client which obtains user-delegated tokens using the
+// authorization code flow with PKCE (RFC 6749 section 4.1, RFC 7636) or the device
+// authorization flow (RFC 8628), e.g. for command line tools.  The resulting tokens can
+// be used to sign requests with TokenSourceSigner and c.TokenSource.
+type OAuthConfig struct {
+	// ClientID and ClientSecret identify the client.  Public clients (e.g. command line
+	// tools) have no secret.
+	ClientID, ClientSecret string
+
+	// AuthURL is the authorization endpoint, used by the authorization code flow.
+	AuthURL string
+
+	// DeviceAuthURL is the device authorization endpoint, used by the device flow.
+	DeviceAuthURL string
+
+	// TokenURL is the token endpoint.
+	TokenURL string
+
+	// RedirectURL is the redirect URI for the authorization code flow.
+	RedirectURL string
+
+	// Scopes, if non-empty, are the scopes requested.
+	Scopes []string
+
+	// Client is used to call the endpoints.  If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// NewPKCEVerifier returns a new random PKCE code verifier (RFC 7636 section 4.1), to be
+// passed to AuthCodeURL and then Exchange.
+func NewPKCEVerifier() (string, error) {
+	return randomString(32)
+}
+
+// AuthCodeURL returns the URL of the authorization endpoint to which the user should be
+// sent to authorize the client.  The state is returned to the redirect URL and should be
+// checked by the caller; verifier is the PKCE code verifier (see NewPKCEVerifier), whose
+// S256 challenge is included in the URL.
+func (c *OAuthConfig) AuthCodeURL(state, verifier string) string {
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {c.ClientID},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	if c.RedirectURL != "" {
+		q.Set("redirect_uri", c.RedirectURL)
+	}
+	if len(c.Scopes) > 0 {
+		q.Set("scope", strings.Join(c.Scopes, " "))
+	}
+
+	sep := "?"
+	if strings.Contains(c.AuthURL, "?") {
+		sep = "&"
+	}
+	return c.AuthURL + sep + q.Encode()
+}
+
+// Exchange exchanges the authorization code returned to the redirect URL for a token,
+// using the PKCE code verifier passed to AuthCodeURL.
+func (c *OAuthConfig) Exchange(code, verifier string) (*Token, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {verifier},
+	}
+	if c.RedirectURL != "" {
+		form.Set("redirect_uri", c.RedirectURL)
+	}
+	return requestToken(context.Background(), c.Client, c.TokenURL, c.ClientID, c.ClientSecret, form)
+}
+
+// DeviceAuthorization is a device authorization response (RFC 8628 section 3.2).  The
+// user should be asked to visit VerificationURI and enter UserCode (or to visit
+// VerificationURIComplete, if set) while the client calls PollDeviceToken.
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval,omitempty"`
+}
+
+// DeviceAuth starts the device authorization flow.
+func (c *OAuthConfig) DeviceAuth() (*DeviceAuthorization, error) {
+	form := url.Values{}
+	if len(c.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	da := &DeviceAuthorization{}
+	if err := postForm(context.Background(), c.Client, c.DeviceAuthURL, c.ClientID, c.ClientSecret, form, da); err != nil {
+		return nil, err
+	}
+	return da, nil
+}
+
+// PollDeviceToken polls the token endpoint until the user has completed the device
+// authorization da, returning the token.  It returns an *OAuthError if the user denies
+// access or the authorization expires, and ctx.Err() if ctx is done first.
+func (c *OAuthConfig) PollDeviceToken(ctx context.Context, da *DeviceAuthorization) (*Token, error) {
+	interval := 5 * time.Second
+	if da.Interval > 0 {
+		interval = time.Duration(da.Interval) * time.Second
+	}
+	form := url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {da.DeviceCode},
+	}
+
+	for {
+		t := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+
+		tok, err := requestToken(ctx, c.Client, c.TokenURL, c.ClientID, c.ClientSecret, form)
+		if oe, ok := err.(*OAuthError); ok {
+			switch oe.Code {
+			case "authorization_pending":
+				continue
+			case "slow_down":
+				interval += 5 * time.Second
+				continue
+			}
+		}
+		return tok, err
+	}
+}
+
+// TokenSource returns a TokenSource which returns t until it expires and then uses its
+// refresh token to obtain new tokens from the token endpoint.
+func (c *OAuthConfig) TokenSource(t *Token) TokenSource {
+	return &reuseTokenSource{
+		ts: &refreshTokenSource{c: c, refresh: t.RefreshToken},
+		t:  t,
+	}
+}
+
+// refreshTokenSource is a TokenSource which obtains tokens using the refresh token grant
+// (RFC 6749 section 6).  It is not safe for concurrent use, so is always wrapped by
+// a reuseTokenSource.
+type refreshTokenSource struct {
+	c       *OAuthConfig
+	refresh string
+}
+
+// Token implements TokenSource.
+func (s *refreshTokenSource) Token() (*Token, error) {
+	return s.TokenContext(context.Background())
+}
+
+// TokenContext implements ContextTokenSource.
+func (s *refreshTokenSource) TokenContext(ctx context.Context) (*Token, error) {
+	if s.refresh == "" {
+		return nil, ErrNoToken
+	}
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.refresh},
+	}
+	t, err := requestToken(ctx, s.c.Client, s.c.TokenURL, s.c.ClientID, s.c.ClientSecret, form)
+	if err != nil {
+		return nil, err
+	}
+	// The server may issue a new refresh token, and otherwise the old one remains valid
+	// (and is kept with the token, e.g. when saved by FileTokenSource).
+	if t.RefreshToken != "" {
+		s.refresh = t.RefreshToken
+	} else {
+		t.RefreshToken = s.refresh
+	}
+	return t, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// oidcRefreshInterval is the interval at which keys discovered using OIDC are refreshed.
+const oidcRefreshInterval = time.Hour
+
+type oidcConfig struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// NewOIDC performs OpenID Connect discovery for the issuer URL using the http.Client
+// (if nil, http.DefaultClient is used) and returns a JWT which validates tokens signed
+// by the issuer's published keys, requiring the iss claim to match the issuer and the
+// aud claim to include audience (no audience check if empty).
+func NewOIDC(issuer, audience string, client *http.Client) (*JWT, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	u := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("httpauth: OIDC discovery from %v: unexpected status %v", u, resp.Status)
+	}
+
+	var cfg oidcConfig
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("httpauth: decoding OIDC configuration: %v", err)
+	}
+	if cfg.Issuer != issuer {
+		return nil, fmt.Errorf("httpauth: OIDC issuer mismatch: expected %q, got %q", issuer, cfg.Issuer)
+	}
+	if cfg.JWKSURI == "" {
+		return nil, fmt.Errorf("httpauth: OIDC configuration for %v has no jwks_uri", issuer)
+	}
+
+	keys, err := NewJWKS(cfg.JWKSURI, client, oidcRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+	return &JWT{
+		Keys:     keys,
+		Issuer:   issuer,
+		Audience: audience,
+	}, nil
+}
+
+// NewOIDCHandler returns a bearer handler (see NewBearerHandler) which validates tokens
+// issued by the OpenID Connect provider at the issuer URL for the given audience (see
+// NewOIDC).
+func NewOIDCHandler(issuer, audience string, h http.Handler) (http.Handler, error) {
+	j, err := NewOIDC(issuer, audience, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewBearerHandler(j, h), nil
+}
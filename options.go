@@ -0,0 +1,169 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Option is a function which configures a handler created by NewHandler.
+type Option func(*handler)
+
+// Proxy configures the handler to act as an authenticating proxy: credentials are read
+// from the Proxy-Authorization header, and failed requests receive a Proxy-Authenticate
+// challenge with http.StatusProxyAuthRequired.  The Proxy-Authorization header is removed
+// from requests before they are passed on.
+func Proxy() Option {
+	return func(h *handler) {
+		h.proxy = true
+	}
+}
+
+// ClientCert configures the handler to authenticate requests which present a TLS client
+// certificate using the CertChecker.  Requests without a certificate fall back to basic
+// HTTP authentication using the handler's Checker, or are rejected if the Checker is nil.
+func ClientCert(cc CertChecker) Option {
+	return func(h *handler) {
+		h.cc = cc
+	}
+}
+
+// SessionCookie configures the handler to issue a session cookie (see Sessions) when a
+// request is successfully authenticated, and to accept requests with a valid session
+// cookie without checking credentials.  Not used in Proxy mode.
+func SessionCookie(s *Sessions) Option {
+	return func(h *handler) {
+		h.s = s
+	}
+}
+
+// Exempt configures the handler to pass requests whose URL path matches any of the
+// patterns without authentication.  Patterns use the syntax of path.Match, except that
+// a trailing "/*" matches everything below the prefix (e.g. "/public/*" matches
+// "/public/css/main.css").  Paths which are not clean (e.g. "/public/../secret", which
+// handlers such as http.ServeMux and http.FileServer treat as "/secret") are never
+// exempt.
+func Exempt(patterns ...string) Option {
+	return func(h *handler) {
+		h.exempt = append(h.exempt, patterns...)
+	}
+}
+
+// matchPath returns true if p is clean and matches any of the patterns (see Exempt).
+func matchPath(patterns []string, p string) bool {
+	if len(patterns) == 0 || cleanPath(p) != p {
+		return false
+	}
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(p, pattern[:len(pattern)-1]) {
+			return true
+		}
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanPath returns the canonical form of the URL path p (see path.Clean), keeping any
+// trailing slash.
+func cleanPath(p string) string {
+	c := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && c != "/" {
+		c += "/"
+	}
+	return c
+}
+
+// AllowPreflight configures the handler to pass CORS preflight requests (OPTIONS requests
+// with an Access-Control-Request-Method header) without authentication, as browsers never
+// send credentials with them.
+func AllowPreflight() Option {
+	return func(h *handler) {
+		h.preflight = true
+	}
+}
+
+// isPreflight returns true if r is a CORS preflight request.
+func isPreflight(r *http.Request) bool {
+	return r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// RequireMethods configures the handler to only require authentication for requests
+// using the given HTTP methods, passing all other requests without authentication.
+// For example, RequireMethods("POST", "PUT", "PATCH", "DELETE") allows anonymous reads.
+// RequireMethods with no methods does nothing, so authentication is still required for
+// all requests.
+func RequireMethods(methods ...string) Option {
+	return func(h *handler) {
+		if len(methods) == 0 {
+			return
+		}
+		if h.methods == nil {
+			h.methods = make(map[string]bool, len(methods))
+		}
+		for _, m := range methods {
+			h.methods[strings.ToUpper(m)] = true
+		}
+	}
+}
+
+// Instrument configures the handler to record authentication attempts in m under the
+// given handler name.
+func Instrument(m *Metrics, name string) Option {
+	return func(h *handler) {
+		h.metrics = m
+		h.metricsName = name
+	}
+}
+
+// FailureStatus configures the handler to respond to failed requests with the given
+// HTTP status code (e.g. http.StatusNotFound to hide protected resources) instead of
+// http.StatusUnauthorized.
+func FailureStatus(code int) Option {
+	return func(h *handler) {
+		h.failStatus = code
+	}
+}
+
+// NoChallenge configures the handler to omit the WWW-Authenticate (or Proxy-Authenticate)
+// challenge from failure responses.
+func NoChallenge() Option {
+	return func(h *handler) {
+		h.noChallenge = true
+	}
+}
+
+// NoChallengeForAPI configures the handler to omit the challenge from failure responses
+// to API-style requests: those made by XMLHttpRequest (X-Requested-With), by fetch (a
+// Sec-Fetch-Mode other than "navigate"), or preferring a JSON response (Accept).
+// Browsers then do not show their native login dialog to users of single-page apps,
+// which can handle the http.StatusUnauthorized response themselves.
+func NoChallengeForAPI() Option {
+	return func(h *handler) {
+		h.apiNoChallenge = true
+	}
+}
+
+// Realm configures the handler to include the realm in the challenge sent with failure
+// responses (e.g. `Basic realm="admin"`), so that clients can tell protection spaces
+// apart and keep separate credentials for each.
+func Realm(realm string) Option {
+	return func(h *handler) {
+		h.realm = realm
+	}
+}
+
+// AllowAnonymous configures the handler to pass requests which carry no credentials at
+// all, marking them as anonymous in the request context (see IsAnonymous) instead of
+// responding with http.StatusUnauthorized.  Requests with invalid credentials are still
+// rejected.  Handlers can then decide for themselves what anonymous users may do.
+func AllowAnonymous() Option {
+	return func(h *handler) {
+		h.anonymous = true
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// splitScheme splits an Authorization header value into the (lower-cased) scheme and
+// the remaining parameters.
+func splitScheme(auth string) (scheme, params string) {
+	auth = strings.TrimSpace(auth)
+	i := strings.IndexAny(auth, " \t")
+	if i < 0 {
+		return strings.ToLower(auth), ""
+	}
+	return strings.ToLower(auth[:i]), strings.TrimSpace(auth[i+1:])
+}
+
+// parseParams parses comma-separated auth-params of the form key=value or key="value",
+// returning a map of lower-cased keys to (unquoted) values.
+func parseParams(s string) map[string]string {
+	m := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return m
+		}
+		i := strings.IndexByte(s, '=')
+		if i < 0 {
+			return m
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:i]))
+		s = strings.TrimLeft(s[i+1:], " \t")
+
+		var val string
+		val, s = parseParamValue(s)
+		m[key] = val
+	}
+}
+
+// parseParamValue parses a token or quoted-string from the start of s, returning the
+// value and the remainder of s.
+func parseParamValue(s string) (val, rest string) {
+	if !strings.HasPrefix(s, `"`) {
+		i := strings.IndexByte(s, ',')
+		if i < 0 {
+			return strings.TrimSpace(s), ""
+		}
+		return strings.TrimSpace(s[:i]), s[i+1:]
+	}
+
+	b := make([]byte, 0, len(s))
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b = append(b, s[i])
+			}
+		case '"':
+			return string(b), s[i+1:]
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(b), ""
+}
+
+// quote returns s as a quoted-string, escaping backslashes and double quotes.
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// AuthChallenge is an authentication challenge from a WWW-Authenticate (or
+// Proxy-Authenticate) header.
+type AuthChallenge struct {
+	// Scheme is the lower-cased authentication scheme, e.g. "basic".
+	Scheme string
+
+	// Params are the auth-params of the challenge, with lower-cased keys.
+	Params map[string]string
+
+	// Token68 is the token68 form of the challenge parameters, if used instead of
+	// auth-params.
+	Token68 string
+}
+
+// ParseChallenges returns the challenges in the values of the named header (e.g.
+// "WWW-Authenticate") of h, in the order they are given.  A header value may contain
+// several comma-separated challenges (RFC 9110 section 11.6.1).
+func ParseChallenges(h http.Header, name string) []AuthChallenge {
+	var cs []AuthChallenge
+	for _, v := range h.Values(name) {
+		cs = append(cs, parseChallenges(v)...)
+	}
+	return cs
+}
+
+// parseChallenges parses the challenges in a WWW-Authenticate header value.
+func parseChallenges(s string) []AuthChallenge {
+	var cs []AuthChallenge
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return cs
+		}
+		var scheme string
+		scheme, s = parseToken(s)
+		if scheme == "" {
+			// Not a token: skip to the next comma.
+			if i := strings.IndexByte(s, ','); i >= 0 {
+				s = s[i+1:]
+				continue
+			}
+			return cs
+		}
+		c := AuthChallenge{Scheme: strings.ToLower(scheme), Params: make(map[string]string)}
+
+		s = strings.TrimLeft(s, " \t")
+		if t, rest := parseToken(s); t != "" {
+			// A token68 is a token with optional "=" padding, which is followed by
+			// the end of the challenge (rather than a value).
+			j := 0
+			for j < len(rest) && rest[j] == '=' {
+				j++
+			}
+			if after := strings.TrimLeft(rest[j:], " \t"); after == "" || after[0] == ',' {
+				c.Token68 = t + rest[:j]
+				s = after
+				cs = append(cs, c)
+				continue
+			}
+		}
+
+		// auth-params, until a token which is not followed by "=" (the next scheme).
+		for {
+			s = strings.TrimLeft(s, " \t,")
+			key, rest := parseToken(s)
+			rest = strings.TrimLeft(rest, " \t")
+			if key == "" || !strings.HasPrefix(rest, "=") {
+				break
+			}
+			var val string
+			val, s = parseChallengeValue(strings.TrimLeft(rest[1:], " \t"))
+			c.Params[strings.ToLower(key)] = val
+		}
+		cs = append(cs, c)
+	}
+}
+
+// parseToken returns the token at the start of s and the remainder of s.
+func parseToken(s string) (token, rest string) {
+	i := 0
+	for i < len(s) && isTokenChar(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// parseChallengeValue parses a token or quoted-string auth-param value from the start of
+// s, returning the value and the remainder of s.  Tokens may end with "=" padding, as
+// some schemes send base64 values unquoted (e.g. the data parameter of SCRAM, RFC 7804).
+func parseChallengeValue(s string) (val, rest string) {
+	if strings.HasPrefix(s, `"`) {
+		return parseParamValue(s)
+	}
+	val, rest = parseToken(s)
+	if val == "" {
+		return val, rest
+	}
+	i := 0
+	for i < len(rest) && rest[i] == '=' {
+		i++
+	}
+	return s[:len(val)+i], rest[i:]
+}
+
+// isTokenChar returns true if c is a tchar (RFC 9110 section 5.6.2), or one of the
+// additional characters allowed in token68.
+func isTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~/", c) >= 0
+}
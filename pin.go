@@ -0,0 +1,93 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+)
+
+// ErrCertificateNotPinned is returned when connecting to a server whose certificate
+// chain does not match any of the pins.
+var ErrCertificateNotPinned = errors.New("httpauth: server certificate does not match any pin")
+
+// SPKIPin returns the pin of the certificate's public key: "sha256/" followed by the
+// base64-encoded SHA-256 hash of its SubjectPublicKeyInfo.  Public key pins survive
+// certificate renewal with the same key.
+func SPKIPin(cert *x509.Certificate) string {
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(h[:])
+}
+
+// CertificatePin returns the pin of the certificate itself: "cert-sha256/" followed by
+// the base64-encoded SHA-256 hash of its DER encoding.
+func CertificatePin(cert *x509.Certificate) string {
+	h := sha256.Sum256(cert.Raw)
+	return "cert-sha256/" + base64.StdEncoding.EncodeToString(h[:])
+}
+
+// PinTLSConfig returns a copy of cfg (or of an empty config, if cfg is nil) which only
+// allows connections to servers whose certificate chain includes a certificate matching
+// one of the pins (see SPKIPin and CertificatePin).  Pin the current and next keys (or
+// those of an intermediate CA) so that certificates can be rotated without breaking
+// clients.  Chains are still verified as usual, unless cfg.InsecureSkipVerify is set,
+// in which case the pins alone are trusted (e.g. for self-signed certificates), and only
+// the server's own certificate can match: the rest of the chain it sends is unverified.
+func PinTLSConfig(cfg *tls.Config, pins ...string) *tls.Config {
+	if cfg == nil {
+		cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+	} else {
+		cfg = cfg.Clone()
+	}
+	pinned := make(map[string]bool, len(pins))
+	for _, p := range pins {
+		pinned[p] = true
+	}
+
+	verify := cfg.VerifyConnection
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if verify != nil {
+			if err := verify(cs); err != nil {
+				return err
+			}
+		}
+		var certs []*x509.Certificate
+		for _, chain := range cs.VerifiedChains {
+			certs = append(certs, chain...)
+		}
+		if len(cs.VerifiedChains) == 0 && len(cs.PeerCertificates) > 0 {
+			// Unverified: only the leaf is proved to belong to the server.
+			certs = cs.PeerCertificates[:1]
+		}
+		for _, c := range certs {
+			if pinned[SPKIPin(c)] || pinned[CertificatePin(c)] {
+				return nil
+			}
+		}
+		return ErrCertificateNotPinned
+	}
+	return cfg
+}
+
+// NewPinnedClient creates an http.Client which only connects to HTTPS servers whose
+// certificates match one of the pins (see PinTLSConfig).  If s is not nil then requests
+// are also signed (see NewTransport).
+func NewPinnedClient(s Signer, pins ...string) *http.Client {
+	tr := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if dt, ok := http.DefaultTransport.(*http.Transport); ok {
+		tr = dt.Clone()
+	}
+	tr.TLSClientConfig = PinTLSConfig(tr.TLSClientConfig, pins...)
+
+	var rt http.RoundTripper = tr
+	if s != nil {
+		rt = NewTransport(s, tr)
+	}
+	return &http.Client{Transport: rt}
+}
@@ -0,0 +1,102 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultSignedURLTTL is the default lifetime of a signed URL.
+const DefaultSignedURLTTL = time.Hour
+
+// URLSigner creates and validates signed URLs, which grant temporary access to a
+// resource without credentials.  A signed URL has "expires" and "signature" query
+// parameters added, where the signature covers the path, the other query parameters
+// and the expiry time.  The scheme and host are not signed, so signed URLs remain valid
+// behind proxies which rewrite them.
+type URLSigner struct {
+	// Key is the secret used to sign URLs.  URLs are never signed or accepted with an
+	// empty Key.
+	Key []byte
+
+	// TTL is the lifetime of a signed URL created by Sign.  Defaults to
+	// DefaultSignedURLTTL.
+	TTL time.Duration
+}
+
+// ErrNoURLSignerKey is returned by URLSigner.Sign and URLSigner.SignUntil when the Key is
+// empty.
+var ErrNoURLSignerKey = errors.New("httpauth: url signer has no key")
+
+func (s *URLSigner) ttl() time.Duration {
+	if s.TTL == 0 {
+		return DefaultSignedURLTTL
+	}
+	return s.TTL
+}
+
+// Sign returns rawurl signed so that it is valid until the TTL has elapsed.
+func (s *URLSigner) Sign(rawurl string) (string, error) {
+	return s.SignUntil(rawurl, time.Now().Add(s.ttl()))
+}
+
+// SignUntil returns rawurl signed so that it is valid until expires.
+func (s *URLSigner) SignUntil(rawurl string, expires time.Time) (string, error) {
+	if len(s.Key) == 0 {
+		return "", ErrNoURLSignerKey
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Del("signature")
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("signature", s.sign(u.EscapedPath(), q))
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Valid returns true if the URL of r has a valid signature and has not expired.
+func (s *URLSigner) Valid(r *http.Request) bool {
+	if len(s.Key) == 0 {
+		return false
+	}
+	q := r.URL.Query()
+	sig := q.Get("signature")
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if sig == "" || err != nil || time.Now().Unix() >= expires {
+		return false
+	}
+	q.Del("signature")
+	return hmac.Equal([]byte(sig), []byte(s.sign(r.URL.EscapedPath(), q)))
+}
+
+// sign returns the base64url-encoded signature of the path and query parameters.
+func (s *URLSigner) sign(path string, q url.Values) string {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(path + "?" + q.Encode()))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// NewSignedURLHandler returns an http.Handler which passes requests for validly signed
+// URLs (see URLSigner.Sign) to the given http.Handler and responds with
+// http.StatusForbidden otherwise.
+func NewSignedURLHandler(s *URLSigner, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.Valid(r) {
+			writeError(w, r, http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// NewReverseProxy returns an http.Handler which authenticates requests using the Checker
+// and Options (see NewHandler) before passing them to the reverse proxy p.  The
+// Authorization header is removed from proxied requests, and the authenticated username
+// is passed upstream in the X-Forwarded-User header (any value sent by the client is
+// discarded).
+func NewReverseProxy(c Checker, p *httputil.ReverseProxy, opts ...Option) http.Handler {
+	return NewHandler(c, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.Clone(r.Context())
+		r.Header.Del("Authorization")
+		r.Header.Del(ForwardedUserHeader)
+		if u, ok := UserFromContext(r.Context()); ok {
+			r.Header.Set(ForwardedUserHeader, u)
+		}
+		p.ServeHTTP(w, r)
+	}), opts...)
+}
+
+// NewSigningReverseProxy returns a reverse proxy to target (as for
+// httputil.NewSingleHostReverseProxy) which signs each outgoing request using s (see
+// NewTransport), e.g. so that a sidecar can add credentials on behalf of an application.
+// Any Authorization header sent by the client is removed first, and the Host header is
+// set to that of target so that signatures covering it are valid upstream.  Requests
+// which cannot be signed receive http.StatusBadGateway.
+func NewSigningReverseProxy(target *url.URL, s Signer) *httputil.ReverseProxy {
+	p := httputil.NewSingleHostReverseProxy(target)
+	director := p.Director
+	p.Director = func(r *http.Request) {
+		director(r)
+		r.Header.Del("Authorization")
+		r.Host = target.Host
+	}
+	p.Transport = NewTransport(s, nil)
+	return p
+}
@@ -0,0 +1,197 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth_test
+
+import (
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	. "github.com/dhowden/httpauth"
+)
+
+func TestReverseProxy(t *testing.T) {
+	var auth, user string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		user = r.Header.Get("X-Forwarded-User")
+		handlerFuncOK(w, r)
+	}))
+	defer upstream.Close()
+
+	u, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatalf("unexpected error parsing URL: %v", err)
+	}
+	p := NewReverseProxy(Creds(map[string]string{"alice": "shhhh"}), httputil.NewSingleHostReverseProxy(u))
+	testHandlerUnauthorised(t, "/", p)
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	r.SetBasicAuth("alice", "shhhh")
+	r.Header.Set("X-Forwarded-User", "root")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusOK)
+	}
+	if auth != "" {
+		t.Errorf("upstream Authorization = %q, expected it to be removed", auth)
+	}
+	if user != "alice" {
+		t.Errorf("upstream X-Forwarded-User = %q, expected %q", user, "alice")
+	}
+}
+
+func TestSigningReverseProxy(t *testing.T) {
+	secret := []byte("shhhh")
+	var body, host string
+	upstream := httptest.NewServer(NewHMACHandler(&HMACVerifier{
+		Secrets: Secrets(map[string][]byte{"sidecar": secret}),
+	}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body, host = string(b), r.Host
+		handlerFuncOK(w, r)
+	})))
+	defer upstream.Close()
+
+	u, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatalf("unexpected error parsing URL: %v", err)
+	}
+	p := httptest.NewServer(NewSigningReverseProxy(u, HMACSigner{KeyID: "sidecar", Secret: secret}))
+	defer p.Close()
+
+	r, _ := http.NewRequest("POST", p.URL+"/path?q=1", strings.NewReader("hello"))
+	r.Header.Set("Authorization", "Bearer app")
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || body != "hello" || host != u.Host {
+		t.Errorf("resp.StatusCode = %d, body = %q, host = %q, expected: %d, %q, %q", resp.StatusCode, body, host, http.StatusOK, "hello", u.Host)
+	}
+
+	// Requests which cannot be signed are not sent.
+	p = httptest.NewServer(NewSigningReverseProxy(u, SignerFunc(func(*http.Request) error { return errors.New("no credentials") })))
+	defer p.Close()
+	resp, err = http.Get(p.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("resp.StatusCode = %d, expected: %d", resp.StatusCode, http.StatusBadGateway)
+	}
+}
+
+func TestIPResolver(t *testing.T) {
+	res, err := NewIPResolver("10.0.0.0/8", "192.0.2.1")
+	if err != nil {
+		t.Fatalf("NewIPResolver() returned unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		remote  string
+		headers map[string]string
+		ip      string
+	}{
+		// Untrusted peer, headers ignored
+		{"203.0.113.9:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.9"},
+
+		// Trusted peer
+		{"10.1.2.3:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+
+		// Client-supplied value before the trusted chain is ignored
+		{"10.1.2.3:1234", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1, 10.4.4.4"}, "198.51.100.1"},
+
+		// Single trusted address
+		{"192.0.2.1:1234", map[string]string{"X-Real-IP": "198.51.100.7"}, "198.51.100.7"},
+
+		// Forwarded header
+		{"10.1.2.3:1234", map[string]string{"Forwarded": `for=198.51.100.2;proto=https, for="[2001:db8::1]:4711"`}, "2001:db8::1"},
+
+		// Trusted peer, no headers
+		{"10.1.2.3:1234", nil, "10.1.2.3"},
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.RemoteAddr = tt.remote
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		if got := res.ClientIP(r); got != tt.ip {
+			t.Errorf("[%d] res.ClientIP() = %q, expected %q", ii, got, tt.ip)
+		}
+	}
+
+	if _, err := NewIPResolver("not-an-ip"); err == nil {
+		t.Errorf("NewIPResolver(\"not-an-ip\") expected error")
+	}
+}
+
+func TestRequireHTTPS(t *testing.T) {
+	res, err := NewIPResolver("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("NewIPResolver() returned unexpected error: %v", err)
+	}
+	c := fixedChecker(true)
+
+	tests := []struct {
+		redirect bool
+		tls      bool
+		remote   string
+		headers  map[string]string
+		code     int
+	}{
+		{false, false, "203.0.113.9:1234", nil, http.StatusUpgradeRequired},
+		{true, false, "203.0.113.9:1234", nil, http.StatusPermanentRedirect},
+		{false, true, "203.0.113.9:1234", nil, http.StatusOK},
+
+		// Forwarding headers are only honoured from trusted proxies
+		{false, false, "203.0.113.9:1234", map[string]string{"X-Forwarded-Proto": "https"}, http.StatusUpgradeRequired},
+		{false, false, "10.1.2.3:1234", map[string]string{"X-Forwarded-Proto": "https"}, http.StatusOK},
+		{false, false, "10.1.2.3:1234", map[string]string{"X-Forwarded-Proto": "http"}, http.StatusUpgradeRequired},
+		{false, false, "10.1.2.3:1234", map[string]string{"Forwarded": "for=198.51.100.1;proto=https"}, http.StatusOK},
+	}
+
+	for ii, tt := range tests {
+		h := NewHandler(c, http.HandlerFunc(handlerFuncOK), RequireHTTPS(tt.redirect), TrustedProxies(res))
+		r, err := http.NewRequest("GET", "http://example.com/a?b=c", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.RemoteAddr = tt.remote
+		if tt.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tt.code {
+			t.Errorf("[%d] rec.Code = %d, expected: %d", ii, rec.Code, tt.code)
+		}
+		if tt.code == http.StatusPermanentRedirect {
+			if loc := rec.Header().Get("Location"); loc != "https://example.com/a?b=c" {
+				t.Errorf("[%d] Location = %q, expected %q", ii, loc, "https://example.com/a?b=c")
+			}
+		}
+	}
+}
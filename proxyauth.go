@@ -0,0 +1,99 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ProxyAuthSigner creates a Signer which adds the credentials from s (e.g. a
+// BasicAuthSigner or DigestSigner) to the Proxy-Authorization header rather than
+// Authorization, for clients which send requests through an authenticating forward
+// proxy (see http.Transport.Proxy).  If s is a ChallengeSigner then it is passed the
+// Proxy-Authenticate challenges of http.StatusProxyAuthRequired responses, and the
+// request is retried as for http.StatusUnauthorized.
+//
+// Only plain http requests are sent to the proxy with their headers: https requests are
+// tunnelled using CONNECT, so are left unsigned to avoid sending the proxy credentials
+// to the origin server.  Use ProxyConnectHeader to authenticate CONNECT requests.
+func ProxyAuthSigner(s Signer) Signer {
+	return proxyAuthSigner{s}
+}
+
+type proxyAuthSigner struct {
+	s Signer
+}
+
+// Sign implements Signer.
+func (p proxyAuthSigner) Sign(r *http.Request) error {
+	return p.SignContext(r.Context(), r)
+}
+
+// SignContext implements ContextSigner.
+func (p proxyAuthSigner) SignContext(ctx context.Context, r *http.Request) error {
+	if strings.EqualFold(r.URL.Scheme, "https") {
+		return nil
+	}
+	auth, err := proxyAuthorization(ctx, p.s, r)
+	if err != nil {
+		return err
+	}
+	if auth != "" {
+		r.Header.Set("Proxy-Authorization", auth)
+	}
+	return nil
+}
+
+// Challenge implements ChallengeSigner.
+func (p proxyAuthSigner) Challenge(resp *http.Response) bool {
+	cs, ok := p.s.(ChallengeSigner)
+	if !ok || resp.StatusCode != http.StatusProxyAuthRequired {
+		return false
+	}
+	// Present the proxy challenge to cs as if it came from the server.
+	r := *resp
+	r.StatusCode = http.StatusUnauthorized
+	r.Header = http.Header{"Www-Authenticate": resp.Header["Proxy-Authenticate"]}
+	return cs.Challenge(&r)
+}
+
+// ProxyConnectHeader returns a function for http.Transport.GetProxyConnectHeader which
+// adds the credentials from s to the Proxy-Authorization header of CONNECT requests
+// sent to the proxy for https requests.  The Transport does not return the response to
+// a rejected CONNECT request, so challenge-based signers (e.g. DigestSigner) can only
+// be used once they have received a challenge from the proxy via ProxyAuthSigner.
+func ProxyConnectHeader(s Signer) func(ctx context.Context, proxyURL *url.URL, target string) (http.Header, error) {
+	return func(ctx context.Context, proxyURL *url.URL, target string) (http.Header, error) {
+		r := &http.Request{
+			Method: "CONNECT",
+			URL:    &url.URL{Opaque: target},
+			Host:   target,
+			Header: make(http.Header),
+		}
+		r = r.WithContext(ctx)
+		auth, err := proxyAuthorization(ctx, s, r)
+		if err != nil || auth == "" {
+			return nil, err
+		}
+		return http.Header{"Proxy-Authorization": {auth}}, nil
+	}
+}
+
+// proxyAuthorization signs r using s and returns the Authorization header which s set,
+// leaving the Authorization header of r unchanged.
+func proxyAuthorization(ctx context.Context, s Signer, r *http.Request) (string, error) {
+	prev, ok := r.Header["Authorization"]
+	r.Header.Del("Authorization")
+	err := signContext(ctx, s, r)
+	auth := r.Header.Get("Authorization")
+	r.Header.Del("Authorization")
+	if ok {
+		r.Header["Authorization"] = prev
+	}
+	return auth, err
+}
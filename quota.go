@@ -0,0 +1,97 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CounterStore defines the Incr method which provides counters for quotas.
+type CounterStore interface {
+	// Incr increments the counter for key and returns its new value.  The store may
+	// discard the counter once expires has passed.
+	Incr(key string, expires time.Time) int64
+}
+
+// NewMemoryCounterStore creates a CounterStore which keeps counters in memory.
+func NewMemoryCounterStore() CounterStore {
+	return &memoryCounterStore{
+		m: make(map[string]*counter),
+	}
+}
+
+type counter struct {
+	n       int64
+	expires time.Time
+}
+
+type memoryCounterStore struct {
+	mu    sync.Mutex
+	m     map[string]*counter
+	swept time.Time
+}
+
+// Incr implements CounterStore.
+func (s *memoryCounterStore) Incr(key string, expires time.Time) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.swept) > time.Minute {
+		for k, c := range s.m {
+			if !now.Before(c.expires) {
+				delete(s.m, k)
+			}
+		}
+		s.swept = now
+	}
+
+	c, ok := s.m[key]
+	if !ok || !now.Before(c.expires) {
+		c = &counter{expires: expires}
+		s.m[key] = c
+	}
+	c.n++
+	return c.n
+}
+
+// QuotaLimit is a limit on the number of requests a user may make in each fixed window
+// of time, e.g. QuotaLimit{Requests: 1000, Per: 24 * time.Hour}.
+type QuotaLimit struct {
+	Requests int64
+	Per      time.Duration
+}
+
+// Quota configures the handler to count authenticated requests per user in store,
+// rejecting requests which exceed any of the limits with http.StatusTooManyRequests and
+// a Retry-After header giving the end of the window.  Windows are aligned to multiples
+// of their length since the zero time, so a limit Per 24 * time.Hour resets at midnight
+// UTC.
+func Quota(store CounterStore, limits ...QuotaLimit) Option {
+	return func(h *handler) {
+		h.quotaStore = store
+		h.quotaLimits = limits
+	}
+}
+
+// overQuota counts a request by username against each of the quota limits, returning
+// the time until the latest window of those exceeded ends (zero if none are exceeded).
+func (h *handler) overQuota(username string) time.Duration {
+	now := time.Now()
+	var wait time.Duration
+	for _, l := range h.quotaLimits {
+		start := now.Truncate(l.Per)
+		end := start.Add(l.Per)
+		key := username + "\x00" + l.Per.String() + "\x00" + strconv.FormatInt(start.Unix(), 10)
+		if h.quotaStore.Incr(key, end) > l.Requests {
+			if d := end.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
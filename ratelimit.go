@@ -0,0 +1,105 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter defines methods for token-bucket rate limiting by key.
+type RateLimiter interface {
+	// Delay returns the time until a token is available for key (zero if one is
+	// available now).
+	Delay(key string) time.Duration
+
+	// Take removes a token for key.
+	Take(key string)
+}
+
+// NewMemoryRateLimiter creates a RateLimiter which keeps token buckets in memory.  Each
+// bucket holds up to burst tokens and is refilled at rate tokens per second.
+func NewMemoryRateLimiter(rate float64, burst int) RateLimiter {
+	return &memoryRateLimiter{
+		rate:  rate,
+		burst: float64(burst),
+		m:     make(map[string]*bucket),
+	}
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type memoryRateLimiter struct {
+	rate, burst float64
+
+	mu    sync.Mutex
+	m     map[string]*bucket
+	swept time.Time
+}
+
+// refill returns the bucket for key, topped up for the time elapsed since it was last used.
+func (l *memoryRateLimiter) refill(key string, now time.Time) *bucket {
+	if now.Sub(l.swept) > time.Minute {
+		for k, b := range l.m {
+			if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+				delete(l.m, k)
+			}
+		}
+		l.swept = now
+	}
+
+	b, ok := l.m[key]
+	if !ok {
+		return &bucket{tokens: l.burst, last: now}
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	return b
+}
+
+// Delay implements RateLimiter.
+func (l *memoryRateLimiter) Delay(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.refill(key, time.Now())
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// Take implements RateLimiter.
+func (l *memoryRateLimiter) Take(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.refill(key, time.Now())
+	b.tokens = math.Max(0, b.tokens-1)
+	l.m[key] = b
+}
+
+// RateLimit configures the handler to limit failed authentication attempts per client
+// IP address using l: each failure takes a token, and requests from an address without
+// an available token are rejected with http.StatusTooManyRequests and a Retry-After
+// header before their credentials are checked.
+func RateLimit(l RateLimiter) Option {
+	return func(h *handler) {
+		h.limiter = l
+	}
+}
+
+// tooManyRequests responds to r with http.StatusTooManyRequests, advising the client to
+// retry after d.
+func tooManyRequests(w http.ResponseWriter, r *http.Request, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(d.Seconds()))))
+	writeError(w, r, http.StatusTooManyRequests)
+}
@@ -0,0 +1,106 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Response formats for failures, see negotiate.
+const (
+	formatText = iota
+	formatJSON
+	formatHTML
+)
+
+// writeError responds to r with the HTTP status code, using a body whose format is
+// chosen by the Accept header of r: JSON (e.g. {"error":"unauthorized"}) for API
+// clients, a minimal HTML page for browsers, and plain text otherwise.
+func writeError(w http.ResponseWriter, r *http.Request, status int) {
+	text := http.StatusText(status)
+
+	var body, contentType string
+	switch negotiate(r.Header.Get("Accept")) {
+	case formatJSON:
+		contentType = "application/json"
+		body = `{"error":"` + strings.ReplaceAll(strings.ToLower(text), " ", "_") + `"}`
+	case formatHTML:
+		contentType = "text/html; charset=utf-8"
+		t := html.EscapeString(strconv.Itoa(status) + " " + text)
+		body = "<!DOCTYPE html>\n<html><head><title>" + t + "</title></head><body><h1>" + t + "</h1></body></html>\n"
+	default:
+		contentType = "text/plain; charset=utf-8"
+		body = text
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
+
+// negotiate returns the response format preferred by the Accept header value accept.
+// Only explicitly listed media types are considered (wildcards select plain text), and
+// ties go to the type listed first.
+func negotiate(accept string) int {
+	format, best := formatText, 0.0
+	for _, x := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(x, ";")
+		f := formatText
+		switch mediaType = strings.ToLower(strings.TrimSpace(mediaType)); {
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			f = formatJSON
+		case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+			f = formatHTML
+		case mediaType == "text/plain":
+		default:
+			continue
+		}
+
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.EqualFold(k, "q") {
+				if n, err := strconv.ParseFloat(v, 64); err == nil {
+					q = n
+				}
+			}
+		}
+		if q > best {
+			format, best = f, q
+		}
+	}
+	return format
+}
+
+// maxJSONBody is the maximum size of a JSON request body.
+const maxJSONBody = 64 << 10
+
+// readJSON decodes the JSON body of r into v.
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	return json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBody)).Decode(v)
+}
+
+// writeJSON responds with v encoded as JSON.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// isAPIRequest returns true if r appears to have been made by script (XMLHttpRequest or
+// fetch) or an API client, rather than by a browser navigating to a page.
+func isAPIRequest(r *http.Request) bool {
+	if strings.EqualFold(r.Header.Get("X-Requested-With"), "XMLHttpRequest") {
+		return true
+	}
+	if mode := r.Header.Get("Sec-Fetch-Mode"); mode != "" && mode != "navigate" {
+		return true
+	}
+	return negotiate(r.Header.Get("Accept")) == formatJSON
+}
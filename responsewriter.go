@@ -0,0 +1,129 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// statusWriter is an http.ResponseWriter which records the status code of the response.
+// Use wrapWriter to create one, so that the optional interfaces of the underlying
+// http.ResponseWriter are preserved.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// wrapWriter wraps w in a statusWriter.  The returned http.ResponseWriter implements
+// http.Flusher, http.Hijacker and http.Pusher if and only if w does, so that streaming
+// and WebSocket handlers continue to work.  It also implements Unwrap for use with
+// http.ResponseController.
+func wrapWriter(w http.ResponseWriter) (http.ResponseWriter, *statusWriter) {
+	sw := &statusWriter{ResponseWriter: w}
+
+	type unwrapper interface {
+		http.ResponseWriter
+		Unwrap() http.ResponseWriter
+	}
+	_, f := w.(http.Flusher)
+	_, h := w.(http.Hijacker)
+	_, p := w.(http.Pusher)
+	switch {
+	case f && h && p:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{sw, sw, sw, sw}, sw
+	case f && h:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Hijacker
+		}{sw, sw, sw}, sw
+	case f && p:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Pusher
+		}{sw, sw, sw}, sw
+	case h && p:
+		return struct {
+			unwrapper
+			http.Hijacker
+			http.Pusher
+		}{sw, sw, sw}, sw
+	case f:
+		return struct {
+			unwrapper
+			http.Flusher
+		}{sw, sw}, sw
+	case h:
+		return struct {
+			unwrapper
+			http.Hijacker
+		}{sw, sw}, sw
+	case p:
+		return struct {
+			unwrapper
+			http.Pusher
+		}{sw, sw}, sw
+	}
+	return struct{ unwrapper }{sw}, sw
+}
+
+// Status returns the status code of the response, http.StatusOK if the handler wrote
+// nothing.
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements http.ResponseWriter.
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Flush implements http.Flusher.
+func (w *statusWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+// Hijack implements http.Hijacker.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// Push implements http.Pusher.
+func (w *statusWriter) Push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
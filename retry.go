@@ -0,0 +1,189 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMaxRetryWait is the default for Client.MaxRetryWait.
+const defaultMaxRetryWait = time.Minute
+
+// Defaults for RetryPolicy.
+const (
+	defaultMinBackoff = 100 * time.Millisecond
+	defaultMaxBackoff = 10 * time.Second
+)
+
+// RetryPolicy configures Client retries of requests which fail with transient errors:
+// network errors and 5xx responses (other than http.StatusNotImplemented).  Attempts
+// are separated by exponential backoff with jitter, and each attempt is signed afresh.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first.
+	MaxAttempts int
+
+	// MinBackoff and MaxBackoff bound the wait before each retry, which doubles from
+	// MinBackoff with each attempt (and is then randomly reduced by up to half).
+	// Default to 100ms and 10s.  A longer Retry-After delay (up to
+	// Client.MaxRetryWait) from the server is respected.
+	MinBackoff, MaxBackoff time.Duration
+
+	// RetryNonIdempotent retries requests of any method.  By default only requests with
+	// idempotent methods (GET, HEAD, OPTIONS, TRACE, PUT and DELETE) or an
+	// Idempotency-Key header are retried.
+	RetryNonIdempotent bool
+
+	// Retry, if non-nil, replaces the default check of whether a response or error is
+	// transient.
+	Retry func(resp *http.Response, err error) bool
+}
+
+// retry returns true if a request is retryable after receiving resp or err.
+func (p *RetryPolicy) retry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if !p.RetryNonIdempotent && !isIdempotent(req) {
+		return false
+	}
+	if p.Retry != nil {
+		return p.Retry(resp, err)
+	}
+	return err != nil || (resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented)
+}
+
+// backoff returns the wait before retrying after n failed attempts.
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	min, max := p.MinBackoff, p.MaxBackoff
+	if min <= 0 {
+		min = defaultMinBackoff
+	}
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+	d := min
+	for i := 1; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d - time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// isIdempotent returns true if r can be safely sent more than once.
+func isIdempotent(r *http.Request) bool {
+	switch r.Method {
+	case "", "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+	return r.Header.Get("Idempotency-Key") != "" || r.Header.Get("X-Idempotency-Key") != ""
+}
+
+// doRetries implements Do for Clients with MaxRetries or Retry set, sending each attempt
+// using send (which signs it afresh).  Waits end early if the request context is done.
+// Requests whose body cannot be replayed (see BufferBody) are not retried.
+func (c *Client) doRetries(req *http.Request, send RoundTripFunc) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if _, err := bufferBody(req, maxReplayBody); err != nil {
+		return nil, err
+	}
+
+	for n := 0; ; n++ {
+		attempt := req
+		if n > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attempt = req.Clone(req.Context())
+			attempt.Body = body
+		}
+		resp, err := send(attempt)
+		if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+			return resp, err
+		}
+		wait, ok := c.retryWait(req, resp, err, n+1)
+		if !ok {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			t.Stop()
+			if c.OnError != nil {
+				c.OnError(req, req.Context().Err())
+			}
+			return nil, req.Context().Err()
+		case <-t.C:
+		}
+	}
+}
+
+// retryWait returns the wait before retrying req after n attempts, the last of which
+// received resp or err, and false if it should not be retried.
+func (c *Client) retryWait(req *http.Request, resp *http.Response, err error, n int) (time.Duration, bool) {
+	maxWait := c.MaxRetryWait
+	if maxWait <= 0 {
+		maxWait = defaultMaxRetryWait
+	}
+	if err == nil && n <= c.MaxRetries {
+		if wait, ok := retryAfter(resp, maxWait); ok {
+			return wait, true
+		}
+	}
+
+	p := c.Retry
+	if p == nil || n >= p.MaxAttempts || !p.retry(req, resp, err) {
+		return 0, false
+	}
+	wait := p.backoff(n)
+	if err == nil {
+		if d, ok := retryAfter(resp, maxWait); ok && d > wait {
+			wait = d
+		}
+	}
+	return wait, true
+}
+
+// retryAfter returns the delay requested by the Retry-After header (in seconds, or as
+// an HTTP date) of a http.StatusTooManyRequests or http.StatusServiceUnavailable
+// response, and false if there is none or it is longer than max.
+func retryAfter(resp *http.Response, max time.Duration) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	v := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+
+	var d time.Duration
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs < 0 || secs > int64(max/time.Second) {
+			return 0, false
+		}
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = time.Until(t)
+	} else {
+		return 0, false
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d, d <= max
+}
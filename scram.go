@@ -0,0 +1,532 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scramSchemeName is the HTTP authentication scheme name for SCRAM-SHA-256 (RFC 7804).
+const scramSchemeName = "SCRAM-SHA-256"
+
+const (
+	// defaultSCRAMIterations is the PBKDF2 iteration count used by NewSCRAMCredential
+	// by default (the minimum recommended by RFC 7677).
+	defaultSCRAMIterations = 4096
+
+	// maxSCRAMIterations is the largest iteration count accepted by SCRAMSigner, so
+	// that a server cannot make clients do unbounded work.
+	maxSCRAMIterations = 1 << 20
+
+	// scramExchangeTTL is how long a server waits for the final message of an exchange.
+	scramExchangeTTL = time.Minute
+
+	// maxSCRAMExchanges is the maximum number of exchanges a server keeps waiting for
+	// their final message.  When there are more, the oldest are discarded.
+	maxSCRAMExchanges = 10000
+)
+
+// ErrSCRAMFailed is returned by SCRAMSigner when the server does not continue a SCRAM
+// exchange.
+var ErrSCRAMFailed = errors.New("httpauth: SCRAM exchange failed")
+
+// SCRAMCredential is the information stored by a server to verify SCRAM-SHA-256
+// authentication (RFC 5802, RFC 7677), from which the password cannot be recovered.
+type SCRAMCredential struct {
+	Salt                 []byte
+	Iterations           int
+	StoredKey, ServerKey []byte
+}
+
+// NewSCRAMCredential derives the SCRAMCredential for the password using a random salt
+// and the number of PBKDF2 iterations (4096 if iterations is not positive).  Passwords
+// are used as UTF-8 without SASLprep normalisation.
+func NewSCRAMCredential(password string, iterations int) (SCRAMCredential, error) {
+	if iterations <= 0 {
+		iterations = defaultSCRAMIterations
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return SCRAMCredential{}, err
+	}
+	clientKey, serverKey, err := scramKeys(password, salt, iterations)
+	if err != nil {
+		return SCRAMCredential{}, err
+	}
+	storedKey := sha256.Sum256(clientKey)
+	return SCRAMCredential{
+		Salt:       salt,
+		Iterations: iterations,
+		StoredKey:  storedKey[:],
+		ServerKey:  serverKey,
+	}, nil
+}
+
+// scramKeys derives the client and server keys for the password.
+func scramKeys(password string, salt []byte, iterations int) (clientKey, serverKey []byte, err error) {
+	if iterations < 1 {
+		return nil, nil, errors.New("httpauth: invalid SCRAM iteration count")
+	}
+	salted := scramHi([]byte(password), salt, iterations)
+	return scramHMAC(salted, "Client Key"), scramHMAC(salted, "Server Key"), nil
+}
+
+// scramHi returns the salted password: Hi(password, salt, iterations) of RFC 5802, which
+// is PBKDF2 with HMAC-SHA-256 and a single block of output.
+func scramHi(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	hi := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range hi {
+			hi[j] ^= u[j]
+		}
+	}
+	return hi
+}
+
+// scramHMAC returns the HMAC-SHA-256 of msg using key.
+func scramHMAC(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
+
+// scramXOR returns a XOR b, which have the same length.
+func scramXOR(a, b []byte) []byte {
+	x := make([]byte, len(a))
+	for i := range a {
+		x[i] = a[i] ^ b[i]
+	}
+	return x
+}
+
+// SCRAMCredentialSource defines the SCRAMCredential method which provides stored
+// credentials for SCRAMScheme.
+type SCRAMCredentialSource interface {
+	// SCRAMCredential returns the credential for the user, and false if there is no
+	// such user.
+	SCRAMCredential(username string) (SCRAMCredential, bool)
+}
+
+// SCRAMCredentials creates a SCRAMCredentialSource which uses the map of
+// username-credential pairs.
+func SCRAMCredentials(m map[string]SCRAMCredential) SCRAMCredentialSource {
+	return scramCredentials{
+		m: m,
+	}
+}
+
+type scramCredentials struct {
+	m map[string]SCRAMCredential
+}
+
+// SCRAMCredential implements SCRAMCredentialSource.
+func (s scramCredentials) SCRAMCredential(username string) (SCRAMCredential, bool) {
+	c, ok := s.m[username]
+	return c, ok
+}
+
+// NewSCRAMHandler returns an http.Handler which authenticates requests using
+// SCRAM-SHA-256 (see SCRAMScheme) and passes them to the given http.Handler when
+// authenticated (responds with http.StatusUnauthorized otherwise).
+func NewSCRAMHandler(realm string, cs SCRAMCredentialSource, h http.Handler) http.Handler {
+	return NewMultiHandler(h, SCRAMScheme(realm, cs))
+}
+
+// SCRAMScheme creates a Scheme which authenticates requests using SCRAM-SHA-256 (RFC
+// 7804), so that clients prove knowledge of their password without sending it, and
+// the server stores only SCRAMCredentials.  Each request is authenticated with a new
+// exchange: the client's first message is answered with a challenge, and the request
+// carrying the client's final message is passed on with the username in its context
+// (see UserFromContext) and the server's signature in the Authentication-Info header.
+// Channel binding is not supported.  Unknown users receive a challenge as if they
+// existed, so that usernames cannot be discovered.
+func SCRAMScheme(realm string, cs SCRAMCredentialSource) Scheme {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("httpauth: generating key: " + err.Error())
+	}
+	return &scramScheme{
+		realm:     realm,
+		cs:        cs,
+		key:       key,
+		exchanges: make(map[string]*list.Element),
+		order:     list.New(),
+	}
+}
+
+type scramScheme struct {
+	realm string
+	cs    SCRAMCredentialSource
+	key   []byte // for salts of unknown users
+
+	mu        sync.Mutex
+	exchanges map[string]*list.Element // of *scramExchange, by sid
+	order     *list.List               // exchanges, oldest first
+	swept     time.Time
+}
+
+// remove removes the exchange e from s.  The caller must hold s.mu.
+func (s *scramScheme) remove(e *list.Element) *scramExchange {
+	x := s.order.Remove(e).(*scramExchange)
+	delete(s.exchanges, x.sid)
+	return x
+}
+
+// scramExchange is an exchange waiting for the client's final message.
+type scramExchange struct {
+	sid               string
+	username          string
+	cred              SCRAMCredential
+	known             bool
+	clientFirstBare   string
+	serverFirst       string
+	nonce             string
+	clientFirstHeader string
+	expires           time.Time
+}
+
+// scramContinue is returned by scramScheme.authenticate when the exchange continues
+// with a challenge carrying the server's first message.
+type scramContinue struct {
+	challenge string
+}
+
+func (e *scramContinue) Error() string { return "httpauth: SCRAM exchange continues" }
+
+type scramInfoKey struct{}
+
+// Authenticate implements Scheme.
+func (s *scramScheme) Authenticate(r *http.Request) (*http.Request, bool) {
+	rr, err := s.authenticate(r)
+	return rr, err == nil
+}
+
+// Challenge implements Scheme.
+func (s *scramScheme) Challenge() string {
+	if s.realm == "" {
+		return scramSchemeName
+	}
+	return scramSchemeName + " realm=" + quote(s.realm)
+}
+
+// challenge implements detailedScheme.
+func (s *scramScheme) challenge(err error) string {
+	if c, ok := err.(*scramContinue); ok {
+		return c.challenge
+	}
+	return s.Challenge()
+}
+
+// AuthenticationInfo implements AuthInfoScheme.
+func (s *scramScheme) AuthenticationInfo(r *http.Request) string {
+	info, _ := r.Context().Value(scramInfoKey{}).(string)
+	return info
+}
+
+// authenticate implements detailedScheme.
+func (s *scramScheme) authenticate(r *http.Request) (*http.Request, error) {
+	var params map[string]string
+	for _, c := range ParseChallenges(r.Header, "Authorization") {
+		if c.Scheme == strings.ToLower(scramSchemeName) {
+			params = c.Params
+			break
+		}
+	}
+	if params == nil {
+		return r, ErrNoCredentials
+	}
+	data, err := base64.StdEncoding.DecodeString(params["data"])
+	if err != nil || len(data) == 0 {
+		return r, ErrInvalidCredentials
+	}
+	if sid := params["sid"]; sid != "" {
+		return s.final(r, sid, string(data))
+	}
+	return r, s.first(string(data))
+}
+
+// first handles the client's first message, returning a *scramContinue error with the
+// server's first message.
+func (s *scramScheme) first(msg string) error {
+	// gs2-header: no channel binding, and no authzid.
+	var header string
+	switch {
+	case strings.HasPrefix(msg, "n,,"), strings.HasPrefix(msg, "y,,"):
+		header, msg = msg[:3], msg[3:]
+	default:
+		return ErrInvalidCredentials
+	}
+	attrs := scramAttrs(msg)
+	username, ok := scramUnescape(attrs["n"])
+	if !ok || username == "" || attrs["r"] == "" || strings.HasPrefix(msg, "m=") {
+		return ErrInvalidCredentials
+	}
+
+	cred, known := s.cs.SCRAMCredential(username)
+	if !known {
+		mac := hmac.New(sha256.New, s.key)
+		mac.Write([]byte(username))
+		cred = SCRAMCredential{Salt: mac.Sum(nil)[:16], Iterations: defaultSCRAMIterations}
+	}
+	snonce, err := randomString(18)
+	if err != nil {
+		return err
+	}
+	sid, err := randomString(16)
+	if err != nil {
+		return err
+	}
+	nonce := attrs["r"] + snonce
+	serverFirst := "r=" + nonce + ",s=" + base64.StdEncoding.EncodeToString(cred.Salt) + ",i=" + strconv.Itoa(cred.Iterations)
+
+	now := time.Now()
+	s.mu.Lock()
+	if now.Sub(s.swept) > time.Minute {
+		for e := s.order.Front(); e != nil && now.After(e.Value.(*scramExchange).expires); e = s.order.Front() {
+			s.remove(e)
+		}
+		s.swept = now
+	}
+	if s.order.Len() >= maxSCRAMExchanges {
+		s.remove(s.order.Front())
+	}
+	s.exchanges[sid] = s.order.PushBack(&scramExchange{
+		sid:               sid,
+		username:          username,
+		cred:              cred,
+		known:             known,
+		clientFirstBare:   msg,
+		serverFirst:       serverFirst,
+		nonce:             nonce,
+		clientFirstHeader: header,
+		expires:           now.Add(scramExchangeTTL),
+	})
+	s.mu.Unlock()
+
+	return &scramContinue{
+		challenge: scramSchemeName + " sid=" + sid + ", data=" + base64.StdEncoding.EncodeToString([]byte(serverFirst)),
+	}
+}
+
+// final handles the client's final message for the exchange sid, returning the request
+// with the username and server signature in its context if the client's proof is
+// valid.
+func (s *scramScheme) final(r *http.Request, sid, msg string) (*http.Request, error) {
+	var e *scramExchange
+	s.mu.Lock()
+	el, ok := s.exchanges[sid]
+	if ok {
+		e = s.remove(el)
+	}
+	s.mu.Unlock()
+	if !ok || time.Now().After(e.expires) {
+		return r, ErrInvalidCredentials
+	}
+
+	i := strings.LastIndex(msg, ",p=")
+	if i < 0 {
+		return r, ErrInvalidCredentials
+	}
+	withoutProof := msg[:i]
+	attrs := scramAttrs(withoutProof)
+	proof, err := base64.StdEncoding.DecodeString(msg[i+len(",p="):])
+	if err != nil || len(proof) != sha256.Size || attrs["r"] != e.nonce ||
+		attrs["c"] != base64.StdEncoding.EncodeToString([]byte(e.clientFirstHeader)) || !e.known {
+		return r, ErrInvalidCredentials
+	}
+
+	authMessage := e.clientFirstBare + "," + e.serverFirst + "," + withoutProof
+	clientKey := scramXOR(proof, scramHMAC(e.cred.StoredKey, authMessage))
+	storedKey := sha256.Sum256(clientKey)
+	if subtle.ConstantTimeCompare(storedKey[:], e.cred.StoredKey) != 1 {
+		return r, ErrInvalidCredentials
+	}
+
+	serverFinal := "v=" + base64.StdEncoding.EncodeToString(scramHMAC(e.cred.ServerKey, authMessage))
+	info := "sid=" + sid + ", data=" + base64.StdEncoding.EncodeToString([]byte(serverFinal))
+	r = withUser(r, e.username)
+	return r.WithContext(context.WithValue(r.Context(), scramInfoKey{}, info)), nil
+}
+
+// scramAttrs parses the comma-separated attribute=value pairs of a SCRAM message.
+func scramAttrs(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, kv := range strings.Split(msg, ",") {
+		if len(kv) >= 2 && kv[1] == '=' {
+			if _, ok := attrs[kv[:1]]; !ok {
+				attrs[kv[:1]] = kv[2:]
+			}
+		}
+	}
+	return attrs
+}
+
+// scramEscape encodes the username as a SCRAM saslname.
+func scramEscape(username string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(username)
+}
+
+// scramUnescape decodes a SCRAM saslname, returning false if it is malformed.
+func scramUnescape(name string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; c {
+		case ',':
+			return "", false
+		case '=':
+			switch {
+			case strings.HasPrefix(name[i:], "=3D"):
+				b.WriteByte('=')
+			case strings.HasPrefix(name[i:], "=2C"):
+				b.WriteByte(',')
+			default:
+				return "", false
+			}
+			i += 2
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), true
+}
+
+// SCRAMSigner is a Signer which authenticates requests using SCRAM-SHA-256 (RFC 7804),
+// so that the password is never sent to the server.  Before each request is sent, the
+// first leg of the exchange is made with a HEAD request to the same URL, and the request
+// is signed with the client's final message.  The server's signature (in the
+// Authentication-Info header of the response) is not checked, so the server is
+// authenticated only by TLS.
+//
+// A SCRAMSigner must not be copied after first use, and is safe for concurrent use.
+type SCRAMSigner struct {
+	User, Pass string
+
+	// Client is used for the first leg of each exchange.  If nil, http.DefaultClient
+	// is used.  Redirects are never followed.
+	Client *http.Client
+
+	mu   sync.Mutex
+	keys map[string][]byte // client keys by salt and iteration count
+}
+
+// Sign implements Signer.
+func (s *SCRAMSigner) Sign(r *http.Request) error {
+	return s.SignContext(r.Context(), r)
+}
+
+// SignContext implements ContextSigner, using ctx for the first leg of the exchange.
+func (s *SCRAMSigner) SignContext(ctx context.Context, r *http.Request) error {
+	cnonce, err := randomString(18)
+	if err != nil {
+		return err
+	}
+	clientFirstBare := "n=" + scramEscape(s.User) + ",r=" + cnonce
+	sid, serverFirst, err := s.first(ctx, r.URL.String(), "n,,"+clientFirstBare)
+	if err != nil {
+		return err
+	}
+
+	attrs := scramAttrs(serverFirst)
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	iterations, ierr := strconv.Atoi(attrs["i"])
+	if err != nil || ierr != nil || iterations < 1 || iterations > maxSCRAMIterations ||
+		len(attrs["r"]) <= len(cnonce) || !strings.HasPrefix(attrs["r"], cnonce) {
+		return ErrSCRAMFailed
+	}
+	clientKey, err := s.clientKey(attrs["s"], salt, iterations)
+	if err != nil {
+		return err
+	}
+
+	withoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte("n,,")) + ",r=" + attrs["r"]
+	authMessage := clientFirstBare + "," + serverFirst + "," + withoutProof
+	storedKey := sha256.Sum256(clientKey)
+	proof := scramXOR(clientKey, scramHMAC(storedKey[:], authMessage))
+	final := withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)
+	r.Header.Set("Authorization", scramSchemeName+" sid="+sid+", data="+base64.StdEncoding.EncodeToString([]byte(final)))
+	return nil
+}
+
+// first sends the client's first message to url, returning the exchange sid and the
+// server's first message.
+func (s *SCRAMSigner) first(ctx context.Context, url, msg string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Authorization", scramSchemeName+" data="+base64.StdEncoding.EncodeToString([]byte(msg)))
+
+	client := http.DefaultClient
+	if s.Client != nil {
+		client = s.Client
+	}
+	c := *client
+	c.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4<<10))
+	resp.Body.Close()
+
+	for _, ch := range ParseChallenges(resp.Header, "WWW-Authenticate") {
+		if ch.Scheme != strings.ToLower(scramSchemeName) || ch.Params["sid"] == "" {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(ch.Params["data"])
+		if err != nil {
+			return "", "", ErrSCRAMFailed
+		}
+		return ch.Params["sid"], string(data), nil
+	}
+	return "", "", ErrSCRAMFailed
+}
+
+// clientKey returns the client key for the salt and iteration count, derived from the
+// password the first time they are used.
+func (s *SCRAMSigner) clientKey(encodedSalt string, salt []byte, iterations int) ([]byte, error) {
+	k := encodedSalt + "," + strconv.Itoa(iterations)
+	s.mu.Lock()
+	key, ok := s.keys[k]
+	s.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	key, _, err := scramKeys(s.Pass, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if s.keys == nil {
+		s.keys = make(map[string][]byte)
+	}
+	s.keys[k] = key
+	s.mu.Unlock()
+	return key, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth_test
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/dhowden/httpauth"
+)
+
+func TestSCRAM(t *testing.T) {
+	cred, err := NewSCRAMCredential("pencil", 0)
+	if err != nil {
+		t.Fatalf("NewSCRAMCredential() returned unexpected error: %v", err)
+	}
+	var auths []string
+	h := NewSCRAMHandler("test", SCRAMCredentials(map[string]SCRAMCredential{"us,er": cred}), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, _ := UserFromContext(r.Context()); u != "us,er" {
+			t.Errorf("UserFromContext() = %q, expected: %q", u, "us,er")
+		}
+		handlerFuncOK(w, r)
+	}))
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.Header.Get("Authorization"))
+		h.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if c := w.Header().Get("WWW-Authenticate"); w.Code != http.StatusUnauthorized || c != `SCRAM-SHA-256 realm="test"` {
+		t.Errorf("w.Code = %d, WWW-Authenticate = %q", w.Code, c)
+	}
+
+	tests := []struct {
+		user, pass string
+		code       int
+	}{
+		{"us,er", "pencil", http.StatusOK},
+		{"us,er", "crayon", http.StatusUnauthorized},
+		{"nobody", "pencil", http.StatusUnauthorized},
+	}
+
+	for ii, tt := range tests {
+		auths = nil
+		c := NewClient(s.Client(), &SCRAMSigner{User: tt.user, Pass: tt.pass, Client: s.Client()})
+		resp, err := c.Post(s.URL, "text/plain", strings.NewReader("body"))
+		if err != nil {
+			t.Fatalf("[%d] c.Post() returned unexpected error: %v", ii, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.code {
+			t.Errorf("[%d] resp.StatusCode = %d, expected: %d", ii, resp.StatusCode, tt.code)
+		}
+		if info := resp.Header.Get("Authentication-Info"); (info != "") != (tt.code == http.StatusOK) {
+			t.Errorf("[%d] Authentication-Info = %q", ii, info)
+		}
+		if len(auths) != 2 {
+			t.Errorf("[%d] server received %d requests, expected 2", ii, len(auths))
+		}
+		for _, a := range auths {
+			if strings.Contains(a, base64.StdEncoding.EncodeToString([]byte(tt.pass))) || strings.Contains(a, tt.pass) {
+				t.Errorf("[%d] password sent in Authorization header %q", ii, a)
+			}
+		}
+	}
+
+	// Final messages can't be replayed.
+	r, err = http.NewRequest("GET", s.URL, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	if err := (&SCRAMSigner{User: "us,er", Pass: "pencil", Client: s.Client()}).Sign(r); err != nil {
+		t.Fatalf("Sign() returned unexpected error: %v", err)
+	}
+	for ii, expected := range []int{http.StatusOK, http.StatusUnauthorized} {
+		resp, err := s.Client().Do(r)
+		if err != nil {
+			t.Fatalf("[%d] Do() returned unexpected error: %v", ii, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("[%d] resp.StatusCode = %d, expected: %d", ii, resp.StatusCode, expected)
+		}
+	}
+}
+
+func TestSCRAMKnownCredential(t *testing.T) {
+	// The credential of RFC 7677, section 3 ("user", "pencil"), derived independently.
+	decode := func(s string) []byte {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("unexpected error decoding %q: %v", s, err)
+		}
+		return b
+	}
+	cred := SCRAMCredential{
+		Salt:       decode("W22ZaJ0SNY7soEsUEjb6gQ=="),
+		Iterations: 4096,
+		StoredKey:  decode("WG5d8oPm3OtcPnkdi4Uo7BkeZkBFzpcXkuLmtbsT4qY="),
+		ServerKey:  decode("wfPLwcE6nTWhTAmQ7tl2KeoiWGPlZqQxSrmfPwDl2dU="),
+	}
+	s := httptest.NewServer(NewSCRAMHandler("test", SCRAMCredentials(map[string]SCRAMCredential{"user": cred}), http.HandlerFunc(handlerFuncOK)))
+	defer s.Close()
+
+	c := NewClient(s.Client(), &SCRAMSigner{User: "user", Pass: "pencil", Client: s.Client()})
+	resp, err := c.Get(s.URL)
+	if err != nil {
+		t.Fatalf("c.Get() returned unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("resp.StatusCode = %d, expected: %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestSCRAMExchangeLimit(t *testing.T) {
+	cred, err := NewSCRAMCredential("pencil", 0)
+	if err != nil {
+		t.Fatalf("NewSCRAMCredential() returned unexpected error: %v", err)
+	}
+	h := NewSCRAMHandler("test", SCRAMCredentials(map[string]SCRAMCredential{"user": cred}), http.HandlerFunc(handlerFuncOK))
+
+	// Abandoned exchanges beyond the limit do not lock out other clients.
+	first := "SCRAM-SHA-256 data=" + base64.StdEncoding.EncodeToString([]byte("n,,n=user,r=abc"))
+	for i := 0; i < 10001; i++ {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", first)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if !strings.Contains(w.Header().Get("WWW-Authenticate"), "sid=") {
+			t.Fatalf("[%d] WWW-Authenticate = %q, expected a continued exchange", i, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	s := httptest.NewServer(h)
+	defer s.Close()
+	c := NewClient(s.Client(), &SCRAMSigner{User: "user", Pass: "pencil", Client: s.Client()})
+	resp, err := c.Get(s.URL)
+	if err != nil {
+		t.Fatalf("c.Get() returned unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("resp.StatusCode = %d, expected: %d", resp.StatusCode, http.StatusOK)
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default session settings.
+const (
+	DefaultSessionCookie = "httpauth_session"
+	DefaultSessionTTL    = 12 * time.Hour
+)
+
+// Sessions issues and validates signed session cookies, so that clients which have
+// authenticated once need not be checked again until the session expires.
+type Sessions struct {
+	// Key is the secret used to sign session cookies, which must be at least
+	// MinSessionKeySize bytes.  Sessions with a shorter key are never issued or
+	// accepted.
+	Key []byte
+
+	// CookieName is the name of the session cookie.  Defaults to DefaultSessionCookie.
+	CookieName string
+
+	// TTL is the lifetime of a session.  Defaults to DefaultSessionTTL.
+	TTL time.Duration
+
+	// Store, if non-nil, records sessions server-side so that they can be revoked
+	// before they expire (see Clear and RevokeUser).
+	Store SessionStore
+}
+
+// MinSessionKeySize is the minimum size of Sessions.Key.
+const MinSessionKeySize = 32
+
+// Errors returned by Sessions.
+var (
+	// ErrNoSessionStore is returned by Sessions.RevokeUser when there is no
+	// SessionStore.
+	ErrNoSessionStore = errors.New("httpauth: sessions have no store")
+
+	// ErrSessionKey is returned by Sessions.Issue when the Key is shorter than
+	// MinSessionKeySize.
+	ErrSessionKey = errors.New("httpauth: session key is too short")
+)
+
+func (s *Sessions) cookieName() string {
+	if s.CookieName == "" {
+		return DefaultSessionCookie
+	}
+	return s.CookieName
+}
+
+func (s *Sessions) ttl() time.Duration {
+	if s.TTL == 0 {
+		return DefaultSessionTTL
+	}
+	return s.TTL
+}
+
+// Issue creates a new session for the username and sets the session cookie on the response.
+// Returns ErrSessionKey if the Key is too short.
+func (s *Sessions) Issue(w http.ResponseWriter, r *http.Request, username string) error {
+	if len(s.Key) < MinSessionKeySize {
+		return ErrSessionKey
+	}
+	id, err := randomString(16)
+	if err != nil {
+		return err
+	}
+	expires := time.Now().Add(s.ttl())
+	if s.Store != nil {
+		if err := s.Store.Add(id, username, expires); err != nil {
+			return err
+		}
+	}
+	payload := id + "." + base64.RawURLEncoding.EncodeToString([]byte(username)) + "." + strconv.FormatInt(expires.Unix(), 10)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookieName(),
+		Value:    payload + "." + s.sign(payload),
+		Path:     "/",
+		Expires:  expires,
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// Clear ends the session in r (if any), removing it from the Store and expiring the
+// session cookie on the response.
+func (s *Sessions) Clear(w http.ResponseWriter, r *http.Request) error {
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cookieName(),
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	if s.Store == nil {
+		return nil
+	}
+	if id, _, ok := s.session(r); ok {
+		return s.Store.Delete(id)
+	}
+	return nil
+}
+
+// RevokeUser ends all sessions for the username.  Returns ErrNoSessionStore if there
+// is no Store.
+func (s *Sessions) RevokeUser(username string) error {
+	if s.Store == nil {
+		return ErrNoSessionStore
+	}
+	return s.Store.DeleteUser(username)
+}
+
+// User returns the username of the session in r, and false if r does not have a valid
+// session cookie.
+func (s *Sessions) User(r *http.Request) (string, bool) {
+	id, username, ok := s.session(r)
+	if !ok {
+		return "", false
+	}
+	if s.Store != nil && !s.Store.Valid(id) {
+		return "", false
+	}
+	return username, true
+}
+
+// session returns the ID and username of the session in r if the session cookie is
+// correctly signed and has not expired.
+func (s *Sessions) session(r *http.Request) (id, username string, ok bool) {
+	if len(s.Key) < MinSessionKeySize {
+		return "", "", false
+	}
+	c, err := r.Cookie(s.cookieName())
+	if err != nil {
+		return "", "", false
+	}
+
+	i := strings.LastIndexByte(c.Value, '.')
+	if i < 0 {
+		return "", "", false
+	}
+	payload, sig := c.Value[:i], c.Value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(s.sign(payload))) {
+		return "", "", false
+	}
+
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return "", "", false
+	}
+	u, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", "", false
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || time.Now().Unix() >= expires {
+		return "", "", false
+	}
+	return parts[0], string(u), true
+}
+
+// sign returns the base64url-encoded signature of the cookie payload.
+func (s *Sessions) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// SessionStore defines methods for recording sessions server-side.
+type SessionStore interface {
+	// Add records the session id for username, valid until expires.
+	Add(id, username string, expires time.Time) error
+
+	// Valid returns true if the session id is recorded and has not expired.
+	Valid(id string) bool
+
+	// Delete removes the session id.
+	Delete(id string) error
+
+	// DeleteUser removes all sessions for username.
+	DeleteUser(username string) error
+}
+
+// NewMemorySessionStore creates a SessionStore which records sessions in memory.  Expired
+// sessions are removed periodically as new sessions are added.
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{
+		m: make(map[string]memorySession),
+	}
+}
+
+type memorySession struct {
+	username string
+	expires  time.Time
+}
+
+type memorySessionStore struct {
+	sync.Mutex
+	m     map[string]memorySession
+	swept time.Time
+}
+
+// Add implements SessionStore.
+func (s *memorySessionStore) Add(id, username string, expires time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.swept) > time.Minute {
+		for id, x := range s.m {
+			if now.After(x.expires) {
+				delete(s.m, id)
+			}
+		}
+		s.swept = now
+	}
+	s.m[id] = memorySession{username, expires}
+	return nil
+}
+
+// Valid implements SessionStore.
+func (s *memorySessionStore) Valid(id string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	x, ok := s.m[id]
+	return ok && time.Now().Before(x.expires)
+}
+
+// Delete implements SessionStore.
+func (s *memorySessionStore) Delete(id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.m, id)
+	return nil
+}
+
+// DeleteUser implements SessionStore.
+func (s *memorySessionStore) DeleteUser(username string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, x := range s.m {
+		if x.username == username {
+			delete(s.m, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,341 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/dhowden/httpauth"
+)
+
+// sessionKey is a Sessions.Key of MinSessionKeySize bytes.
+var sessionKey = []byte("0123456789abcdef0123456789abcdef")
+
+// countingChecker counts calls to Check.
+type countingChecker struct {
+	Checker
+	n int
+}
+
+func (c *countingChecker) Check(username, password string) bool {
+	c.n++
+	return c.Checker.Check(username, password)
+}
+
+func TestSessionCookie(t *testing.T) {
+	c := &countingChecker{Checker: Creds(map[string]string{"alice": "shhhh"})}
+	s := &Sessions{Key: sessionKey}
+	h := NewHandler(c, http.HandlerFunc(handlerFuncOK), SessionCookie(s))
+
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	r.SetBasicAuth("alice", "shhhh")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("w.Code = %d, expected: %d", w.Code, http.StatusOK)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != DefaultSessionCookie {
+		t.Fatalf("expected session cookie, got %v", cookies)
+	}
+
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusOK)
+	}
+	if c.n != 1 {
+		t.Errorf("Check called %d times, expected 1", c.n)
+	}
+	if u, ok := s.User(r); !ok || u != "alice" {
+		t.Errorf("s.User() = %q, %v, expected %q, true", u, ok, "alice")
+	}
+
+	// Tampered cookie
+	r, _ = http.NewRequest("GET", "/", nil)
+	parts := strings.Split(cookies[0].Value, ".")
+	parts[1] = "Ym9i" // bob
+	r.AddCookie(&http.Cookie{Name: DefaultSessionCookie, Value: strings.Join(parts, ".")})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// Signed with a different key
+	other := &Sessions{Key: []byte("another key which is 32 bytes...")}
+	if _, ok := other.User(r); ok {
+		t.Errorf("other.User() = true, expected false")
+	}
+
+	// Short keys are rejected.
+	short := &Sessions{}
+	if err := short.Issue(httptest.NewRecorder(), r, "alice"); err != ErrSessionKey {
+		t.Errorf("short.Issue() = %v, expected: %v", err, ErrSessionKey)
+	}
+	payload := "id." + base64.RawURLEncoding.EncodeToString([]byte("alice")) + "." + strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	mac := hmac.New(sha256.New, nil)
+	mac.Write([]byte(payload))
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: DefaultSessionCookie, Value: payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))})
+	if _, ok := short.User(r); ok {
+		t.Errorf("short.User() = true, expected false")
+	}
+}
+
+func TestLoginHandler(t *testing.T) {
+	s := &Sessions{Key: sessionKey}
+	login := NewLoginHandler(Creds(map[string]string{"alice": "shhhh"}), s, "/home")
+
+	tests := []struct {
+		form     url.Values
+		code     int
+		location string
+	}{
+		{url.Values{"username": {"alice"}, "password": {"wrong"}}, http.StatusUnauthorized, ""},
+		{url.Values{"username": {"alice"}, "password": {"shhhh"}}, http.StatusSeeOther, "/home"},
+		{url.Values{"username": {"alice"}, "password": {"shhhh"}, "next": {"/page?x=1"}}, http.StatusSeeOther, "/page?x=1"},
+		{url.Values{"username": {"alice"}, "password": {"shhhh"}, "next": {"//evil.com"}}, http.StatusSeeOther, "/home"},
+		{url.Values{"username": {"alice"}, "password": {"shhhh"}, "next": {"/\\evil.com"}}, http.StatusSeeOther, "/home"},
+		{url.Values{"username": {"alice"}, "password": {"shhhh"}, "next": {"/\t/evil.com"}}, http.StatusSeeOther, "/home"},
+		{url.Values{"username": {"alice"}, "password": {"shhhh"}, "next": {"/\r\n/evil.com"}}, http.StatusSeeOther, "/home"},
+		{url.Values{"username": {"alice"}, "password": {"shhhh"}, "next": {"/ /evil.com"}}, http.StatusSeeOther, "/home"},
+		{url.Values{"username": {"alice"}, "password": {"shhhh"}, "next": {"/%zz"}}, http.StatusSeeOther, "/home"},
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest("POST", "/login", strings.NewReader(tt.form.Encode()))
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		login.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("[%d] w.Code = %d, expected: %d", ii, w.Code, tt.code)
+		}
+		if w.Header().Get("Location") != tt.location {
+			t.Errorf("[%d] Location = %q, expected: %q", ii, w.Header().Get("Location"), tt.location)
+		}
+		if got := len(w.Result().Cookies()); (got == 1) != (tt.code == http.StatusSeeOther) {
+			t.Errorf("[%d] got %d cookies", ii, got)
+		}
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	s := &Sessions{Key: sessionKey}
+	var username string
+	h := RequireSession(s, "/login", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, _ = UserFromContext(r.Context())
+		handlerFuncOK(w, r)
+	}))
+
+	r, err := http.NewRequest("GET", "/page?x=1", nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusFound {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusFound)
+	}
+	if loc := w.Header().Get("Location"); loc != "/login?next=%2Fpage%3Fx%3D1" {
+		t.Errorf("Location = %q, expected: %q", loc, "/login?next=%2Fpage%3Fx%3D1")
+	}
+
+	w = httptest.NewRecorder()
+	s.Issue(w, r, "alice")
+	r.AddCookie(w.Result().Cookies()[0])
+	testHandlerOK(t, "/", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		h.ServeHTTP(w, r)
+	}))
+	if username != "alice" {
+		t.Errorf("UserFromContext() = %q, expected: %q", username, "alice")
+	}
+}
+
+func TestLogout(t *testing.T) {
+	s := &Sessions{Key: sessionKey, Store: NewMemorySessionStore()}
+
+	session := func(username string) *http.Request {
+		r, err := http.NewRequest("POST", "/", nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		if err := s.Issue(w, r, username); err != nil {
+			t.Fatalf("s.Issue() returned unexpected error: %v", err)
+		}
+		r.AddCookie(w.Result().Cookies()[0])
+		return r
+	}
+
+	// Only POST requests log out.
+	r := session("alice")
+	r.Method = "GET"
+	w := httptest.NewRecorder()
+	NewLogoutHandler(s, "/").ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "POST" {
+		t.Errorf("w.Code = %d, Allow = %q, expected: %d, %q", w.Code, w.Header().Get("Allow"), http.StatusMethodNotAllowed, "POST")
+	}
+	if _, ok := s.User(r); !ok {
+		t.Errorf("s.User() = false after GET logout, expected true")
+	}
+
+	r.Method = "POST"
+	w = httptest.NewRecorder()
+	NewLogoutHandler(s, "/").ServeHTTP(w, r)
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusSeeOther)
+	}
+	if c := w.Result().Cookies(); len(c) != 1 || c[0].MaxAge >= 0 {
+		t.Errorf("expected expired session cookie, got %v", c)
+	}
+
+	// The old cookie must no longer be accepted.
+	if _, ok := s.User(r); ok {
+		t.Errorf("s.User() = true after logout, expected false")
+	}
+
+	r1, r2, r3 := session("alice"), session("alice"), session("bob")
+	if err := s.RevokeUser("alice"); err != nil {
+		t.Fatalf("s.RevokeUser() returned unexpected error: %v", err)
+	}
+	for _, r := range []*http.Request{r1, r2} {
+		if _, ok := s.User(r); ok {
+			t.Errorf("s.User() = true after RevokeUser, expected false")
+		}
+	}
+	if _, ok := s.User(r3); !ok {
+		t.Errorf("s.User() = false for other user, expected true")
+	}
+
+	if err := (&Sessions{}).RevokeUser("alice"); err != ErrNoSessionStore {
+		t.Errorf("RevokeUser() error = %v, expected %v", err, ErrNoSessionStore)
+	}
+}
+
+func TestMagicLinks(t *testing.T) {
+	s := &Sessions{Key: sessionKey}
+	m := &MagicLinks{Store: NewMemoryTokenStore(), Sessions: s}
+	h := NewMagicLinkHandler(m, "/home")
+
+	token, err := m.Issue("alice")
+	if err != nil {
+		t.Fatalf("m.Issue() returned unexpected error: %v", err)
+	}
+	expired, err := (&MagicLinks{Store: m.Store, Sessions: s, TTL: -time.Second}).Issue("alice")
+	if err != nil {
+		t.Fatalf("m.Issue() returned unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		query    string
+		code     int
+		location string
+	}{
+		{"token=wrong", http.StatusUnauthorized, ""},
+		{"token=" + expired, http.StatusUnauthorized, ""},
+		{"token=" + token + "&next=/page", http.StatusSeeOther, "/page"},
+		{"token=" + token, http.StatusUnauthorized, ""}, // already redeemed
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest("GET", "/magic?"+tt.query, nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("[%d] w.Code = %d, expected: %d", ii, w.Code, tt.code)
+		}
+		if w.Header().Get("Location") != tt.location {
+			t.Errorf("[%d] Location = %q, expected: %q", ii, w.Header().Get("Location"), tt.location)
+		}
+		if tt.code != http.StatusSeeOther {
+			continue
+		}
+		r = &http.Request{Header: http.Header{}}
+		r.AddCookie(w.Result().Cookies()[0])
+		if username, ok := s.User(r); !ok || username != "alice" {
+			t.Errorf("[%d] s.User() = %q, %v, expected %q, true", ii, username, ok, "alice")
+		}
+	}
+}
+
+func TestSignedURLs(t *testing.T) {
+	s := &URLSigner{Key: []byte("key")}
+	h := NewSignedURLHandler(s, http.HandlerFunc(handlerFuncOK))
+
+	signed, err := s.Sign("http://example.com/files/report.pdf?download=1")
+	if err != nil {
+		t.Fatalf("s.Sign() returned unexpected error: %v", err)
+	}
+	expired, err := s.SignUntil("/files/report.pdf", time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("s.SignUntil() returned unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		url  string
+		code int
+	}{
+		{signed, http.StatusOK},
+		{"/files/report.pdf?download=1", http.StatusForbidden},
+		{expired, http.StatusForbidden},
+		{strings.Replace(signed, "report", "secret", 1), http.StatusForbidden},
+		{strings.Replace(signed, "download=1", "download=2", 1), http.StatusForbidden},
+		{signed + "&extra=1", http.StatusForbidden},
+	}
+
+	for ii, tt := range tests {
+		r, err := http.NewRequest("GET", tt.url, nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("[%d] w.Code = %d, expected: %d", ii, w.Code, tt.code)
+		}
+	}
+
+	other := &URLSigner{Key: []byte("other")}
+	r, _ := http.NewRequest("GET", signed, nil)
+	if other.Valid(r) {
+		t.Errorf("other.Valid() = true, expected false")
+	}
+
+	// URLs are not signed or accepted without a key.
+	empty := &URLSigner{}
+	if _, err := empty.Sign("/files/report.pdf"); err != ErrNoURLSignerKey {
+		t.Errorf("empty.Sign() = %v, expected: %v", err, ErrNoURLSignerKey)
+	}
+	mac := hmac.New(sha256.New, nil)
+	q := url.Values{"expires": {strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)}}
+	mac.Write([]byte("/files/report.pdf?" + q.Encode()))
+	q.Set("signature", base64.RawURLEncoding.EncodeToString(mac.Sum(nil)))
+	r, _ = http.NewRequest("GET", "/files/report.pdf?"+q.Encode(), nil)
+	if empty.Valid(r) {
+		t.Errorf("empty.Valid() = true, expected false")
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// errStructuredField is returned when parsing a malformed structured field value.
+var errStructuredField = errors.New("httpauth: malformed structured field")
+
+// sfMember is a member of a structured field dictionary (RFC 8941 section 3.2) whose
+// value is an item or an inner list of items.
+type sfMember struct {
+	key    string
+	raw    string        // the serialized value, including parameters
+	items  []interface{} // the item, or the items of the inner list
+	inner  bool          // whether the value is an inner list
+	params map[string]interface{}
+}
+
+// parseSFDictionary parses a structured field dictionary.  Items are decoded as int64,
+// string (for both strings and tokens), []byte or bool.  Item parameters within inner
+// lists are not supported.
+func parseSFDictionary(s string) ([]sfMember, error) {
+	p := &sfParser{s: s}
+	var members []sfMember
+	for {
+		p.skip(" \t")
+		if p.done() {
+			return members, nil
+		}
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		m := sfMember{key: key}
+		start := p.i
+		if p.peek() == '=' {
+			p.i++
+			start = p.i
+			if p.peek() == '(' {
+				m.inner = true
+				if m.items, err = p.innerList(); err != nil {
+					return nil, err
+				}
+			} else {
+				item, err := p.bareItem()
+				if err != nil {
+					return nil, err
+				}
+				m.items = []interface{}{item}
+			}
+		} else {
+			m.items = []interface{}{true}
+		}
+		if m.params, err = p.params(); err != nil {
+			return nil, err
+		}
+		m.raw = s[start:p.i]
+		members = append(members, m)
+
+		p.skip(" \t")
+		if p.done() {
+			return members, nil
+		}
+		if p.peek() != ',' {
+			return nil, errStructuredField
+		}
+		p.i++
+	}
+}
+
+type sfParser struct {
+	s string
+	i int
+}
+
+func (p *sfParser) done() bool { return p.i >= len(p.s) }
+
+func (p *sfParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *sfParser) skip(chars string) {
+	for !p.done() && strings.IndexByte(chars, p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+func (p *sfParser) key() (string, error) {
+	start := p.i
+	c := p.peek()
+	if !(c >= 'a' && c <= 'z') && c != '*' {
+		return "", errStructuredField
+	}
+	for !p.done() {
+		c := p.s[p.i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("_-.*", c) >= 0) {
+			break
+		}
+		p.i++
+	}
+	return p.s[start:p.i], nil
+}
+
+func (p *sfParser) innerList() ([]interface{}, error) {
+	p.i++ // (
+	var items []interface{}
+	for {
+		p.skip(" ")
+		if p.peek() == ')' {
+			p.i++
+			return items, nil
+		}
+		item, err := p.bareItem()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() == ';' {
+			return nil, errStructuredField
+		}
+		items = append(items, item)
+		if c := p.peek(); c != ' ' && c != ')' {
+			return nil, errStructuredField
+		}
+	}
+}
+
+func (p *sfParser) params() (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	for p.peek() == ';' {
+		p.i++
+		p.skip(" ")
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		var v interface{} = true
+		if p.peek() == '=' {
+			p.i++
+			if v, err = p.bareItem(); err != nil {
+				return nil, err
+			}
+		}
+		params[key] = v
+	}
+	return params, nil
+}
+
+func (p *sfParser) bareItem() (interface{}, error) {
+	c := p.peek()
+	switch {
+	case c == '"':
+		var b strings.Builder
+		for p.i++; !p.done(); p.i++ {
+			c := p.s[p.i]
+			switch {
+			case c == '\\':
+				p.i++
+				if p.done() || (p.s[p.i] != '"' && p.s[p.i] != '\\') {
+					return nil, errStructuredField
+				}
+				b.WriteByte(p.s[p.i])
+			case c == '"':
+				p.i++
+				return b.String(), nil
+			case c < 0x20 || c > 0x7e:
+				return nil, errStructuredField
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return nil, errStructuredField
+
+	case c == ':':
+		end := strings.IndexByte(p.s[p.i+1:], ':')
+		if end < 0 {
+			return nil, errStructuredField
+		}
+		b, err := base64.StdEncoding.DecodeString(p.s[p.i+1 : p.i+1+end])
+		if err != nil {
+			return nil, errStructuredField
+		}
+		p.i += end + 2
+		return b, nil
+
+	case c == '?':
+		if p.i+1 >= len(p.s) || (p.s[p.i+1] != '0' && p.s[p.i+1] != '1') {
+			return nil, errStructuredField
+		}
+		p.i += 2
+		return p.s[p.i-1] == '1', nil
+
+	case c == '-' || c >= '0' && c <= '9':
+		start := p.i
+		for p.i++; !p.done() && p.s[p.i] >= '0' && p.s[p.i] <= '9'; p.i++ {
+		}
+		n, err := strconv.ParseInt(p.s[start:p.i], 10, 64)
+		if err != nil || p.peek() == '.' {
+			// Decimals are not supported.
+			return nil, errStructuredField
+		}
+		return n, nil
+
+	case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '*':
+		start := p.i
+		for !p.done() {
+			c := p.s[p.i]
+			if c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),;<=>?@[\]{}`, c) >= 0 {
+				break
+			}
+			p.i++
+		}
+		return p.s[start:p.i], nil
+	}
+	return nil, errStructuredField
+}
@@ -0,0 +1,299 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+	sigV4Unsigned   = "UNSIGNED-PAYLOAD"
+)
+
+// SigV4Signer is a Signer which signs requests using AWS Signature Version 4, so that
+// Client can call AWS and SigV4-compatible services.  The request body is hashed for
+// the X-Amz-Content-Sha256 header: if the request has GetBody (as set by
+// http.NewRequest for in-memory bodies, or by ReplayableBody) it is hashed from a second
+// copy of the body, and otherwise the body is read into memory (up to 10MB, see
+// ErrBodyNotReplayable).  Bodies which should not be hashed (e.g. streaming uploads) can
+// be sent unsigned with UnsignedPayload, or their digest set in the
+// X-Amz-Content-Sha256 header by the caller before signing.
+type SigV4Signer struct {
+	// AccessKeyID and SecretAccessKey are the credentials used to sign requests.
+	AccessKeyID, SecretAccessKey string
+
+	// SessionToken, if non-empty, is sent in the X-Amz-Security-Token header for
+	// temporary credentials.
+	SessionToken string
+
+	// Region and Service form the credential scope of the signature, e.g. "us-east-1"
+	// and "s3".
+	Region, Service string
+
+	// DisablePathEscaping disables the additional escaping of the URI path used by
+	// all services except Amazon S3.
+	DisablePathEscaping bool
+
+	// UnsignedPayload sends UNSIGNED-PAYLOAD as the payload hash, so that the body is
+	// not read or covered by the signature (supported by Amazon S3).
+	UnsignedPayload bool
+}
+
+// Sign implements Signer.
+func (s SigV4Signer) Sign(r *http.Request) error {
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		if s.UnsignedPayload {
+			payloadHash = sigV4Unsigned
+		} else {
+			var err error
+			if payloadHash, err = bodyDigest(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	amzDate := time.Now().UTC().Format(sigV4TimeFormat)
+	r.Header.Set("X-Amz-Date", amzDate)
+	r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	if r.Host == "" {
+		r.Host = r.URL.Host
+	}
+
+	signed := []string{"host"}
+	for k := range r.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-amz-") || k == "content-type" || k == "content-md5" {
+			signed = append(signed, k)
+		}
+	}
+	sort.Strings(signed)
+
+	scope := amzDate[:8] + "/" + s.Region + "/" + s.Service + "/aws4_request"
+	sig := sigV4Signature([]byte(s.SecretAccessKey), r, amzDate, scope, signed, payloadHash, !s.DisablePathEscaping)
+	r.Header.Set("Authorization", sigV4Algorithm+
+		" Credential="+s.AccessKeyID+"/"+scope+
+		", SignedHeaders="+strings.Join(signed, ";")+
+		", Signature="+sig)
+	return nil
+}
+
+// SigV4Verifier verifies requests signed using AWS Signature Version 4 with the
+// Authorization header.
+type SigV4Verifier struct {
+	// Secrets provides the secret access keys by access key ID.
+	Secrets SecretSource
+
+	// Region and Service, if non-empty, are the required region and service in the
+	// credential scope of the signature.
+	Region, Service string
+
+	// MaxSkew is the maximum difference between the X-Amz-Date of the request and
+	// the current time.  Defaults to 15 minutes.
+	MaxSkew time.Duration
+
+	// DisablePathEscaping disables the additional escaping of the URI path used by
+	// all services except Amazon S3.
+	DisablePathEscaping bool
+
+	// AllowUnsignedPayload permits requests with X-Amz-Content-Sha256 set to
+	// UNSIGNED-PAYLOAD, whose bodies are not covered by the signature.
+	AllowUnsignedPayload bool
+
+	// MaxBody is the maximum size of request body which will be read to verify the
+	// signature.  Defaults to 10MB.
+	MaxBody int64
+}
+
+// NewSigV4Handler returns an http.Handler which verifies AWS Signature Version 4
+// request signatures using the SigV4Verifier and passes requests to the given
+// http.Handler when the signature is valid (responds with http.StatusUnauthorized
+// otherwise).
+func NewSigV4Handler(v *SigV4Verifier, h http.Handler) http.Handler {
+	vv := *v
+	v = &vv
+	if v.MaxSkew == 0 {
+		v.MaxSkew = 15 * time.Minute
+	}
+	if v.MaxBody == 0 {
+		v.MaxBody = maxSignedBody
+	}
+	return &sigV4Handler{
+		Handler: h,
+		v:       v,
+	}
+}
+
+type sigV4Handler struct {
+	http.Handler
+	v *SigV4Verifier
+}
+
+// ServeHTTP implements http.Handler.
+func (h *sigV4Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.v.verify(r) {
+		unauthorized(w, r, "")
+		return
+	}
+	h.Handler.ServeHTTP(w, r)
+}
+
+// verify returns true if r carries a valid SigV4 signature.  The request body is
+// replaced so that it can be read again.
+func (v *SigV4Verifier) verify(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, sigV4Algorithm+" ") {
+		return false
+	}
+	p := parseParams(auth[len(sigV4Algorithm)+1:])
+
+	// Credential=<access key>/<date>/<region>/<service>/aws4_request
+	cred := strings.Split(p["credential"], "/")
+	if len(cred) != 5 || cred[4] != "aws4_request" {
+		return false
+	}
+	if (v.Region != "" && cred[2] != v.Region) || (v.Service != "" && cred[3] != v.Service) {
+		return false
+	}
+	secret, ok := v.Secrets.Secret(cred[0])
+	if !ok {
+		return false
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	t, err := time.Parse(sigV4TimeFormat, amzDate)
+	if err != nil || !strings.HasPrefix(amzDate, cred[1]) {
+		return false
+	}
+	if skew := time.Since(t); skew > v.MaxSkew || skew < -v.MaxSkew {
+		return false
+	}
+
+	signed := strings.Split(p["signedheaders"], ";")
+	if !containsString(signed, "host") {
+		return false
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != sigV4Unsigned || !v.AllowUnsignedPayload {
+		body, ok := readBody(r, v.MaxBody)
+		if !ok {
+			return false
+		}
+		h := sha256.Sum256(body)
+		digest := hex.EncodeToString(h[:])
+		if payloadHash != "" && payloadHash != digest {
+			return false
+		}
+		payloadHash = digest
+	}
+
+	scope := strings.Join(cred[1:], "/")
+	sig := sigV4Signature(secret, r, amzDate, scope, signed, payloadHash, !v.DisablePathEscaping)
+	return hmac.Equal([]byte(sig), []byte(p["signature"]))
+}
+
+// sigV4Signature returns the hex-encoded SigV4 signature of r, where scope is the
+// credential scope (<date>/<region>/<service>/aws4_request) and signed the lower-cased
+// names of the signed headers.
+func sigV4Signature(secret []byte, r *http.Request, amzDate, scope string, signed []string, payloadHash string, escapePath bool) string {
+	canonical := sigV4CanonicalRequest(r, signed, payloadHash, escapePath)
+	h := sha256.Sum256([]byte(canonical))
+	toSign := sigV4Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(h[:])
+
+	key := []byte("AWS4" + string(secret))
+	for _, x := range strings.Split(scope, "/") {
+		key = hmacSHA256(key, x)
+	}
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	io.WriteString(mac, data)
+	return mac.Sum(nil)
+}
+
+// sigV4CanonicalRequest returns the SigV4 canonical form of r.
+func sigV4CanonicalRequest(r *http.Request, signed []string, payloadHash string, escapePath bool) string {
+	path := r.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if escapePath {
+		path = sigV4Escape(path, false)
+	}
+
+	query := r.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var q []string
+	for _, k := range keys {
+		vals := append([]string(nil), query[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			q = append(q, sigV4Escape(k, true)+"="+sigV4Escape(v, true))
+		}
+	}
+
+	var hdrs bytes.Buffer
+	for _, name := range signed {
+		raw := r.Header[http.CanonicalHeaderKey(name)]
+		if name == "host" {
+			raw = []string{r.Host}
+			if r.Host == "" {
+				raw = []string{r.URL.Host}
+			}
+		}
+		vals := make([]string, len(raw))
+		for i, v := range raw {
+			vals[i] = strings.Join(strings.Fields(v), " ")
+		}
+		hdrs.WriteString(name + ":" + strings.Join(vals, ",") + "\n")
+	}
+
+	return r.Method + "\n" +
+		path + "\n" +
+		strings.Join(q, "&") + "\n" +
+		hdrs.String() + "\n" +
+		strings.Join(signed, ";") + "\n" +
+		payloadHash
+}
+
+// sigV4Escape URI-encodes s as required by SigV4, leaving only unreserved characters
+// (and '/' unless slash is true) unencoded.
+func sigV4Escape(s string, slash bool) string {
+	const hex = "0123456789ABCDEF"
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !slash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,134 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/dhowden/httpauth"
+)
+
+// get-vanilla from the AWS Signature Version 4 test suite.
+const sigV4Vanilla = "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+
+func TestSigV4Handler(t *testing.T) {
+	v := &SigV4Verifier{
+		Secrets: Secrets(map[string][]byte{
+			"AKIDEXAMPLE": []byte("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"),
+		}),
+		Region:  "us-east-1",
+		Service: "service",
+		MaxSkew: time.Since(time.Date(2015, 8, 30, 0, 0, 0, 0, time.UTC)) + time.Hour,
+	}
+
+	tests := []struct {
+		auth, path string
+		code       int
+	}{
+		{sigV4Vanilla, "/", http.StatusOK},
+		{sigV4Vanilla, "/other", http.StatusUnauthorized},
+		{sigV4Vanilla[:len(sigV4Vanilla)-1] + "0", "/", http.StatusUnauthorized},
+		{"", "/", http.StatusUnauthorized},
+	}
+
+	h := NewSigV4Handler(v, http.HandlerFunc(handlerFuncOK))
+	for ii, tt := range tests {
+		r, err := http.NewRequest("GET", "http://example.amazonaws.com"+tt.path, nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.Header.Set("X-Amz-Date", "20150830T123600Z")
+		r.Header.Set("Authorization", tt.auth)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("[%d] w.Code = %d, expected: %d", ii, w.Code, tt.code)
+		}
+	}
+
+	// Outside the permitted clock skew
+	v.MaxSkew = time.Hour
+	h = NewSigV4Handler(v, http.HandlerFunc(handlerFuncOK))
+	r, _ := http.NewRequest("GET", "http://example.amazonaws.com/", nil)
+	r.Header.Set("X-Amz-Date", "20150830T123600Z")
+	r.Header.Set("Authorization", sigV4Vanilla)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestSigV4Signer(t *testing.T) {
+	secret := "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	v := &SigV4Verifier{
+		Secrets: Secrets(map[string][]byte{"AKIDEXAMPLE": []byte(secret)}),
+		Region:  "us-east-1",
+		Service: "service",
+	}
+	h := NewSigV4Handler(v, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if string(b) != "hello" {
+			t.Errorf("body = %q, expected: %q", b, "hello")
+		}
+		handlerFuncOK(w, r)
+	}))
+
+	s := SigV4Signer{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: secret, Region: "us-east-1", Service: "service", SessionToken: "token"}
+	tests := []struct {
+		name string
+		s    SigV4Signer
+		body io.Reader
+		code int
+	}{
+		{"in-memory body", s, strings.NewReader("hello"), http.StatusOK},
+		{"streamed body", s, ioutil.NopCloser(strings.NewReader("hello")), http.StatusOK},
+		{"wrong region", SigV4Signer{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: secret, Region: "eu-west-1", Service: "service"}, strings.NewReader("hello"), http.StatusUnauthorized},
+		{"wrong secret", SigV4Signer{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wrong", Region: "us-east-1", Service: "service"}, strings.NewReader("hello"), http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		r, err := http.NewRequest("POST", "http://example.amazonaws.com/a b?x=1&a=2", tt.body)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		r.Header.Set("Content-Type", "text/plain")
+		if err := tt.s.Sign(r); err != nil {
+			t.Fatalf("%s: Sign() returned unexpected error: %v", tt.name, err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s: w.Code = %d, expected: %d", tt.name, w.Code, tt.code)
+		}
+	}
+
+	// Unsigned payload
+	s.UnsignedPayload = true
+	r, _ := http.NewRequest("POST", "http://example.amazonaws.com/", strings.NewReader("hello"))
+	s.Sign(r)
+	if got := r.Header.Get("X-Amz-Content-Sha256"); got != "UNSIGNED-PAYLOAD" {
+		t.Errorf("X-Amz-Content-Sha256 = %q, expected: %q", got, "UNSIGNED-PAYLOAD")
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("unsigned payload: w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+	v.AllowUnsignedPayload = true
+	h = NewSigV4Handler(v, http.HandlerFunc(handlerFuncOK))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("unsigned payload allowed: w.Code = %d, expected: %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tarpitWindow is the time after the last failure at which a failure count is reset.
+const tarpitWindow = 15 * time.Minute
+
+// maxTarpitEntries is the maximum number of client IP addresses and usernames whose
+// failures are tracked.
+const maxTarpitEntries = 100000
+
+// Tarpit configures the handler to delay responses to failed requests from a client IP
+// address or for a username which has recently failed, starting at base and doubling
+// for each consecutive failure up to max.  A successful request resets the delay.  At
+// most 100000 IP addresses and usernames are tracked: while that many have failed
+// recently, failures from others are delayed by max.
+func Tarpit(base, max time.Duration) Option {
+	return func(h *handler) {
+		h.tarpit = &tarpit{
+			base: base,
+			max:  max,
+			m:    make(map[string]*tarpitEntry),
+		}
+	}
+}
+
+type tarpit struct {
+	base, max time.Duration
+
+	mu    sync.Mutex
+	m     map[string]*tarpitEntry
+	swept time.Time
+}
+
+type tarpitEntry struct {
+	failures int
+	last     time.Time
+}
+
+// tarpitKeys returns the keys used to track failures from the client IP address for
+// username.
+func tarpitKeys(ip, username string) []string {
+	keys := []string{"ip:" + ip}
+	if username != "" {
+		keys = append(keys, "user:"+username)
+	}
+	return keys
+}
+
+// fail records a failure for the keys and returns the delay to apply.
+func (t *tarpit) fail(keys []string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(t.swept) > time.Minute {
+		for k, e := range t.m {
+			if now.Sub(e.last) > tarpitWindow {
+				delete(t.m, k)
+			}
+		}
+		t.swept = now
+	}
+
+	var d time.Duration
+	for _, k := range keys {
+		e, ok := t.m[k]
+		if ok && now.Sub(e.last) > tarpitWindow {
+			e.failures = 0
+		}
+		if !ok {
+			if len(t.m) >= maxTarpitEntries {
+				d = t.max
+				continue
+			}
+			e = &tarpitEntry{}
+			t.m[k] = e
+		}
+		e.failures++
+		e.last = now
+		if x := t.delay(e.failures); x > d {
+			d = x
+		}
+	}
+	return d
+}
+
+// delay returns the delay after n consecutive failures.
+func (t *tarpit) delay(n int) time.Duration {
+	d := t.base
+	for i := 1; i < n && d < t.max; i++ {
+		d *= 2
+	}
+	if d > t.max {
+		d = t.max
+	}
+	return d
+}
+
+// reset clears the failures for the keys.
+func (t *tarpit) reset(keys []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, k := range keys {
+		delete(t.m, k)
+	}
+}
+
+// wait sleeps for d, or until the request is cancelled.
+func wait(r *http.Request, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-r.Context().Done():
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"net/http"
+	"time"
+)
+
+// Default lifetimes of tokens issued by a TokenIssuer.
+const (
+	DefaultTokenTTL        = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// TokenIssuer mints signed JWT access tokens, which can be validated using JWT with the
+// corresponding KeySource.
+type TokenIssuer struct {
+	// Key is the signing key: []byte for HS256, or *rsa.PrivateKey for RS256.
+	Key interface{}
+
+	// KeyID, if non-empty, is set as the kid header of issued tokens.
+	KeyID string
+
+	// KeyRing, if non-nil, provides the signing key and key ID instead of Key and
+	// KeyID, so that the signing key can be rotated.
+	KeyRing *KeyRing
+
+	// Issuer, if non-empty, is set as the iss claim.
+	Issuer string
+
+	// Audience, if non-empty, is set as the aud claim.
+	Audience string
+
+	// TTL is the lifetime of issued tokens.  Defaults to DefaultTokenTTL.
+	TTL time.Duration
+
+	// Claims, if non-nil, is called to add claims to the token issued for the user.
+	// The sub, iat, exp, iss and aud claims are always set by the TokenIssuer.
+	Claims func(username string) Claims
+
+	// Refresh, if non-nil, stores refresh tokens, which are issued alongside access
+	// tokens and can be exchanged for new ones (see NewRefreshHandler).
+	Refresh TokenStore
+
+	// RefreshTTL is the lifetime of refresh tokens.  Defaults to DefaultRefreshTokenTTL.
+	RefreshTTL time.Duration
+}
+
+func (i *TokenIssuer) ttl() time.Duration {
+	if i.TTL == 0 {
+		return DefaultTokenTTL
+	}
+	return i.TTL
+}
+
+func (i *TokenIssuer) refreshTTL() time.Duration {
+	if i.RefreshTTL == 0 {
+		return DefaultRefreshTokenTTL
+	}
+	return i.RefreshTTL
+}
+
+// Issue returns a new access token for the username.
+func (i *TokenIssuer) Issue(username string) (string, error) {
+	claims := Claims{}
+	if i.Claims != nil {
+		for k, v := range i.Claims(username) {
+			claims[k] = v
+		}
+	}
+	now := time.Now()
+	claims["sub"] = username
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(i.ttl()).Unix()
+	if i.Issuer != "" {
+		claims["iss"] = i.Issuer
+	}
+	if i.Audience != "" {
+		claims["aud"] = i.Audience
+	}
+	if i.KeyRing != nil {
+		kid, key := i.KeyRing.signingKey()
+		return signJWT(key, kid, claims)
+	}
+	return signJWT(i.Key, i.KeyID, claims)
+}
+
+// IssueRefresh returns a new refresh token for the username.
+func (i *TokenIssuer) IssueRefresh(username string) (string, error) {
+	token, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	if err := i.Refresh.Add(HashKey(token), username, time.Now().Add(i.refreshTTL())); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Revoke revokes the refresh token.
+func (i *TokenIssuer) Revoke(refreshToken string) {
+	i.Refresh.Redeem(HashKey(refreshToken))
+}
+
+// RevokeUser revokes all refresh tokens issued to the username.  Access tokens already
+// issued remain valid until they expire, so should be short-lived.
+func (i *TokenIssuer) RevokeUser(username string) error {
+	return i.Refresh.DeleteUser(username)
+}
+
+// writeTokens responds with new tokens for the username.
+func (i *TokenIssuer) writeTokens(w http.ResponseWriter, r *http.Request, username string) {
+	token, err := i.Issue(username)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError)
+		return
+	}
+	var refresh string
+	if i.Refresh != nil {
+		if refresh, err = i.IssueRefresh(username); err != nil {
+			writeError(w, r, http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, tokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(i.ttl() / time.Second),
+		RefreshToken: refresh,
+	})
+}
+
+// tokenResponse is the body of a successful token response (RFC 6749 section 5.1).
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// NewTokenHandler returns an http.Handler which accepts POST requests with basic HTTP
+// authentication credentials, checks them using the Checker and responds with a JSON
+// access token issued by i, in the format of an OAuth 2.0 token response:
+//
+//	{"access_token":"eyJ...","token_type":"Bearer","expires_in":900}
+//
+// Clients can then authenticate later requests using the token (see NewBearerHandler)
+// rather than sending their credentials each time.  If i has a Refresh store then a
+// refresh_token is also included.
+func NewTokenHandler(c Checker, i *TokenIssuer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			writeError(w, r, http.StatusMethodNotAllowed)
+			return
+		}
+		username, password, ok := r.BasicAuth()
+		if !c.Check(username, password) || !ok {
+			unauthorized(w, r, "Basic")
+			return
+		}
+		i.writeTokens(w, r, username)
+	})
+}
+
+// NewRefreshHandler returns an http.Handler (e.g. for "/token/refresh") which accepts
+// POST requests with a "refresh_token" form value, and responds as NewTokenHandler with
+// a new access token and a new refresh token.  Refresh tokens are rotated: each can be
+// used only once.  Invalid, expired and revoked refresh tokens receive
+// http.StatusUnauthorized.
+func NewRefreshHandler(i *TokenIssuer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			writeError(w, r, http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.PostFormValue("refresh_token")
+		if token == "" {
+			unauthorized(w, r, "")
+			return
+		}
+		username, ok := i.Refresh.Redeem(HashKey(token))
+		if !ok {
+			unauthorized(w, r, "")
+			return
+		}
+		i.writeTokens(w, r, username)
+	})
+}
@@ -0,0 +1,108 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ReadTokenFile reads a token written by WriteTokenFile.
+func ReadTokenFile(path string) (*Token, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &Token{}
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// WriteTokenFile writes the token to the file at path as JSON, readable only by the
+// current user, creating the parent directory if necessary.  The file is replaced
+// atomically, so concurrent readers see either the old or the new token.
+func WriteTokenFile(path string, t *Token) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b, 0600)
+}
+
+// writeFileAtomic writes b to a temporary file with the mode in the directory of path,
+// and renames it to path.
+func writeFileAtomic(path string, b []byte, mode os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	// TempFile creates files with mode 0600.
+	if mode != 0600 {
+		if err := os.Chmod(f.Name(), mode); err != nil {
+			os.Remove(f.Name())
+			return err
+		}
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// FileTokenSource creates a TokenSource which caches tokens from ts in the file at path
+// (see WriteTokenFile), so that short-lived processes such as CLI commands reuse a valid
+// token from an earlier run rather than authenticating each time.  The file is read
+// when a new token is needed, and only if it has no valid token is ts called, and its
+// token written to the file.  Errors writing the file are ignored, so that a read-only
+// or missing cache directory does not prevent requests.
+//
+// To keep refresh tokens across runs with OAuthConfig, create ts with the token read
+// from the file: FileTokenSource(path, c.TokenSource(t)).
+func FileTokenSource(path string, ts TokenSource) TokenSource {
+	return ReuseTokenSource(fileTokenSource{path: path, ts: ts})
+}
+
+type fileTokenSource struct {
+	path string
+	ts   TokenSource
+}
+
+// Token implements TokenSource.
+func (s fileTokenSource) Token() (*Token, error) {
+	return s.TokenContext(context.Background())
+}
+
+// TokenContext implements ContextTokenSource.
+func (s fileTokenSource) TokenContext(ctx context.Context) (*Token, error) {
+	if t, err := ReadTokenFile(s.path); err == nil && t.Valid() {
+		return t, nil
+	}
+	t, err := tokenContext(ctx, s.ts)
+	if err != nil {
+		return nil, err
+	}
+	if t.Valid() {
+		WriteTokenFile(s.path, t)
+	}
+	return t, nil
+}
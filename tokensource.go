@@ -0,0 +1,235 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tokenExpiryDelta is how long before its expiry a Token is considered expired, so that
+// it is not used for requests which would arrive after it has expired.
+const tokenExpiryDelta = 10 * time.Second
+
+// Token is an access token obtained by a client.
+type Token struct {
+	// AccessToken is the token sent with requests.
+	AccessToken string `json:"access_token"`
+
+	// TokenType is the type of the token (the Authorization scheme).  Defaults to
+	// "Bearer".
+	TokenType string `json:"token_type,omitempty"`
+
+	// RefreshToken, if set, can be used to obtain a new access token.
+	RefreshToken string `json:"refresh_token,omitempty"`
+
+	// Expiry is the time at which the access token expires.  If zero then the token
+	// does not expire.
+	Expiry time.Time `json:"expiry"`
+}
+
+// Valid returns true if t has an access token which has not expired (or is not about
+// to).
+func (t *Token) Valid() bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Now().Add(tokenExpiryDelta).Before(t.Expiry)
+}
+
+func (t *Token) tokenType() string {
+	if t.TokenType == "" {
+		return "Bearer"
+	}
+	return t.TokenType
+}
+
+// ErrNoToken is returned when a TokenSource provides no valid token.
+var ErrNoToken = errors.New("httpauth: no valid token")
+
+// TokenSource defines the Token method which provides access tokens to clients.
+type TokenSource interface {
+	// Token returns a token, or an error if a token could not be obtained.
+	Token() (*Token, error)
+}
+
+// ContextTokenSource is a TokenSource which can be passed a context, so that requests
+// made to obtain tokens are cancelled when ctx is done.
+type ContextTokenSource interface {
+	TokenSource
+
+	// TokenContext is like Token, but uses ctx for any requests it makes.
+	TokenContext(ctx context.Context) (*Token, error)
+}
+
+// tokenContext returns a token from ts, calling TokenContext with ctx if ts is a
+// ContextTokenSource.
+func tokenContext(ctx context.Context, ts TokenSource) (*Token, error) {
+	if cts, ok := ts.(ContextTokenSource); ok {
+		return cts.TokenContext(ctx)
+	}
+	return ts.Token()
+}
+
+// StaticTokenSource creates a TokenSource which always returns t.
+func StaticTokenSource(t *Token) TokenSource {
+	return staticTokenSource{t}
+}
+
+type staticTokenSource struct {
+	t *Token
+}
+
+// Token implements TokenSource.
+func (s staticTokenSource) Token() (*Token, error) {
+	return s.t, nil
+}
+
+// ReuseTokenSource creates a TokenSource which returns the token from ts until it
+// expires, and only then calls ts for a new one.  It is safe for concurrent use:
+// callers which need a new token while ts is already being called wait for its result,
+// so ts is called once however many goroutines share the TokenSource.  Waiting callers
+// of TokenContext return early if their context is done.
+func ReuseTokenSource(ts TokenSource) TokenSource {
+	if rs, ok := ts.(*reuseTokenSource); ok {
+		return rs
+	}
+	return &reuseTokenSource{ts: ts}
+}
+
+// RefreshAheadTokenSource creates a TokenSource which, like ReuseTokenSource, reuses the
+// token from ts, but calls ts in the background for a new token once the current one
+// is within margin of its expiry, so that requests don't wait for tokens to be
+// refreshed.  The refresh time is brought forward by a random jitter of up to a fifth
+// of margin, so that processes which started together don't refresh together.  If a
+// background refresh fails then it is tried again after half the remaining lifetime
+// of the current token, which is used until it expires.
+func RefreshAheadTokenSource(ts TokenSource, margin time.Duration) TokenSource {
+	return &reuseTokenSource{ts: ts, margin: margin}
+}
+
+type reuseTokenSource struct {
+	ts     TokenSource
+	margin time.Duration // how long before expiry to refresh in the background, if > 0
+
+	mu        sync.Mutex
+	t         *Token
+	refreshAt time.Time   // when to start a background refresh, if margin > 0
+	fetch     *tokenFetch // in-flight call to ts, if any
+}
+
+// tokenFetch is a call to a TokenSource shared by concurrent callers, whose result is
+// set before done is closed.
+type tokenFetch struct {
+	done chan struct{}
+	t    *Token
+	err  error
+}
+
+// Token implements TokenSource.
+func (s *reuseTokenSource) Token() (*Token, error) {
+	return s.TokenContext(context.Background())
+}
+
+// TokenContext implements ContextTokenSource.
+func (s *reuseTokenSource) TokenContext(ctx context.Context) (*Token, error) {
+	for {
+		s.mu.Lock()
+		if s.t.Valid() {
+			t := s.t
+			if s.margin > 0 && s.fetch == nil && !s.refreshAt.IsZero() && !time.Now().Before(s.refreshAt) {
+				f := &tokenFetch{done: make(chan struct{})}
+				s.fetch = f
+				go s.run(context.Background(), f)
+			}
+			s.mu.Unlock()
+			return t, nil
+		}
+		f := s.fetch
+		if f == nil {
+			f = &tokenFetch{done: make(chan struct{})}
+			s.fetch = f
+			s.mu.Unlock()
+			s.run(ctx, f)
+			return f.t, f.err
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-f.done:
+		}
+		if f.err != nil && ctx.Err() == nil && (errors.Is(f.err, context.Canceled) || errors.Is(f.err, context.DeadlineExceeded)) {
+			// The caller making the request gave up, but this one hasn't.
+			continue
+		}
+		return f.t, f.err
+	}
+}
+
+// run calls ts for the fetch f, storing a new token for reuse.
+func (s *reuseTokenSource) run(ctx context.Context, f *tokenFetch) {
+	f.t, f.err = s.newToken(ctx)
+
+	s.mu.Lock()
+	switch {
+	case f.err == nil:
+		s.t = f.t
+		s.refreshAt = time.Time{}
+		if s.margin > 0 && !f.t.Expiry.IsZero() {
+			jitter := time.Duration(rand.Int63n(int64(s.margin/5) + 1))
+			s.refreshAt = f.t.Expiry.Add(-s.margin - jitter)
+		}
+	case s.t.Valid():
+		// A background refresh failed: try again later.
+		s.refreshAt = time.Now().Add(time.Until(s.t.Expiry) / 2)
+	}
+	s.fetch = nil
+	s.mu.Unlock()
+	close(f.done)
+}
+
+// newToken calls ts for a new token, returning ErrNoToken if it has expired.
+func (s *reuseTokenSource) newToken(ctx context.Context) (*Token, error) {
+	t, err := tokenContext(ctx, s.ts)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || t.AccessToken == "" || (!t.Expiry.IsZero() && !time.Now().Before(t.Expiry)) {
+		return nil, ErrNoToken
+	}
+	return t, nil
+}
+
+// TokenSourceSigner creates a Signer which adds the current token from ts to the
+// Authorization header of each request.  Tokens are reused until they expire (see
+// ReuseTokenSource), so ts is only called when a new token is needed.
+func TokenSourceSigner(ts TokenSource) Signer {
+	return tokenSourceSigner{ReuseTokenSource(ts)}
+}
+
+type tokenSourceSigner struct {
+	ts TokenSource
+}
+
+// Sign implements Signer.
+func (s tokenSourceSigner) Sign(r *http.Request) error {
+	return s.SignContext(r.Context(), r)
+}
+
+// SignContext implements ContextSigner.
+func (s tokenSourceSigner) SignContext(ctx context.Context, r *http.Request) error {
+	t, err := tokenContext(ctx, s.ts)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Authorization", t.tokenType()+" "+t.AccessToken)
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"context"
+	"net/http"
+)
+
+// Tracer defines the Start method used to trace authentication checks.  It is
+// deliberately small so that tracing libraries (e.g. OpenTelemetry) can be plugged in
+// with a simple adapter rather than this package depending on them.
+type Tracer interface {
+	// Start begins a span with the given name as a child of any span in ctx.
+	Start(ctx context.Context, name string) Span
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttribute records an attribute on the span.
+	SetAttribute(key string, value interface{})
+
+	// End completes the span.
+	End()
+}
+
+// Span attribute keys set by handlers configured with Trace.
+const (
+	TraceAttrScheme  = "httpauth.scheme"
+	TraceAttrOutcome = "httpauth.outcome"
+)
+
+// Trace configures the handler to record a span named "httpauth.check" around each
+// credential check, with the authentication scheme and outcome ("success" or
+// "failure") as attributes.
+func Trace(t Tracer) Option {
+	return func(h *handler) {
+		h.tracer = t
+	}
+}
+
+// startSpan starts a span for a credential check of r, returning a function which ends
+// the span with the outcome.  If tracing is disabled the returned function does nothing.
+func (h *handler) startSpan(r *http.Request) func(ok bool) {
+	if h.tracer == nil {
+		return func(bool) {}
+	}
+	span := h.tracer.Start(r.Context(), "httpauth.check")
+	scheme := "basic"
+	if h.cc != nil && peerCert(r) != nil {
+		scheme = "certificate"
+	}
+	span.SetAttribute(TraceAttrScheme, scheme)
+	return func(ok bool) {
+		outcome := "failure"
+		if ok {
+			outcome = "success"
+		}
+		span.SetAttribute(TraceAttrOutcome, outcome)
+		span.End()
+	}
+}
@@ -0,0 +1,695 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Errors returned when verifying WebAuthn responses.
+var (
+	ErrWebAuthnMalformed      = errors.New("httpauth: malformed WebAuthn response")
+	ErrWebAuthnChallenge      = errors.New("httpauth: unknown or expired WebAuthn challenge")
+	ErrWebAuthnOrigin         = errors.New("httpauth: invalid WebAuthn origin")
+	ErrWebAuthnRelyingParty   = errors.New("httpauth: invalid WebAuthn relying party")
+	ErrWebAuthnUserPresence   = errors.New("httpauth: WebAuthn user presence not verified")
+	ErrWebAuthnCredential     = errors.New("httpauth: unknown WebAuthn credential")
+	ErrWebAuthnSignature      = errors.New("httpauth: invalid WebAuthn signature")
+	ErrWebAuthnSignCount      = errors.New("httpauth: WebAuthn signature counter did not increase")
+	ErrWebAuthnUnsupportedKey = errors.New("httpauth: unsupported WebAuthn public key")
+)
+
+// COSE algorithm identifiers supported for WebAuthn credentials.
+const (
+	coseES256 = -7
+	coseRS256 = -257
+)
+
+// Authenticator data flags.
+const (
+	authDataUserPresent  = 0x01
+	authDataAttestedData = 0x40
+)
+
+// DefaultWebAuthnTimeout is the default time allowed to complete a WebAuthn ceremony.
+const DefaultWebAuthnTimeout = 5 * time.Minute
+
+// WebAuthnCredential is a public key credential (passkey) registered to a user.
+type WebAuthnCredential struct {
+	// ID is the credential ID chosen by the authenticator.
+	ID []byte
+
+	// Username is the user the credential was registered to.
+	Username string
+
+	// UserHandle is the opaque user handle (WebAuthn user.id) given to the
+	// authenticator.  It is chosen at random when a user registers their first
+	// credential, so that usernames are not revealed to authenticators.
+	UserHandle []byte
+
+	// PublicKey is the credential public key, as a COSE_Key.
+	PublicKey []byte
+
+	// SignCount is the last signature counter value reported by the authenticator.
+	SignCount uint32
+}
+
+// WebAuthnStore defines methods for storing WebAuthn credentials.
+type WebAuthnStore interface {
+	// Add stores a newly registered credential.
+	Add(c WebAuthnCredential) error
+
+	// Get returns the credential with the ID.
+	Get(id []byte) (WebAuthnCredential, bool)
+
+	// List returns the credentials registered to the user.
+	List(username string) []WebAuthnCredential
+
+	// UpdateSignCount records the latest signature counter value for the credential.
+	UpdateSignCount(id []byte, n uint32) error
+}
+
+// NewMemoryWebAuthnStore creates a WebAuthnStore which keeps credentials in memory.
+func NewMemoryWebAuthnStore() WebAuthnStore {
+	return &memoryWebAuthnStore{
+		m: make(map[string]WebAuthnCredential),
+	}
+}
+
+type memoryWebAuthnStore struct {
+	mu sync.RWMutex
+	m  map[string]WebAuthnCredential
+}
+
+// Add implements WebAuthnStore.
+func (s *memoryWebAuthnStore) Add(c WebAuthnCredential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.m[string(c.ID)] = c
+	return nil
+}
+
+// Get implements WebAuthnStore.
+func (s *memoryWebAuthnStore) Get(id []byte) (WebAuthnCredential, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.m[string(id)]
+	return c, ok
+}
+
+// List implements WebAuthnStore.
+func (s *memoryWebAuthnStore) List(username string) []WebAuthnCredential {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var l []WebAuthnCredential
+	for _, c := range s.m {
+		if c.Username == username {
+			l = append(l, c)
+		}
+	}
+	return l
+}
+
+// UpdateSignCount implements WebAuthnStore.
+func (s *memoryWebAuthnStore) UpdateSignCount(id []byte, n uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.m[string(id)]
+	if !ok {
+		return ErrWebAuthnCredential
+	}
+	c.SignCount = n
+	s.m[string(id)] = c
+	return nil
+}
+
+// WebAuthn implements the relying party side of WebAuthn registration and authentication
+// ceremonies, so that browser-facing services can offer passkeys as an alternative to
+// passwords.  Its methods are http.HandlerFuncs exchanging JSON in the format used by
+// PublicKeyCredential.parseCreationOptionsFromJSON, parseRequestOptionsFromJSON and
+// toJSON in the browser, with binary values base64url-encoded.
+//
+// Registration requires an authenticated user (see UserFromContext, or a session cookie
+// from Sessions), so BeginRegistration and FinishRegistration should be wrapped with
+// NewHandler or RequireSession.  A successful login issues a session cookie using
+// Sessions.  Attestation statements are not verified ("none" attestation is requested).
+// At most 10000 ceremonies can be in progress at once: beyond that, BeginRegistration and
+// BeginLogin respond with http.StatusServiceUnavailable.
+type WebAuthn struct {
+	// RPID is the relying party ID, usually the domain of the site (e.g. "example.com").
+	RPID string
+
+	// RPName is the human-readable name of the relying party.
+	RPName string
+
+	// Origin is the origin of the site (e.g. "https://example.com").
+	Origin string
+
+	// Store holds the registered credentials.
+	Store WebAuthnStore
+
+	// Sessions issues session cookies on successful login.  Required by FinishLogin,
+	// which responds with http.StatusInternalServerError if it is nil.
+	Sessions *Sessions
+
+	// Timeout is the time allowed to complete a ceremony.  Defaults to
+	// DefaultWebAuthnTimeout if zero.
+	Timeout time.Duration
+
+	mu         sync.Mutex
+	challenges map[string]webAuthnChallenge
+	swept      time.Time
+}
+
+// maxWebAuthnChallenges is the maximum number of outstanding challenges.
+const maxWebAuthnChallenges = 10000
+
+// errWebAuthnChallenges is returned by newChallenge when there are too many outstanding
+// challenges.
+var errWebAuthnChallenges = errors.New("httpauth: too many WebAuthn challenges")
+
+type webAuthnChallenge struct {
+	username   string
+	userHandle []byte // for registration
+	register   bool
+	expires    time.Time
+}
+
+func (a *WebAuthn) timeout() time.Duration {
+	if a.Timeout == 0 {
+		return DefaultWebAuthnTimeout
+	}
+	return a.Timeout
+}
+
+// newChallenge creates and records a challenge for a ceremony.  The userHandle is only
+// used for registration.
+func (a *WebAuthn) newChallenge(username string, userHandle []byte, register bool) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(b)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if a.challenges == nil {
+		a.challenges = make(map[string]webAuthnChallenge)
+	}
+	if now.Sub(a.swept) > time.Minute || len(a.challenges) >= maxWebAuthnChallenges {
+		for k, c := range a.challenges {
+			if !now.Before(c.expires) {
+				delete(a.challenges, k)
+			}
+		}
+		a.swept = now
+	}
+	if len(a.challenges) >= maxWebAuthnChallenges {
+		return "", errWebAuthnChallenges
+	}
+	a.challenges[challenge] = webAuthnChallenge{
+		username:   username,
+		userHandle: userHandle,
+		register:   register,
+		expires:    now.Add(a.timeout()),
+	}
+	return challenge, nil
+}
+
+// writeChallengeError responds to a request for which newChallenge returned err.
+func writeChallengeError(w http.ResponseWriter, r *http.Request, err error) {
+	if err == errWebAuthnChallenges {
+		writeError(w, r, http.StatusServiceUnavailable)
+		return
+	}
+	writeError(w, r, http.StatusInternalServerError)
+}
+
+// takeChallenge removes the challenge, returning it if it was valid for the ceremony.
+func (a *WebAuthn) takeChallenge(challenge string, register bool) (webAuthnChallenge, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	c, ok := a.challenges[challenge]
+	delete(a.challenges, challenge)
+	if !ok || c.register != register || !time.Now().Before(c.expires) {
+		return webAuthnChallenge{}, false
+	}
+	return c, true
+}
+
+// user returns the authenticated user of r.
+func (a *WebAuthn) user(r *http.Request) (string, bool) {
+	if username, ok := UserFromContext(r.Context()); ok {
+		return username, true
+	}
+	if a.Sessions != nil {
+		return a.Sessions.User(r)
+	}
+	return "", false
+}
+
+// userHandle returns the user handle of the user's registered credentials, or a new
+// random handle if there are none.
+func (a *WebAuthn) userHandle(username string) ([]byte, error) {
+	for _, c := range a.Store.List(username) {
+		if len(c.UserHandle) > 0 {
+			return c.UserHandle, nil
+		}
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+type webAuthnCredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// descriptors returns the descriptors of the credentials registered to the user.
+func (a *WebAuthn) descriptors(username string) []webAuthnCredentialDescriptor {
+	l := []webAuthnCredentialDescriptor{}
+	if username == "" {
+		return l
+	}
+	for _, c := range a.Store.List(username) {
+		l = append(l, webAuthnCredentialDescriptor{"public-key", base64.RawURLEncoding.EncodeToString(c.ID)})
+	}
+	return l
+}
+
+// BeginRegistration responds with the options for creating a new credential for the
+// authenticated user.
+func (a *WebAuthn) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	username, ok := a.user(r)
+	if !ok {
+		unauthorized(w, r, "")
+		return
+	}
+	handle, err := a.userHandle(username)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError)
+		return
+	}
+	challenge, err := a.newChallenge(username, handle, true)
+	if err != nil {
+		writeChallengeError(w, r, err)
+		return
+	}
+
+	type entity struct {
+		ID          string `json:"id,omitempty"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName,omitempty"`
+	}
+	type param struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	}
+	writeJSON(w, struct {
+		RP                     entity                         `json:"rp"`
+		User                   entity                         `json:"user"`
+		Challenge              string                         `json:"challenge"`
+		PubKeyCredParams       []param                        `json:"pubKeyCredParams"`
+		Timeout                int64                          `json:"timeout"`
+		ExcludeCredentials     []webAuthnCredentialDescriptor `json:"excludeCredentials"`
+		AuthenticatorSelection map[string]string              `json:"authenticatorSelection"`
+		Attestation            string                         `json:"attestation"`
+	}{
+		RP:                 entity{ID: a.RPID, Name: a.RPName},
+		User:               entity{ID: base64.RawURLEncoding.EncodeToString(handle), Name: username, DisplayName: username},
+		Challenge:          challenge,
+		PubKeyCredParams:   []param{{"public-key", coseES256}, {"public-key", coseRS256}},
+		Timeout:            a.timeout().Milliseconds(),
+		ExcludeCredentials: a.descriptors(username),
+		AuthenticatorSelection: map[string]string{
+			"residentKey":      "preferred",
+			"userVerification": "preferred",
+		},
+		Attestation: "none",
+	})
+}
+
+// webAuthnResponse is the JSON encoding of a PublicKeyCredential.
+type webAuthnResponse struct {
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// FinishRegistration verifies a newly created credential for the authenticated user and
+// adds it to the Store, responding with http.StatusCreated.
+func (a *WebAuthn) FinishRegistration(w http.ResponseWriter, r *http.Request) {
+	username, ok := a.user(r)
+	if !ok {
+		unauthorized(w, r, "")
+		return
+	}
+	var resp webAuthnResponse
+	if err := readJSON(w, r, &resp); err != nil {
+		writeError(w, r, http.StatusBadRequest)
+		return
+	}
+	c, err := a.verifyRegistration(username, &resp)
+	if err != nil {
+		if err == ErrWebAuthnMalformed {
+			writeError(w, r, http.StatusBadRequest)
+			return
+		}
+		unauthorized(w, r, "")
+		return
+	}
+	if err := a.Store.Add(c); err != nil {
+		writeError(w, r, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// verifyRegistration verifies the registration response for the user, returning the new
+// credential.
+func (a *WebAuthn) verifyRegistration(username string, resp *webAuthnResponse) (WebAuthnCredential, error) {
+	clientData, err := base64.RawURLEncoding.DecodeString(resp.Response.ClientDataJSON)
+	if err != nil {
+		return WebAuthnCredential{}, ErrWebAuthnMalformed
+	}
+	ch, err := a.verifyClientData(clientData, "webauthn.create")
+	if err != nil {
+		return WebAuthnCredential{}, err
+	}
+	if ch.username != username {
+		return WebAuthnCredential{}, ErrWebAuthnChallenge
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(resp.Response.AttestationObject)
+	if err != nil {
+		return WebAuthnCredential{}, ErrWebAuthnMalformed
+	}
+	v, _, err := decodeCBOR(b)
+	if err != nil {
+		return WebAuthnCredential{}, ErrWebAuthnMalformed
+	}
+	att, _ := v.(map[interface{}]interface{})
+	authData, ok := att["authData"].([]byte)
+	if !ok {
+		return WebAuthnCredential{}, ErrWebAuthnMalformed
+	}
+
+	ad, err := a.parseAuthData(authData)
+	if err != nil {
+		return WebAuthnCredential{}, err
+	}
+	if ad.credentialID == nil {
+		return WebAuthnCredential{}, ErrWebAuthnMalformed
+	}
+	if id, err := base64.RawURLEncoding.DecodeString(resp.RawID); err != nil || !bytes.Equal(id, ad.credentialID) {
+		return WebAuthnCredential{}, ErrWebAuthnMalformed
+	}
+	if _, _, err := parseCOSEKey(ad.publicKey); err != nil {
+		return WebAuthnCredential{}, err
+	}
+	if _, exists := a.Store.Get(ad.credentialID); exists {
+		return WebAuthnCredential{}, ErrWebAuthnCredential
+	}
+	return WebAuthnCredential{
+		ID:         ad.credentialID,
+		Username:   username,
+		UserHandle: ch.userHandle,
+		PublicKey:  ad.publicKey,
+		SignCount:  ad.signCount,
+	}, nil
+}
+
+// BeginLogin responds with the options for authenticating using a credential.  If the
+// "username" form value is set then only that user's credentials are allowed, otherwise
+// the authenticator may offer any discoverable credential for the site.
+func (a *WebAuthn) BeginLogin(w http.ResponseWriter, r *http.Request) {
+	username := r.FormValue("username")
+	challenge, err := a.newChallenge(username, nil, false)
+	if err != nil {
+		writeChallengeError(w, r, err)
+		return
+	}
+	writeJSON(w, struct {
+		Challenge        string                         `json:"challenge"`
+		Timeout          int64                          `json:"timeout"`
+		RPID             string                         `json:"rpId"`
+		AllowCredentials []webAuthnCredentialDescriptor `json:"allowCredentials"`
+		UserVerification string                         `json:"userVerification"`
+	}{
+		Challenge:        challenge,
+		Timeout:          a.timeout().Milliseconds(),
+		RPID:             a.RPID,
+		AllowCredentials: a.descriptors(username),
+		UserVerification: "preferred",
+	})
+}
+
+// FinishLogin verifies an assertion and issues a session cookie for the user the
+// credential is registered to, responding with http.StatusNoContent.
+func (a *WebAuthn) FinishLogin(w http.ResponseWriter, r *http.Request) {
+	if a.Sessions == nil {
+		writeError(w, r, http.StatusInternalServerError)
+		return
+	}
+	var resp webAuthnResponse
+	if err := readJSON(w, r, &resp); err != nil {
+		writeError(w, r, http.StatusBadRequest)
+		return
+	}
+	username, err := a.verifyLogin(&resp)
+	if err != nil {
+		if err == ErrWebAuthnMalformed {
+			writeError(w, r, http.StatusBadRequest)
+			return
+		}
+		unauthorized(w, r, "")
+		return
+	}
+	if err := a.Sessions.Issue(w, r, username); err != nil {
+		writeError(w, r, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// verifyLogin verifies the assertion response, returning the username the credential is
+// registered to.
+func (a *WebAuthn) verifyLogin(resp *webAuthnResponse) (string, error) {
+	id, err := base64.RawURLEncoding.DecodeString(resp.RawID)
+	if err != nil {
+		return "", ErrWebAuthnMalformed
+	}
+	clientData, err := base64.RawURLEncoding.DecodeString(resp.Response.ClientDataJSON)
+	if err != nil {
+		return "", ErrWebAuthnMalformed
+	}
+	authData, err := base64.RawURLEncoding.DecodeString(resp.Response.AuthenticatorData)
+	if err != nil {
+		return "", ErrWebAuthnMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(resp.Response.Signature)
+	if err != nil {
+		return "", ErrWebAuthnMalformed
+	}
+
+	ch, err := a.verifyClientData(clientData, "webauthn.get")
+	if err != nil {
+		return "", err
+	}
+	c, ok := a.Store.Get(id)
+	if !ok || (ch.username != "" && ch.username != c.Username) {
+		return "", ErrWebAuthnCredential
+	}
+	if resp.Response.UserHandle != "" {
+		handle, err := base64.RawURLEncoding.DecodeString(resp.Response.UserHandle)
+		if err != nil {
+			return "", ErrWebAuthnMalformed
+		}
+		if !bytes.Equal(handle, c.UserHandle) {
+			return "", ErrWebAuthnCredential
+		}
+	}
+
+	ad, err := a.parseAuthData(authData)
+	if err != nil {
+		return "", err
+	}
+	alg, pub, err := parseCOSEKey(c.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(clientData)
+	if err := verifyCOSESignature(alg, pub, append(authData[:len(authData):len(authData)], h[:]...), sig); err != nil {
+		return "", err
+	}
+
+	// A counter which fails to increase suggests that the authenticator has been
+	// cloned.  Authenticators which do not implement counters always report zero.
+	if ad.signCount != 0 || c.SignCount != 0 {
+		if ad.signCount <= c.SignCount {
+			return "", ErrWebAuthnSignCount
+		}
+		if err := a.Store.UpdateSignCount(c.ID, ad.signCount); err != nil {
+			return "", err
+		}
+	}
+	return c.Username, nil
+}
+
+// verifyClientData checks the collected client data of a ceremony of type typ, returning
+// the challenge it answers.
+func (a *WebAuthn) verifyClientData(b []byte, typ string) (webAuthnChallenge, error) {
+	var cd struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(b, &cd); err != nil {
+		return webAuthnChallenge{}, ErrWebAuthnMalformed
+	}
+	if cd.Type != typ {
+		return webAuthnChallenge{}, ErrWebAuthnMalformed
+	}
+	ch, ok := a.takeChallenge(cd.Challenge, typ == "webauthn.create")
+	if !ok {
+		return webAuthnChallenge{}, ErrWebAuthnChallenge
+	}
+	if cd.Origin != a.Origin {
+		return webAuthnChallenge{}, ErrWebAuthnOrigin
+	}
+	return ch, nil
+}
+
+type authData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthData parses and checks authenticator data.
+func (a *WebAuthn) parseAuthData(b []byte) (authData, error) {
+	if len(b) < 37 {
+		return authData{}, ErrWebAuthnMalformed
+	}
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	if !bytes.Equal(b[:32], rpIDHash[:]) {
+		return authData{}, ErrWebAuthnRelyingParty
+	}
+	ad := authData{
+		flags:     b[32],
+		signCount: binary.BigEndian.Uint32(b[33:37]),
+	}
+	if ad.flags&authDataUserPresent == 0 {
+		return authData{}, ErrWebAuthnUserPresence
+	}
+	if ad.flags&authDataAttestedData != 0 {
+		rest := b[37:]
+		if len(rest) < 18 {
+			return authData{}, ErrWebAuthnMalformed
+		}
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < n {
+			return authData{}, ErrWebAuthnMalformed
+		}
+		ad.credentialID = append([]byte(nil), rest[:n]...)
+		_, m, err := decodeCBOR(rest[n:])
+		if err != nil {
+			return authData{}, ErrWebAuthnMalformed
+		}
+		ad.publicKey = append([]byte(nil), rest[n:n+m]...)
+	}
+	return ad, nil
+}
+
+// parseCOSEKey decodes an ES256 or RS256 COSE_Key, returning its algorithm and public key.
+func parseCOSEKey(b []byte) (int64, interface{}, error) {
+	v, _, err := decodeCBOR(b)
+	if err != nil {
+		return 0, nil, ErrWebAuthnMalformed
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return 0, nil, ErrWebAuthnMalformed
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == coseES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return 0, nil, ErrWebAuthnUnsupportedKey
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return 0, nil, ErrWebAuthnUnsupportedKey
+		}
+		return alg, pub, nil
+
+	case kty == 3 && alg == coseRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		ev := new(big.Int).SetBytes(e)
+		if len(n) == 0 || ev.BitLen() > 31 || ev.Sign() == 0 {
+			return 0, nil, ErrWebAuthnUnsupportedKey
+		}
+		return alg, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(ev.Int64())}, nil
+	}
+	return 0, nil, ErrWebAuthnUnsupportedKey
+}
+
+// verifyCOSESignature checks that sig is a valid signature of data by pub using the COSE
+// algorithm alg.
+func verifyCOSESignature(alg int64, pub interface{}, data, sig []byte) error {
+	h := sha256.Sum256(data)
+	switch alg {
+	case coseES256:
+		if !ecdsa.VerifyASN1(pub.(*ecdsa.PublicKey), h[:], sig) {
+			return ErrWebAuthnSignature
+		}
+		return nil
+
+	case coseRS256:
+		if err := rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA256, h[:], sig); err != nil {
+			return ErrWebAuthnSignature
+		}
+		return nil
+	}
+	return ErrWebAuthnUnsupportedKey
+}
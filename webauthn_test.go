@@ -0,0 +1,275 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/dhowden/httpauth"
+)
+
+// cborHead encodes a CBOR data item head.
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 1<<8:
+		return []byte{major<<5 | 24, byte(n)}
+	default:
+		b := []byte{major<<5 | 25, 0, 0}
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+		return b
+	}
+}
+
+// cborEncode encodes v, where maps are given as []interface{} of alternating keys and
+// values to fix their order.
+func cborEncode(v interface{}) []byte {
+	switch v := v.(type) {
+	case int:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case []interface{}:
+		b := cborHead(5, uint64(len(v)/2))
+		for _, x := range v {
+			b = append(b, cborEncode(x)...)
+		}
+		return b
+	}
+	panic("unsupported type")
+}
+
+type testAuthenticator struct {
+	key   *ecdsa.PrivateKey
+	id    []byte
+	count uint32
+}
+
+func (a *testAuthenticator) authData(rpID string, flags byte, attested bool) []byte {
+	h := sha256.Sum256([]byte(rpID))
+	b := append(h[:], flags)
+	b = binary.BigEndian.AppendUint32(b, a.count)
+	if attested {
+		b = append(b, make([]byte, 16)...)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(a.id)))
+		b = append(b, a.id...)
+		b = append(b, cborEncode([]interface{}{
+			1, 2, 3, -7, -1, 1,
+			-2, a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+			-3, a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+		})...)
+	}
+	return b
+}
+
+func clientData(t *testing.T, typ, challenge, origin string) []byte {
+	b, err := json.Marshal(map[string]string{"type": typ, "challenge": challenge, "origin": origin})
+	if err != nil {
+		t.Fatalf("unexpected error encoding client data: %v", err)
+	}
+	return b
+}
+
+func postJSON(t *testing.T, h http.Handler, v interface{}, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(v); err != nil {
+		t.Fatalf("unexpected error encoding request: %v", err)
+	}
+	r, err := http.NewRequest("POST", "/", &body)
+	if err != nil {
+		t.Fatalf("unexpected error creating request: %v", err)
+	}
+	r.SetBasicAuth("alice", "shhhh")
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func challengeFrom(t *testing.T, w *httptest.ResponseRecorder) string {
+	var opts struct {
+		Challenge string `json:"challenge"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&opts); err != nil {
+		t.Fatalf("unexpected error decoding options: %v", err)
+	}
+	return opts.Challenge
+}
+
+func TestWebAuthn(t *testing.T) {
+	const rpID, origin = "example.com", "https://example.com"
+	s := &Sessions{Key: sessionKey}
+	a := &WebAuthn{RPID: rpID, RPName: "Example", Origin: origin, Store: NewMemoryWebAuthnStore(), Sessions: s}
+	c := Creds(map[string]string{"alice": "shhhh"})
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error generating key: %v", err)
+	}
+	auth := &testAuthenticator{key: key, id: []byte("credential-1")}
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	// Registration
+	beginReg := NewHandler(c, http.HandlerFunc(a.BeginRegistration))
+	finishReg := NewHandler(c, http.HandlerFunc(a.FinishRegistration))
+
+	w := postJSON(t, beginReg, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("BeginRegistration: w.Code = %d, expected: %d", w.Code, http.StatusOK)
+	}
+	challenge := challengeFrom(t, w)
+	attObj := cborEncode([]interface{}{
+		"fmt", "none",
+		"attStmt", []interface{}{},
+		"authData", auth.authData(rpID, 0x41, true),
+	})
+	reg := map[string]interface{}{
+		"id":    b64(auth.id),
+		"rawId": b64(auth.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64(clientData(t, "webauthn.create", challenge, origin)),
+			"attestationObject": b64(attObj),
+		},
+	}
+	// The raw ID must be the ID of the new credential.
+	mismatched := map[string]interface{}{}
+	for k, v := range reg {
+		mismatched[k] = v
+	}
+	mismatched["rawId"] = b64([]byte("other"))
+	if w := postJSON(t, finishReg, mismatched); w.Code != http.StatusBadRequest {
+		t.Errorf("FinishRegistration (mismatched rawId): w.Code = %d, expected: %d", w.Code, http.StatusBadRequest)
+	}
+	w = postJSON(t, beginReg, nil)
+	var opts struct {
+		Challenge string `json:"challenge"`
+		User      struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&opts); err != nil {
+		t.Fatalf("unexpected error decoding options: %v", err)
+	}
+	challenge, handle := opts.Challenge, opts.User.ID
+	if handle == "" || handle == b64([]byte("alice")) {
+		t.Errorf("BeginRegistration: user.id = %q, expected an opaque handle", handle)
+	}
+	reg["response"].(map[string]string)["clientDataJSON"] = b64(clientData(t, "webauthn.create", challenge, origin))
+
+	if w := postJSON(t, finishReg, reg); w.Code != http.StatusCreated {
+		t.Fatalf("FinishRegistration: w.Code = %d, expected: %d", w.Code, http.StatusCreated)
+	}
+
+	// Challenges cannot be reused.
+	if w := postJSON(t, finishReg, reg); w.Code != http.StatusUnauthorized {
+		t.Errorf("FinishRegistration (replayed): w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// Further registrations use the same handle.
+	w = postJSON(t, beginReg, nil)
+	if err := json.NewDecoder(w.Body).Decode(&opts); err != nil {
+		t.Fatalf("unexpected error decoding options: %v", err)
+	}
+	if opts.User.ID != handle {
+		t.Errorf("BeginRegistration: user.id = %q, expected: %q", opts.User.ID, handle)
+	}
+
+	// Login
+	login := func(origin string, sign func(data []byte) []byte) *httptest.ResponseRecorder {
+		w := postJSON(t, http.HandlerFunc(a.BeginLogin), nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("BeginLogin: w.Code = %d, expected: %d", w.Code, http.StatusOK)
+		}
+		cd := clientData(t, "webauthn.get", challengeFrom(t, w), origin)
+		auth.count++
+		ad := auth.authData(rpID, 0x01, false)
+		h := sha256.Sum256(cd)
+		return postJSON(t, http.HandlerFunc(a.FinishLogin), map[string]interface{}{
+			"id":    b64(auth.id),
+			"rawId": b64(auth.id),
+			"type":  "public-key",
+			"response": map[string]string{
+				"clientDataJSON":    b64(cd),
+				"authenticatorData": b64(ad),
+				"signature":         b64(sign(append(ad, h[:]...))),
+				"userHandle":        handle,
+			},
+		})
+	}
+	sign := func(data []byte) []byte {
+		h := sha256.Sum256(data)
+		sig, err := ecdsa.SignASN1(rand.Reader, key, h[:])
+		if err != nil {
+			t.Fatalf("unexpected error signing: %v", err)
+		}
+		return sig
+	}
+
+	w = login(origin, sign)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("FinishLogin: w.Code = %d, expected: %d", w.Code, http.StatusNoContent)
+	}
+	r := &http.Request{Header: http.Header{}}
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	if username, ok := s.User(r); !ok || username != "alice" {
+		t.Errorf("s.User() = %q, %v, expected %q, true", username, ok, "alice")
+	}
+
+	if w := login("https://evil.example", sign); w.Code != http.StatusUnauthorized {
+		t.Errorf("FinishLogin (wrong origin): w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := login(origin, func(data []byte) []byte { return sign([]byte("other")) }); w.Code != http.StatusUnauthorized {
+		t.Errorf("FinishLogin (bad signature): w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+
+	handle = b64([]byte("alice"))
+	if w := login(origin, sign); w.Code != http.StatusUnauthorized {
+		t.Errorf("FinishLogin (wrong user handle): w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+
+	auth.count = 0
+	if w := login(origin, sign); w.Code != http.StatusUnauthorized {
+		t.Errorf("FinishLogin (counter reset): w.Code = %d, expected: %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// Without Sessions, logins fail rather than panic.
+	a.Sessions = nil
+	if w := postJSON(t, http.HandlerFunc(a.FinishLogin), nil); w.Code != http.StatusInternalServerError {
+		t.Errorf("FinishLogin (no Sessions): w.Code = %d, expected: %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestWebAuthnChallengeLimit(t *testing.T) {
+	a := &WebAuthn{RPID: "example.com", RPName: "Example", Origin: "https://example.com", Store: NewMemoryWebAuthnStore()}
+	for i := 0; i < 10000; i++ {
+		if w := postJSON(t, http.HandlerFunc(a.BeginLogin), nil); w.Code != http.StatusOK {
+			t.Fatalf("[%d] BeginLogin: w.Code = %d, expected: %d", i, w.Code, http.StatusOK)
+		}
+	}
+	if w := postJSON(t, http.HandlerFunc(a.BeginLogin), nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("BeginLogin: w.Code = %d, expected: %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2015, David Howden
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httpauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebhookFormat is the format of a webhook payload signature.
+type WebhookFormat int
+
+// Supported webhook signature formats.
+const (
+	// WebhookHMAC is a hex-encoded HMAC-SHA256 of the body (optionally prefixed with
+	// "sha256=") in the header named by WebhookVerifier.Header.  If
+	// WebhookVerifier.TimestampHeader is set, the signed payload is the timestamp
+	// (in Unix seconds), a ".", then the body.
+	WebhookHMAC WebhookFormat = iota
+
+	// WebhookGitHub is the GitHub format: "sha256=" followed by the hex-encoded
+	// HMAC-SHA256 of the body, in the X-Hub-Signature-256 header.
+	WebhookGitHub
+
+	// WebhookStripe is the Stripe format: a timestamp "t" and one or more hex-encoded
+	// "v1" HMAC-SHA256 signatures of the timestamp, a ".", then the body, in the
+	// Stripe-Signature header.
+	WebhookStripe
+)
+
+// WebhookVerifier verifies the payload signatures of incoming webhook requests.
+type WebhookVerifier struct {
+	// Format is the signature format.
+	Format WebhookFormat
+
+	// Secrets are the shared signing secrets.  A signature made with any of them is
+	// accepted, so that secrets can be rotated.
+	Secrets [][]byte
+
+	// Header is the name of the signature header for WebhookHMAC.  Defaults to
+	// "X-Signature".
+	Header string
+
+	// TimestampHeader is the name of the timestamp header for WebhookHMAC.  If empty
+	// then the signature does not include a timestamp.
+	TimestampHeader string
+
+	// Tolerance is the maximum difference between a signed timestamp and the current
+	// time.  Defaults to 5 minutes.
+	Tolerance time.Duration
+
+	// MaxBody is the maximum size of request body which will be read to verify the
+	// signature.  Defaults to 10MB.
+	MaxBody int64
+}
+
+// NewWebhookHandler returns an http.Handler which verifies webhook payload signatures
+// using the WebhookVerifier and passes requests to the given http.Handler when the
+// signature is valid (responds with http.StatusUnauthorized otherwise).  The request
+// body is buffered so that it can be read again by the handler.
+func NewWebhookHandler(v *WebhookVerifier, h http.Handler) http.Handler {
+	vv := *v
+	v = &vv
+	if v.Header == "" {
+		v.Header = "X-Signature"
+	}
+	if v.Tolerance == 0 {
+		v.Tolerance = 5 * time.Minute
+	}
+	if v.MaxBody == 0 {
+		v.MaxBody = maxSignedBody
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !v.verify(r) {
+			unauthorized(w, r, "")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// verify returns true if r has a valid payload signature.
+func (v *WebhookVerifier) verify(r *http.Request) bool {
+	var ts string
+	var sigs []string
+	switch v.Format {
+	case WebhookHMAC:
+		sig := r.Header.Get(v.Header)
+		sigs = []string{strings.TrimPrefix(sig, "sha256=")}
+		if v.TimestampHeader != "" {
+			ts = r.Header.Get(v.TimestampHeader)
+			if ts == "" {
+				return false
+			}
+		}
+
+	case WebhookGitHub:
+		sig := r.Header.Get("X-Hub-Signature-256")
+		if !strings.HasPrefix(sig, "sha256=") {
+			return false
+		}
+		sigs = []string{sig[len("sha256="):]}
+
+	case WebhookStripe:
+		for _, kv := range strings.Split(r.Header.Get("Stripe-Signature"), ",") {
+			k, val, _ := strings.Cut(strings.TrimSpace(kv), "=")
+			switch k {
+			case "t":
+				ts = val
+			case "v1":
+				sigs = append(sigs, val)
+			}
+		}
+		if ts == "" {
+			return false
+		}
+
+	default:
+		return false
+	}
+
+	if ts != "" {
+		n, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return false
+		}
+		if skew := time.Since(time.Unix(n, 0)); skew > v.Tolerance || skew < -v.Tolerance {
+			return false
+		}
+	}
+
+	body, ok := readBody(r, v.MaxBody)
+	if !ok {
+		return false
+	}
+	payload := body
+	if ts != "" {
+		payload = append([]byte(ts+"."), body...)
+	}
+
+	for _, secret := range v.Secrets {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(payload)
+		sum := mac.Sum(nil)
+		for _, sig := range sigs {
+			b, err := hex.DecodeString(sig)
+			if err == nil && hmac.Equal(b, sum) {
+				return true
+			}
+		}
+	}
+	return false
+}